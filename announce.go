@@ -0,0 +1,228 @@
+package clusterf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+type AnnounceOptions struct {
+	BirdFile   string `long:"announce-bird-file" value-name:"PATH" description:"Write BIRD static routes for the IPv4 VIPs to the include file"`
+	Bird6File  string `long:"announce-bird6-file" value-name:"PATH" description:"Write BIRD static routes for the IPv6 VIPs to the include file"`
+	BirdRoute  string `long:"announce-bird-route" value-name:"ROUTE" default:"blackhole" description:"BIRD static route destination"`
+	BirdReload string `long:"announce-bird-reload" value-name:"COMMAND" description:"Run the command after updating the BIRD include files, such as 'birdc configure'"`
+
+	ExaBGP  string `long:"announce-exabgp" value-name:"PATH|-" description:"Write ExaBGP process API announce and withdraw commands for the VIPs to the path, or - for stdout"`
+	NextHop string `long:"announce-next-hop" value-name:"ADDR" default:"self" description:"ExaBGP next-hop for the announced routes"`
+
+	RequireBackends bool `long:"announce-require-backends" description:"Only announce VIPs for services with at least one backend with a non-zero weight"`
+}
+
+func (options AnnounceOptions) Enabled() bool {
+	return options.BirdFile != "" || options.Bird6File != "" || options.ExaBGP != ""
+}
+
+// Return a new Announcer, or nil if not enabled
+func (options AnnounceOptions) Announcer() (*Announcer, error) {
+	var announcer = Announcer{
+		options:   options,
+		announced: make(map[string]net.IP),
+	}
+
+	if !options.Enabled() {
+		return nil, nil
+	}
+
+	if options.ExaBGP == "" {
+
+	} else if options.ExaBGP == "-" {
+		announcer.exabgp = os.Stdout
+	} else if file, err := os.OpenFile(options.ExaBGP, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+		return nil, err
+	} else {
+		announcer.exabgp = file
+	}
+
+	return &announcer, nil
+}
+
+// Host route prefix for the VIP
+func announcePrefix(ip net.IP) string {
+	if ip.To4() != nil {
+		return fmt.Sprintf("%v/32", ip)
+	} else {
+		return fmt.Sprintf("%v/128", ip)
+	}
+}
+
+// Announce VIP host routes to a routing daemon
+type Announcer struct {
+	options AnnounceOptions
+	exabgp  io.Writer
+
+	announced map[string]net.IP
+	written   bool
+}
+
+// Write the BIRD static routes for the announced VIPs of the given family
+func (announcer *Announcer) writeBird(path string, ipv4 bool) error {
+	var buf bytes.Buffer
+	var prefixes []string
+
+	for _, ip := range announcer.announced {
+		if (ip.To4() != nil) == ipv4 {
+			prefixes = append(prefixes, announcePrefix(ip))
+		}
+	}
+	sort.Strings(prefixes)
+
+	fmt.Fprintf(&buf, "# clusterf-ipvs\n")
+
+	for _, prefix := range prefixes {
+		fmt.Fprintf(&buf, "route %s %s;\n", prefix, announcer.options.BirdRoute)
+	}
+
+	return replaceFile(path, buf.Bytes())
+}
+
+func (announcer *Announcer) reloadBird() error {
+	var args = strings.Fields(announcer.options.BirdReload)
+
+	if len(args) == 0 {
+		return nil
+	} else if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %v: %s", announcer.options.BirdReload, err, bytes.TrimSpace(output))
+	}
+
+	return nil
+}
+
+func (announcer *Announcer) writeExaBGP(action string, ip net.IP) error {
+	_, err := fmt.Fprintf(announcer.exabgp, "%s route %s next-hop %s\n", action, announcePrefix(ip), announcer.options.NextHop)
+
+	return err
+}
+
+// Announce routes for the given VIPs, and withdraw any other previously announced routes.
+//
+// Does nothing if the VIPs are unchanged. Any failed writes are retried on the next update.
+func (announcer *Announcer) Announce(vips []net.IP) error {
+	var announce = make(map[string]net.IP)
+	var changed = !announcer.written
+
+	for _, ip := range vips {
+		announce[ip.String()] = ip
+	}
+
+	for key, ip := range announcer.announced {
+		if _, exists := announce[key]; exists {
+			continue
+		}
+
+		log.Printf("Announce: Withdraw %v\n", announcePrefix(ip))
+
+		if announcer.exabgp == nil {
+
+		} else if err := announcer.writeExaBGP("withdraw", ip); err != nil {
+			return fmt.Errorf("ExaBGP %v: %v", announcer.options.ExaBGP, err)
+		}
+
+		delete(announcer.announced, key)
+		changed = true
+	}
+
+	for key, ip := range announce {
+		if _, exists := announcer.announced[key]; exists {
+			continue
+		}
+
+		log.Printf("Announce: %v\n", announcePrefix(ip))
+
+		if announcer.exabgp == nil {
+
+		} else if err := announcer.writeExaBGP("announce", ip); err != nil {
+			return fmt.Errorf("ExaBGP %v: %v", announcer.options.ExaBGP, err)
+		}
+
+		announcer.announced[key] = ip
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	announcer.written = false
+
+	if announcer.options.BirdFile == "" {
+
+	} else if err := announcer.writeBird(announcer.options.BirdFile, true); err != nil {
+		return fmt.Errorf("BIRD %v: %v", announcer.options.BirdFile, err)
+	}
+
+	if announcer.options.Bird6File == "" {
+
+	} else if err := announcer.writeBird(announcer.options.Bird6File, false); err != nil {
+		return fmt.Errorf("BIRD %v: %v", announcer.options.Bird6File, err)
+	}
+
+	if announcer.options.BirdReload == "" {
+
+	} else if err := announcer.reloadBird(); err != nil {
+		return fmt.Errorf("BIRD reload: %v", err)
+	}
+
+	announcer.written = true
+
+	return nil
+}
+
+// Withdraw all announced routes, before shutting down
+func (announcer *Announcer) Withdraw() error {
+	return announcer.Announce(nil)
+}
+
+// Return the VIPs for the configured services, excluding any draining services.
+//
+// With requireBackends, only includes services with any dests having a non-zero weight.
+// Returns nil until configured.
+func (driver *IPVSDriver) VIPs(requireBackends bool) []net.IP {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	var vips []net.IP
+	var exists = make(map[string]bool)
+
+	if !driver.configured {
+		return nil
+	}
+
+	for _, service := range driver.services {
+		var up = !requireBackends
+
+		if service.FwMark != 0 || service.drain {
+			continue
+		}
+
+		for _, dest := range service.dests {
+			if dest.Weight > 0 {
+				up = true
+			}
+		}
+
+		if up && !exists[service.Addr.String()] {
+			vips = append(vips, service.Addr)
+			exists[service.Addr.String()] = true
+		}
+	}
+
+	sort.Slice(vips, func(i, j int) bool { return bytes.Compare(vips[i].To16(), vips[j].To16()) < 0 })
+
+	return vips
+}
@@ -0,0 +1,154 @@
+package clusterf
+
+import (
+	"bytes"
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAnnounceBird(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clusterf-announce")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	announcer, err := AnnounceOptions{
+		BirdFile:  filepath.Join(dir, "bird.conf"),
+		Bird6File: filepath.Join(dir, "bird6.conf"),
+		BirdRoute: "blackhole",
+	}.Announcer()
+	if err != nil {
+		t.Fatalf("Announcer: %v", err)
+	}
+
+	var testBird = func(path string, content string) {
+		if data, err := ioutil.ReadFile(path); err != nil {
+			t.Errorf("ReadFile %v: %v", path, err)
+		} else if diff := pretty.Compare(content, string(data)); diff != "" {
+			t.Errorf("ReadFile %v:\n%s", path, diff)
+		}
+	}
+
+	if err := announcer.Announce([]net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("2001:db8::1"), net.ParseIP("10.0.0.1")}); err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+
+	testBird(filepath.Join(dir, "bird.conf"), "# clusterf-ipvs\nroute 10.0.0.1/32 blackhole;\nroute 10.0.0.2/32 blackhole;\n")
+	testBird(filepath.Join(dir, "bird6.conf"), "# clusterf-ipvs\nroute 2001:db8::1/128 blackhole;\n")
+
+	if err := announcer.Withdraw(); err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+
+	testBird(filepath.Join(dir, "bird.conf"), "# clusterf-ipvs\n")
+	testBird(filepath.Join(dir, "bird6.conf"), "# clusterf-ipvs\n")
+}
+
+func TestAnnounceExaBGP(t *testing.T) {
+	var buf bytes.Buffer
+	var announcer = Announcer{
+		options:   AnnounceOptions{NextHop: "self"},
+		exabgp:    &buf,
+		announced: make(map[string]net.IP),
+	}
+
+	for _, test := range []struct {
+		vips   []net.IP
+		output string
+	}{
+		{nil, ""},
+		{[]net.IP{net.ParseIP("10.0.0.1")}, "announce route 10.0.0.1/32 next-hop self\n"},
+		{[]net.IP{net.ParseIP("10.0.0.1")}, ""},
+		{[]net.IP{net.ParseIP("2001:db8::1")}, "withdraw route 10.0.0.1/32 next-hop self\nannounce route 2001:db8::1/128 next-hop self\n"},
+		{nil, "withdraw route 2001:db8::1/128 next-hop self\n"},
+	} {
+		if err := announcer.Announce(test.vips); err != nil {
+			t.Fatalf("Announce %v: %v", test.vips, err)
+		}
+
+		if diff := pretty.Compare(test.output, buf.String()); diff != "" {
+			t.Errorf("Announce %v:\n%s", test.vips, diff)
+		}
+
+		buf.Reset()
+	}
+}
+
+func testVIPs(vips []net.IP) []string {
+	var strs []string
+
+	for _, ip := range vips {
+		strs = append(strs, ip.String())
+	}
+
+	return strs
+}
+
+func TestDriverVIPs(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName:    "wlc",
+		FwdMethod:    ipvs.IP_VS_CONN_F_DROUTE,
+		DrainTimeout: time.Minute,
+	}, client)
+
+	var configServices = map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", IPv6: "2001:db8::1", TCP: 80, UDP: 53},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", IPv6: "2001:db8:1::1", Weight: 10},
+			},
+		},
+		"test2": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", Weight: 10},
+			},
+		},
+		"test3": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.3", TCP: 80},
+		},
+		"test-fwmark": config.Service{
+			Frontend: &config.ServiceFrontend{FwMark: 1},
+		},
+	}
+
+	if vips := driver.VIPs(false); vips != nil {
+		t.Errorf("VIPs before config: %v", vips)
+	}
+
+	if err := driver.Config(config.Config{Services: configServices}); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	if diff := pretty.Compare([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "2001:db8::1"}, testVIPs(driver.VIPs(false))); diff != "" {
+		t.Errorf("VIPs:\n%s", diff)
+	}
+
+	// down backend, and draining service
+	if err := driver.Health(Health{CheckID{"test2", "test1"}: false}); err != nil {
+		t.Fatalf("IPVSDriver.Health: %v", err)
+	}
+
+	delete(configServices, "test")
+
+	if err := driver.Config(config.Config{Services: configServices}); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	if diff := pretty.Compare([]string{"10.0.0.2", "10.0.0.3"}, testVIPs(driver.VIPs(false))); diff != "" {
+		t.Errorf("VIPs:\n%s", diff)
+	}
+
+	if vips := driver.VIPs(true); len(vips) != 0 {
+		t.Errorf("VIPs with backends: %v", vips)
+	}
+}
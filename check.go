@@ -0,0 +1,429 @@
+package clusterf
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/qmsk/clusterf/config"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type CheckOptions struct {
+	Interval time.Duration `long:"check-interval" value-name:"DURATION" default:"5s" description:"Default backend health check interval"`
+	Timeout  time.Duration `long:"check-timeout" value-name:"DURATION" default:"2s" description:"Default backend health check timeout"`
+	Rise     uint          `long:"check-rise" value-name:"COUNT" default:"2" description:"Default number of successful checks to mark a backend up"`
+	Fall     uint          `long:"check-fall" value-name:"COUNT" default:"3" description:"Default number of failed checks to mark a backend down"`
+}
+
+// Return a new Checker, which will start checking backends once configured
+func (options CheckOptions) Checker() *Checker {
+	var checker = Checker{
+		options: options,
+	}
+
+	checker.init()
+
+	go checker.run()
+
+	return &checker
+}
+
+// Identify the checked service backend
+type CheckID struct {
+	Service string
+	Backend string
+}
+
+func (id CheckID) String() string {
+	return fmt.Sprintf("%s/%s", id.Service, id.Backend)
+}
+
+// Backend health state from checks.
+//
+// Backends without any configured checks are not included, and are considered to be up.
+type Health map[CheckID]bool
+
+// Backends are up unless explicitly checked as down
+func (health Health) Up(serviceName string, backendName string) bool {
+	if up, exists := health[CheckID{serviceName, backendName}]; !exists {
+		return true
+	} else {
+		return up
+	}
+}
+
+func (health Health) clone() Health {
+	copy := make(Health)
+
+	for id, up := range health {
+		copy[id] = up
+	}
+
+	return copy
+}
+
+type Check struct {
+	Type string // tcp udp http
+	Addr string // host:port
+
+	Interval time.Duration
+	Timeout  time.Duration
+	Rise     uint
+	Fall     uint
+
+	// udp
+	Send   string
+	Expect string
+
+	// http
+	Path   string
+	Status int
+}
+
+func (check Check) String() string {
+	return fmt.Sprintf("%s://%s", check.Type, check.Addr)
+}
+
+// Build a Check for the given service backend, or nil if the backend cannot be checked
+func configCheck(configCheck config.ServiceCheck, backend config.ServiceBackend, options CheckOptions) (*Check, error) {
+	var check = Check{
+		Type:     configCheck.Type,
+		Interval: options.Interval,
+		Timeout:  options.Timeout,
+		Rise:     options.Rise,
+		Fall:     options.Fall,
+		Send:     configCheck.Send,
+		Expect:   configCheck.Expect,
+		Path:     configCheck.Path,
+		Status:   configCheck.Status,
+	}
+	var host string
+	var port = configCheck.Port
+
+	if backend.IPv4 != "" {
+		host = backend.IPv4
+	} else if backend.IPv6 != "" {
+		host = backend.IPv6
+	} else {
+		return nil, nil
+	}
+
+	switch configCheck.Type {
+	case "tcp", "http":
+		if port == 0 {
+			port = backend.TCP
+		}
+	case "udp":
+		if port == 0 {
+			port = backend.UDP
+		}
+	default:
+		return nil, fmt.Errorf("Invalid check type: %#v", configCheck.Type)
+	}
+
+	if port == 0 {
+		// no matching backend port
+		return nil, nil
+	}
+
+	check.Addr = net.JoinHostPort(host, strconv.Itoa(int(port)))
+
+	if configCheck.Interval == "" {
+
+	} else if interval, err := time.ParseDuration(configCheck.Interval); err != nil {
+		return nil, fmt.Errorf("Invalid check interval: %v", err)
+	} else {
+		check.Interval = interval
+	}
+
+	if configCheck.Timeout == "" {
+
+	} else if timeout, err := time.ParseDuration(configCheck.Timeout); err != nil {
+		return nil, fmt.Errorf("Invalid check timeout: %v", err)
+	} else {
+		check.Timeout = timeout
+	}
+
+	if configCheck.Rise != 0 {
+		check.Rise = configCheck.Rise
+	}
+	if configCheck.Fall != 0 {
+		check.Fall = configCheck.Fall
+	}
+
+	if check.Interval <= 0 {
+		return nil, fmt.Errorf("Invalid check interval: %v", check.Interval)
+	}
+
+	return &check, nil
+}
+
+// Build the set of Checks for all service backends from Config
+func configChecks(config config.Config, options CheckOptions) (map[CheckID]Check, error) {
+	var checks = make(map[CheckID]Check)
+
+	for serviceName, configService := range config.Services {
+		if configService.Check == nil {
+			continue
+		}
+
+		for backendName, configBackend := range configService.Backends {
+			if check, err := configCheck(*configService.Check, configBackend, options); err != nil {
+				return nil, fmt.Errorf("Invalid check for service %v backend %v: %v", serviceName, backendName, err)
+			} else if check != nil {
+				checks[CheckID{serviceName, backendName}] = *check
+			}
+		}
+	}
+
+	return checks, nil
+}
+
+// Run the check once, returning an error if the check fails
+func (check Check) check() error {
+	switch check.Type {
+	case "tcp":
+		return check.checkTCP()
+	case "udp":
+		return check.checkUDP()
+	case "http":
+		return check.checkHTTP()
+	default:
+		return fmt.Errorf("Invalid check type: %v", check.Type)
+	}
+}
+
+func (check Check) checkTCP() error {
+	if conn, err := net.DialTimeout("tcp", check.Addr, check.Timeout); err != nil {
+		return err
+	} else {
+		return conn.Close()
+	}
+}
+
+// Without an Expect response, the check only fails on an ICMP unreachable error.
+func (check Check) checkUDP() error {
+	conn, err := net.DialTimeout("udp", check.Addr, check.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(check.Timeout)); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write([]byte(check.Send)); err != nil {
+		return err
+	}
+
+	var buf = make([]byte, 1500)
+
+	if n, err := conn.Read(buf); err == nil {
+		if !bytes.HasPrefix(buf[:n], []byte(check.Expect)) {
+			return fmt.Errorf("Unexpected response: %q", buf[:n])
+		}
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() && check.Expect == "" {
+		// no response, but no error either
+	} else {
+		return err
+	}
+
+	return nil
+}
+
+func (check Check) checkHTTP() error {
+	var httpClient = http.Client{
+		Timeout: check.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	var url = fmt.Sprintf("http://%s%s", check.Addr, check.Path)
+
+	response, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if check.Status != 0 && response.StatusCode != check.Status {
+		return fmt.Errorf("HTTP %v", response.Status)
+	} else if check.Status == 0 && (response.StatusCode < 200 || response.StatusCode >= 400) {
+		return fmt.Errorf("HTTP %v", response.Status)
+	}
+
+	return nil
+}
+
+// Running check for a single backend
+type checkRunner struct {
+	id    CheckID
+	check Check
+
+	stopChan chan struct{}
+}
+
+type checkResult struct {
+	runner *checkRunner
+	up     bool
+}
+
+// Check periodically, reporting any changes in the up state.
+//
+// Backends start out as up, and only go down once the check has failed check.Fall times.
+func (runner *checkRunner) run(resultChan chan checkResult) {
+	var up = true
+	var count uint
+	var ticker = time.NewTicker(runner.check.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-runner.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		err := runner.check.check()
+
+		if (err == nil) == up {
+			count = 0
+			continue
+		}
+
+		count++
+
+		if up && count >= runner.check.Fall {
+			log.Printf("check %v %v: down: %v", runner.id, runner.check, err)
+		} else if !up && count >= runner.check.Rise {
+			log.Printf("check %v %v: up", runner.id, runner.check)
+		} else {
+			continue
+		}
+
+		up = !up
+		count = 0
+
+		select {
+		case resultChan <- checkResult{runner, up}:
+		case <-runner.stopChan:
+			return
+		}
+	}
+}
+
+// Health check service backends
+type Checker struct {
+	options CheckOptions
+
+	configChan chan map[CheckID]Check
+	resultChan chan checkResult
+	listenChan chan Health
+}
+
+func (checker *Checker) init() {
+	checker.configChan = make(chan map[CheckID]Check)
+	checker.resultChan = make(chan checkResult)
+	checker.listenChan = make(chan Health)
+}
+
+// Start/stop runners to match the given checks, and return the new set of runners
+func (checker *Checker) config(runners map[CheckID]*checkRunner, checks map[CheckID]Check) map[CheckID]*checkRunner {
+	var newRunners = make(map[CheckID]*checkRunner)
+
+	for id, check := range checks {
+		if runner, exists := runners[id]; exists && runner.check == check {
+			newRunners[id] = runner
+		} else {
+			log.Printf("check %v: start %v", id, check)
+
+			runner = &checkRunner{
+				id:       id,
+				check:    check,
+				stopChan: make(chan struct{}),
+			}
+
+			go runner.run(checker.resultChan)
+
+			newRunners[id] = runner
+		}
+	}
+
+	for id, runner := range runners {
+		if newRunners[id] != runner {
+			close(runner.stopChan)
+		}
+	}
+
+	return newRunners
+}
+
+func (checker *Checker) run() {
+	var runners = make(map[CheckID]*checkRunner)
+	var health = make(Health)
+	var changed = false
+	var send Health // copy of the changed health, until sent
+
+	for {
+		// only send once changed
+		var listenChan chan Health
+
+		if changed {
+			send = health.clone()
+			changed = false
+		}
+
+		if send != nil {
+			listenChan = checker.listenChan
+		}
+
+		select {
+		case checks := <-checker.configChan:
+			var oldRunners = runners
+
+			runners = checker.config(oldRunners, checks)
+
+			// stopped or restarted checks reset to up
+			for id := range health {
+				if runners[id] != oldRunners[id] {
+					delete(health, id)
+					changed = true
+				}
+			}
+
+		case result := <-checker.resultChan:
+			if runners[result.runner.id] != result.runner {
+				// stopped
+			} else {
+				health[result.runner.id] = result.up
+				changed = true
+			}
+
+		case listenChan <- send:
+			send = nil
+		}
+	}
+}
+
+// Update the set of checked backends from config.
+//
+// Restarts any checks that have changed, with the backend state reset to up.
+func (checker *Checker) Config(config config.Config) error {
+	checks, err := configChecks(config, checker.options)
+	if err != nil {
+		return err
+	}
+
+	checker.configChan <- checks
+
+	return nil
+}
+
+// Follow changes in backend Health
+func (checker *Checker) Listen() chan Health {
+	return checker.listenChan
+}
@@ -0,0 +1,247 @@
+package clusterf
+
+import (
+	"github.com/qmsk/clusterf/config"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCheckOptions = CheckOptions{
+	Interval: 10 * time.Millisecond,
+	Timeout:  100 * time.Millisecond,
+	Rise:     1,
+	Fall:     1,
+}
+
+// Return a closed local port
+func testCheckClosedPort(t *testing.T, network string) int {
+	switch network {
+	case "tcp":
+		listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("net.ListenTCP: %v", err)
+		}
+		defer listener.Close()
+
+		return listener.Addr().(*net.TCPAddr).Port
+	case "udp":
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("net.ListenUDP: %v", err)
+		}
+		defer conn.Close()
+
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	default:
+		panic(network)
+	}
+}
+
+func testCheckClosedAddr(t *testing.T, network string) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(testCheckClosedPort(t, network)))
+}
+
+func TestConfigCheck(t *testing.T) {
+	var tests = []struct {
+		check   config.ServiceCheck
+		backend config.ServiceBackend
+		result  *Check
+		error   string
+	}{
+		{
+			check:   config.ServiceCheck{Type: "tcp"},
+			backend: config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080},
+			result:  &Check{Type: "tcp", Addr: "10.1.0.1:8080", Interval: 10 * time.Millisecond, Timeout: 100 * time.Millisecond, Rise: 1, Fall: 1},
+		},
+		{
+			check:   config.ServiceCheck{Type: "http", Port: 8081, Path: "/health", Interval: "1s", Fall: 3},
+			backend: config.ServiceBackend{IPv6: "2001:db8::1", TCP: 8080},
+			result:  &Check{Type: "http", Addr: "[2001:db8::1]:8081", Path: "/health", Interval: 1 * time.Second, Timeout: 100 * time.Millisecond, Rise: 1, Fall: 3},
+		},
+		{
+			check:   config.ServiceCheck{Type: "udp"},
+			backend: config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080},
+			result:  nil,
+		},
+		{
+			check:   config.ServiceCheck{Type: "icmp"},
+			backend: config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080},
+			error:   `Invalid check type: "icmp"`,
+		},
+		{
+			check:   config.ServiceCheck{Type: "tcp", Interval: "soon"},
+			backend: config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080},
+			error:   `Invalid check interval: time: invalid duration "soon"`,
+		},
+	}
+
+	for _, test := range tests {
+		check, err := configCheck(test.check, test.backend, testCheckOptions)
+
+		if err != nil && test.error == "" {
+			t.Errorf("configCheck %#v: error %v", test.check, err)
+		} else if err != nil && err.Error() != test.error {
+			t.Errorf("configCheck %#v: error %v, expected %v", test.check, err, test.error)
+		} else if err == nil && test.error != "" {
+			t.Errorf("configCheck %#v: expected error %v", test.check, test.error)
+		} else if test.result == nil && check != nil {
+			t.Errorf("configCheck %#v: expected nil, got %v", test.check, check)
+		} else if test.result != nil && (check == nil || *check != *test.result) {
+			t.Errorf("configCheck %#v: got %#v, expected %#v", test.check, check, test.result)
+		}
+	}
+}
+
+func TestCheckTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			if conn, err := listener.Accept(); err != nil {
+				return
+			} else {
+				conn.Close()
+			}
+		}
+	}()
+
+	if err := (Check{Type: "tcp", Addr: listener.Addr().String(), Timeout: time.Second}).check(); err != nil {
+		t.Errorf("check tcp up: %v", err)
+	}
+
+	if err := (Check{Type: "tcp", Addr: testCheckClosedAddr(t, "tcp"), Timeout: time.Second}).check(); err == nil {
+		t.Errorf("check tcp down: no error")
+	}
+}
+
+func TestCheckUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	// reply to ping with pong
+	go func() {
+		var buf = make([]byte, 1500)
+
+		for {
+			if n, addr, err := conn.ReadFrom(buf); err != nil {
+				return
+			} else if string(buf[:n]) == "ping" {
+				conn.WriteTo([]byte("pong"), addr)
+			}
+		}
+	}()
+
+	var addr = conn.LocalAddr().String()
+
+	if err := (Check{Type: "udp", Addr: addr, Timeout: 100 * time.Millisecond, Send: "ping", Expect: "pong"}).check(); err != nil {
+		t.Errorf("check udp up: %v", err)
+	}
+
+	if err := (Check{Type: "udp", Addr: addr, Timeout: 100 * time.Millisecond, Send: "quux"}).check(); err != nil {
+		t.Errorf("check udp up without response: %v", err)
+	}
+
+	if err := (Check{Type: "udp", Addr: addr, Timeout: 100 * time.Millisecond, Send: "quux", Expect: "pong"}).check(); err == nil {
+		t.Errorf("check udp down without response: no error")
+	}
+
+	if err := (Check{Type: "udp", Addr: testCheckClosedAddr(t, "udp"), Timeout: 100 * time.Millisecond, Send: "ping"}).check(); err == nil {
+		t.Errorf("check udp down: no error")
+	}
+}
+
+func TestCheckHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/redirect":
+			http.Redirect(w, r, "/health", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var addr = strings.TrimPrefix(server.URL, "http://")
+
+	if err := (Check{Type: "http", Addr: addr, Timeout: time.Second, Path: "/health"}).check(); err != nil {
+		t.Errorf("check http up: %v", err)
+	}
+	if err := (Check{Type: "http", Addr: addr, Timeout: time.Second, Path: "/redirect"}).check(); err != nil {
+		t.Errorf("check http redirect up: %v", err)
+	}
+	if err := (Check{Type: "http", Addr: addr, Timeout: time.Second, Path: "/redirect", Status: 200}).check(); err == nil {
+		t.Errorf("check http redirect with status: no error")
+	}
+	if err := (Check{Type: "http", Addr: addr, Timeout: time.Second, Path: "/"}).check(); err == nil {
+		t.Errorf("check http down: no error")
+	}
+}
+
+func TestChecker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer listener.Close()
+
+	var upPort = listener.Addr().(*net.TCPAddr).Port
+	var downPort = testCheckClosedPort(t, "tcp")
+
+	var testConfig = config.Config{
+		Services: map[string]config.Service{
+			"test": config.Service{
+				Backends: map[string]config.ServiceBackend{
+					"up":   config.ServiceBackend{IPv4: "127.0.0.1", TCP: uint16(upPort)},
+					"down": config.ServiceBackend{IPv4: "127.0.0.1", TCP: uint16(downPort)},
+				},
+				Check: &config.ServiceCheck{Type: "tcp"},
+			},
+		},
+	}
+
+	checker := testCheckOptions.Checker()
+
+	if err := checker.Config(testConfig); err != nil {
+		t.Fatalf("Checker.Config: %v", err)
+	}
+
+	select {
+	case health := <-checker.Listen():
+		if !health.Up("test", "up") {
+			t.Errorf("Checker: test/up is down")
+		}
+		if health.Up("test", "down") {
+			t.Errorf("Checker: test/down is up")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Checker: timeout")
+	}
+
+	// stopping the checks resets the health
+	if err := checker.Config(config.Config{}); err != nil {
+		t.Fatalf("Checker.Config: %v", err)
+	}
+
+	select {
+	case health := <-checker.Listen():
+		if len(health) != 0 {
+			t.Errorf("Checker: unexpected health after stop: %v", health)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Checker: timeout")
+	}
+}
@@ -31,6 +31,40 @@ func printFrontend(frontend config.ServiceFrontend) {
 	if frontend.UDP != 0 {
 		fmt.Printf(" udp=%v", frontend.UDP)
 	}
+	if frontend.SCTP != 0 {
+		fmt.Printf(" sctp=%v", frontend.SCTP)
+	}
+	if frontend.FwMark != 0 {
+		fmt.Printf(" fwmark=%v", frontend.FwMark)
+	}
+	if frontend.Scheduler != "" {
+		fmt.Printf(" scheduler=%v", frontend.Scheduler)
+	}
+	if frontend.Persistence != 0 {
+		fmt.Printf(" persistence=%v", frontend.Persistence)
+	}
+	if frontend.PersistenceEngine != "" {
+		fmt.Printf(" persistence-engine=%v", frontend.PersistenceEngine)
+	}
+	if frontend.Netmask != 0 {
+		fmt.Printf(" netmask=%v", frontend.Netmask)
+	}
+	if frontend.Netmask6 != 0 {
+		fmt.Printf(" netmask6=%v", frontend.Netmask6)
+	}
+	for _, flag := range frontend.Flags {
+		fmt.Printf(" %v", flag)
+	}
+}
+func printCheck(check config.ServiceCheck) {
+	fmt.Printf(" check=%v", check.Type)
+
+	if check.Port != 0 {
+		fmt.Printf(" check-port=%v", check.Port)
+	}
+	if check.Path != "" {
+		fmt.Printf(" check-path=%v", check.Path)
+	}
 }
 func printBackend(backend config.ServiceBackend) {
 	if backend.IPv4 != "" {
@@ -45,6 +79,15 @@ func printBackend(backend config.ServiceBackend) {
 	if backend.UDP != 0 {
 		fmt.Printf(" udp=%v", backend.UDP)
 	}
+	if backend.SCTP != 0 {
+		fmt.Printf(" sctp=%v", backend.SCTP)
+	}
+	if backend.UpperThreshold != 0 {
+		fmt.Printf(" upper-threshold=%v", backend.UpperThreshold)
+	}
+	if backend.LowerThreshold != 0 {
+		fmt.Printf(" lower-threshold=%v", backend.LowerThreshold)
+	}
 }
 
 func outputConfig(config config.Config) {
@@ -59,6 +102,15 @@ func outputConfig(config config.Config) {
 			if route.Gateway != "" {
 				fmt.Printf(" gateway %v", route.Gateway)
 			}
+			if route.IPVSTunnel != "" {
+				fmt.Printf(" tunnel %v", route.IPVSTunnel)
+			}
+			if route.IPVSTunnelPort != 0 {
+				fmt.Printf(" tunnel-port %v", route.IPVSTunnelPort)
+			}
+			for _, flag := range route.IPVSTunnelFlags {
+				fmt.Printf(" %v", flag)
+			}
 			fmt.Printf("\n")
 		}
 
@@ -68,6 +120,9 @@ func outputConfig(config config.Config) {
 			if service.Frontend != nil {
 				printFrontend(*service.Frontend)
 			}
+			if service.Check != nil {
+				printCheck(*service.Check)
+			}
 			fmt.Printf("\n")
 
 			for backendName, backend := range service.Backends {
@@ -76,6 +131,11 @@ func outputConfig(config config.Config) {
 				fmt.Printf("\n")
 			}
 		}
+
+		if timeouts := config.IPVS.Timeouts; timeouts != nil {
+			fmt.Printf("IPVS:\n")
+			fmt.Printf("\ttimeouts: tcp=%v tcp_fin=%v udp=%v\n", timeouts.TCP, timeouts.TCPFin, timeouts.UDP)
+		}
 	}
 }
 
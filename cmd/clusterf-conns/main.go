@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jessevdk/go-flags"
+	"github.com/qmsk/clusterf"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"log"
+	"strings"
+)
+
+var Options struct {
+	ConfigReader config.ReaderOptions `group:"Config Reader"`
+	IPVS         clusterf.IPVSOptions `group:"IPVS"`
+
+	ConnsPath string `long:"conns-path" value-name:"PATH" default:"/proc/net/ip_vs_conn" description:"Read the kernel IPVS connection table"`
+	Service   string `long:"service" value-name:"NAME" description:"Only list connections for the given config service"`
+	Backend   string `long:"backend" value-name:"NAME" description:"Only list connections for the given config backend"`
+	Templates bool   `long:"templates" description:"Also list persistence templates"`
+}
+
+var flagsParser = flags.NewParser(&Options, flags.Default)
+
+func printConn(conn ipvs.Conn, serviceName string, backendNames []string) {
+	var connType = "conn"
+
+	if conn.Template {
+		connType = "template"
+	}
+
+	fmt.Printf("%-8s %-12s %7v %-30s %v", connType, conn.State, conn.Expires, serviceName, strings.Join(backendNames, ","))
+	fmt.Printf("\t%v", conn)
+
+	if conn.PEName != "" {
+		fmt.Printf(" %s=%s", conn.PEName, conn.PEData)
+	}
+
+	fmt.Printf("\n")
+}
+
+func main() {
+	if args, err := flagsParser.Parse(); err != nil {
+		log.Fatalf("flags.Parser.Parse: %v\n", err)
+	} else if len(args) > 0 {
+		log.Fatalf("Extra arguments: %v\n", args)
+	}
+
+	configReader, err := Options.ConfigReader.Reader()
+	if err != nil {
+		log.Fatalf("config.Reader: %v\n", err)
+	}
+
+	connNames, err := Options.IPVS.ConnNames(configReader.Get())
+	if err != nil {
+		log.Fatalf("IPVSOptions.ConnNames: %v\n", err)
+	}
+
+	conns, err := ipvs.ReadConns(Options.ConnsPath)
+	if err != nil {
+		log.Fatalf("ipvs.ReadConns %v: %v\n", Options.ConnsPath, err)
+	}
+
+	for _, conn := range conns {
+		if conn.Template && !Options.Templates {
+			continue
+		} else if !connNames.Match(conn, Options.Service, Options.Backend) {
+			continue
+		}
+
+		serviceName, backendNames := connNames.Lookup(conn)
+
+		printConn(conn, serviceName, backendNames)
+	}
+}
@@ -31,8 +31,10 @@ func configContainer(updateConfig *config.Config, container *dockerclient.Contai
 		}{
 			{"tcp", "net.qmsk.clusterf.backend.tcp"},
 			{"udp", "net.qmsk.clusterf.backend.udp"},
+			{"sctp", "net.qmsk.clusterf.backend.sctp"},
 			{"tcp", fmt.Sprintf("net.qmsk.clusterf.backend:%s.tcp", serviceName)},
 			{"udp", fmt.Sprintf("net.qmsk.clusterf.backend:%s.udp", serviceName)},
+			{"sctp", fmt.Sprintf("net.qmsk.clusterf.backend:%s.sctp", serviceName)},
 		}
 
 		for _, portLabel := range portLabels {
@@ -65,6 +67,8 @@ func configContainer(updateConfig *config.Config, container *dockerclient.Contai
 				backend.TCP = port
 			case "udp":
 				backend.UDP = port
+			case "sctp":
+				backend.SCTP = port
 			}
 
 			// state
@@ -75,11 +79,30 @@ func configContainer(updateConfig *config.Config, container *dockerclient.Contai
 			}
 		}
 
+		// find optional thresholds by label
+		thresholdLabels := []struct {
+			value *uint
+			label string
+		}{
+			{&backend.UpperThreshold, "net.qmsk.clusterf.backend.upper_threshold"},
+			{&backend.LowerThreshold, "net.qmsk.clusterf.backend.lower_threshold"},
+			{&backend.UpperThreshold, fmt.Sprintf("net.qmsk.clusterf.backend:%s.upper_threshold", serviceName)},
+			{&backend.LowerThreshold, fmt.Sprintf("net.qmsk.clusterf.backend:%s.lower_threshold", serviceName)},
+		}
+
+		for _, thresholdLabel := range thresholdLabels {
+			if value, labelFound := labels[thresholdLabel.label]; !labelFound {
+				continue
+			} else if _, err := fmt.Sscanf(value, "%d", thresholdLabel.value); err != nil {
+				log.Printf("configContainer %v: service %v %v invalid: %#v", container.ID, serviceName, thresholdLabel.label, value)
+			}
+		}
+
 		if backend.IPv4 == "" && backend.IPv6 == "" {
 			continue
 		}
 
-		if backend.TCP == 0 && backend.UDP == 0 {
+		if backend.TCP == 0 && backend.UDP == 0 && backend.SCTP == 0 {
 			continue
 		}
 
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/jessevdk/go-flags"
+	"github.com/qmsk/clusterf"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"io"
+	"log"
+	"os"
+)
+
+var Options struct {
+	config.SourceOptions
+	IPVS clusterf.IPVSOptions `group:"IPVS"`
+
+	SourceURL string `long:"config-source" value-name:"(file|etcd|etcd+http|etcd+https)://[<host>]/<path>" description:"Write the imported config to the given source"`
+	JSON      bool   `long:"json" description:"Output the imported config as JSON"`
+
+	Args struct {
+		SaveFile string `positional-arg-name:"FILE" description:"Read the ipvsadm-save dump from file, or stdin"`
+	} `positional-args:"yes"`
+}
+
+var flagsParser = flags.NewParser(&Options, flags.Default)
+
+func main() {
+	if _, err := flagsParser.Parse(); err != nil {
+		log.Fatalf("flags.Parser.Parse: %v\n", err)
+	}
+
+	var reader io.Reader = os.Stdin
+
+	if Options.Args.SaveFile != "" {
+		if file, err := os.Open(Options.Args.SaveFile); err != nil {
+			log.Fatalf("os.Open %v: %v\n", Options.Args.SaveFile, err)
+		} else {
+			defer file.Close()
+
+			reader = file
+		}
+	}
+
+	saveServices, err := ipvs.ParseSave(reader)
+	if err != nil {
+		log.Fatalf("ipvs.ParseSave: %v\n", err)
+	}
+
+	importConfig, err := clusterf.ImportSave(saveServices, Options.IPVS)
+	if err != nil {
+		log.Fatalf("clusterf.ImportSave: %v\n", err)
+	}
+
+	if Options.JSON {
+		if err := json.NewEncoder(os.Stdout).Encode(importConfig); err != nil {
+			log.Fatalf("json.Encode: %v\n", err)
+		}
+	}
+
+	if Options.SourceURL != "" {
+		if err := Options.SourceOptions.Import(Options.SourceURL, importConfig); err != nil {
+			log.Fatalf("config.Import %v: %v\n", Options.SourceURL, err)
+		}
+
+		log.Printf("Imported %d services and %d routes into %v\n", len(importConfig.Services), len(importConfig.Routes), Options.SourceURL)
+	}
+}
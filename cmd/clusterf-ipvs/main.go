@@ -1,22 +1,270 @@
 package main
 
 import (
+	"fmt"
 	"github.com/jessevdk/go-flags"
 	"github.com/qmsk/clusterf"
 	"github.com/qmsk/clusterf/config"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var Options struct {
-	ConfigReader config.ReaderOptions `group:"Config Reader"`
-	IPVS         clusterf.IPVSOptions `group:"IPVS"`
+	ConfigReader config.ReaderOptions     `group:"Config Reader"`
+	IPVS         clusterf.IPVSOptions     `group:"IPVS"`
+	Check        clusterf.CheckOptions    `group:"Health Checks"`
+	Announce     clusterf.AnnounceOptions `group:"Announce"`
 
-	Flush bool `long:"flush" help:"Flush all IPVS services before applying configuration"`
+	Preflight        bool                      `long:"check" description:"Check the kernel modules and sysctls required by the config, and exit"`
+	PreflightOptions clusterf.PreflightOptions `group:"Preflight"`
+
+	Plan string `long:"plan" optional:"yes" optional-value:"text" choice:"text" choice:"json" description:"Output the IPVS operations required to apply the config as text or JSON, and exit without applying them"`
+
+	Flush bool `long:"flush" help:"Flush all IPVS services before applying configuration, or only the managed services with --ipvs-scope-* or --ipvs-state"`
 	Print bool `long:"print" help:"Output all IPVS rules after applying configuration"`
+	Save  bool `long:"save" help:"Output all IPVS rules in the ipvsadm-save format after applying configuration"`
+
+	MetricsListen string `long:"metrics-listen" value-name:"[HOST]:PORT" description:"Serve IPVS stats as Prometheus metrics on http://.../metrics"`
 }
 
 var flagsParser = flags.NewParser(&Options, flags.Default)
 
+// Log any failed IPVS updates, which are retried.
+//
+// Returns any other error.
+func logUpdateErrors(method string, err error) error {
+	if updateErrors, ok := err.(clusterf.UpdateErrors); !ok {
+		return err
+	} else {
+		for _, updateError := range updateErrors {
+			log.Printf("%s: %v\n", method, updateError)
+		}
+
+		return nil
+	}
+}
+
+// Output the IPVS rules for --print or --save
+func output(ipvsDriver *clusterf.IPVSDriver) {
+	if Options.Print {
+		ipvsDriver.Print()
+	}
+
+	if Options.Save {
+		if err := ipvsDriver.Save(os.Stdout); err != nil {
+			log.Printf("IPVSDriver.Save: %v\n", err)
+		}
+	}
+}
+
+// Check the kernel prerequisites for the config, exiting with a non-zero status on any failures other than warnings
+func preflight(config config.Config) {
+	var failed = false
+
+	failures, err := Options.PreflightOptions.Preflight(Options.IPVS, config)
+	if err != nil {
+		log.Fatalf("PreflightOptions.Preflight: %v\n", err)
+	}
+
+	for _, failure := range failures {
+		if failure.Warning {
+			fmt.Printf("WARN %v\n", failure)
+		} else {
+			fmt.Printf("FAIL %v\n", failure)
+
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+
+	fmt.Printf("OK\n")
+}
+
+// Output the plan for each driver, exiting with a non-zero status if any operations would conflict with unmanaged services
+func plan(ipvsDrivers []*clusterf.IPVSDriver, config config.Config) {
+	var failed = false
+
+	for _, ipvsDriver := range ipvsDrivers {
+		ipvsPlan, err := ipvsDriver.Plan(config)
+		if err != nil {
+			log.Fatalf("IPVSDriver.Plan: %v\n", err)
+		}
+
+		switch Options.Plan {
+		case "json":
+			err = ipvsPlan.WriteJSON(os.Stdout)
+		default:
+			err = ipvsPlan.WriteText(os.Stdout)
+		}
+
+		if err != nil {
+			log.Fatalf("Plan.Write: %v\n", err)
+		}
+
+		if len(ipvsPlan.Errors) > 0 {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Announce the VIPs for all drivers
+func announce(announcer *clusterf.Announcer, ipvsDrivers []*clusterf.IPVSDriver) {
+	var vips []net.IP
+
+	if announcer == nil {
+		return
+	}
+
+	for _, ipvsDriver := range ipvsDrivers {
+		vips = append(vips, ipvsDriver.VIPs(Options.Announce.RequireBackends)...)
+	}
+
+	if err := announcer.Announce(vips); err != nil {
+		log.Printf("Announcer.Announce: %v\n", err)
+	}
+}
+
+// Apply config and health updates to each driver, until the config reader closes, or on SIGINT/SIGTERM.
+//
+// Retries any failed IPVS updates with backoff.
+//
+// Zeroes the IPVS stats on SIGUSR1.
+//
+// Returns an error on any other IPVS update failures, or if the --metrics-listen server fails.
+func run(ipvsDrivers []*clusterf.IPVSDriver, configChan chan config.Config, httpChan chan error, checker *clusterf.Checker, announcer *clusterf.Announcer) error {
+	healthChan := checker.Listen()
+	signalChan := make(chan os.Signal, 1)
+	stopChan := make(chan os.Signal, 1)
+
+	signal.Notify(signalChan, syscall.SIGUSR1)
+	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+
+	var drainChan <-chan time.Time
+
+	if Options.IPVS.DrainTimeout > 0 {
+		drainTicker := time.NewTicker(Options.IPVS.DrainInterval)
+		defer drainTicker.Stop()
+
+		drainChan = drainTicker.C
+	}
+
+	var reconcileChan <-chan time.Time
+
+	if Options.IPVS.ReconcileInterval > 0 {
+		reconcileTicker := time.NewTicker(Options.IPVS.ReconcileInterval)
+		defer reconcileTicker.Stop()
+
+		reconcileChan = reconcileTicker.C
+	}
+
+	// retry the driver with the shortest backoff first
+	var retryChan <-chan time.Time
+	var retryDriver *clusterf.IPVSDriver
+
+	for {
+		if retryChan == nil {
+			var retryBackoff time.Duration
+
+			for _, ipvsDriver := range ipvsDrivers {
+				if backoff := ipvsDriver.RetryBackoff(); backoff == 0 {
+
+				} else if retryBackoff == 0 || backoff < retryBackoff {
+					retryBackoff = backoff
+					retryDriver = ipvsDriver
+				}
+			}
+
+			if retryBackoff > 0 {
+				retryChan = time.After(retryBackoff)
+			}
+		}
+
+		select {
+		case config, ok := <-configChan:
+			if !ok {
+				log.Printf("Config closed\n")
+				return nil
+			}
+
+			if err := checker.Config(config); err != nil {
+				log.Printf("Checker.Config: %v\n", err)
+			}
+
+			for _, ipvsDriver := range ipvsDrivers {
+				if err := logUpdateErrors("IPVSDriver.Config", ipvsDriver.Config(config)); err != nil {
+					return fmt.Errorf("IPVSDriver.Config: %v\n\tconfig=%#v", err, config)
+				}
+			}
+
+		case health := <-healthChan:
+			for _, ipvsDriver := range ipvsDrivers {
+				if err := logUpdateErrors("IPVSDriver.Health", ipvsDriver.Health(health)); err != nil {
+					return fmt.Errorf("IPVSDriver.Health: %v", err)
+				}
+			}
+
+		case sig := <-stopChan:
+			log.Printf("Stop on %v\n", sig)
+			return nil
+
+		case err := <-httpChan:
+			return fmt.Errorf("http.ListenAndServe %v: %v", Options.MetricsListen, err)
+
+		case <-signalChan:
+			for _, ipvsDriver := range ipvsDrivers {
+				if err := ipvsDriver.Zero(); err != nil {
+					log.Printf("IPVSDriver.Zero: %v\n", err)
+				}
+			}
+
+			continue
+
+		case <-drainChan:
+			for _, ipvsDriver := range ipvsDrivers {
+				if err := logUpdateErrors("IPVSDriver.Drain", ipvsDriver.Drain()); err != nil {
+					log.Printf("IPVSDriver.Drain: %v\n", err)
+				}
+			}
+
+			continue
+
+		case <-reconcileChan:
+			for _, ipvsDriver := range ipvsDrivers {
+				if err := logUpdateErrors("IPVSDriver.Reconcile", ipvsDriver.Reconcile()); err != nil {
+					log.Printf("IPVSDriver.Reconcile: %v\n", err)
+				}
+			}
+
+			continue
+
+		case <-retryChan:
+			retryChan = nil
+
+			if err := logUpdateErrors("IPVSDriver.Retry", retryDriver.Retry()); err != nil {
+				log.Printf("IPVSDriver.Retry: %v\n", err)
+			}
+		}
+
+		for _, ipvsDriver := range ipvsDrivers {
+			output(ipvsDriver)
+		}
+
+		announce(announcer, ipvsDrivers)
+	}
+}
+
 func main() {
 	if args, err := flagsParser.Parse(); err != nil {
 		log.Fatalf("flags.Parser.Parse: %v\n", err)
@@ -29,38 +277,92 @@ func main() {
 		log.Fatalf("config.Reader: %v\n", err)
 	}
 
+	if Options.Preflight {
+		preflight(configReader.Get())
+		return
+	}
+
+	if Options.Plan == "" {
+
+	} else if Options.Flush {
+		log.Fatalf("--plan cannot be used with --flush\n")
+	} else {
+		// never write to the kernel IPVS state
+		Options.IPVS.Noop = true
+	}
+
 	// setup
-	ipvsDriver, err := Options.IPVS.Open()
+	instanceOptions, err := Options.IPVS.InstanceOptions()
 	if err != nil {
-		log.Fatalf("IPVSOptions.Open: %v\n", err)
+		log.Fatalf("IPVSOptions.InstanceOptions: %v\n", err)
 	}
 
-	// sync
-	if Options.Flush {
-		if err := ipvsDriver.Flush(); err != nil {
-			log.Fatalf("IPVSDriver.Flush: %v\n", err)
+	var ipvsDrivers []*clusterf.IPVSDriver
+
+	for _, ipvsOptions := range instanceOptions {
+		ipvsDriver, err := ipvsOptions.Open()
+		if err != nil {
+			log.Fatalf("IPVSOptions.Open %v: %v\n", ipvsOptions.Netns, err)
 		}
-	} else {
-		if err := ipvsDriver.Sync(); err != nil {
-			log.Fatalf("IPVSDriver.Sync: %v\n", err)
+
+		// sync
+		if Options.Flush {
+			if err := ipvsDriver.Flush(); err != nil {
+				log.Fatalf("IPVSDriver.Flush: %v\n", err)
+			}
+		} else {
+			if err := ipvsDriver.Sync(); err != nil {
+				log.Fatalf("IPVSDriver.Sync: %v\n", err)
+			}
 		}
+
+		output(ipvsDriver)
+
+		if Options.MetricsListen == "" {
+
+		} else if ipvsOptions.Netns == "" {
+			http.Handle("/metrics", ipvsDriver)
+		} else {
+			http.Handle("/metrics/"+ipvsOptions.InstanceName(), ipvsDriver)
+		}
+
+		ipvsDrivers = append(ipvsDrivers, ipvsDriver)
 	}
 
-	if Options.Print {
-		ipvsDriver.Print()
+	if Options.Plan != "" {
+		plan(ipvsDrivers, configReader.Get())
+		return
+	}
+
+	var httpChan chan error
+
+	if Options.MetricsListen != "" {
+		httpChan = make(chan error, 1)
+
+		go func() {
+			httpChan <- http.ListenAndServe(Options.MetricsListen, nil)
+		}()
+	}
+
+	announcer, err := Options.Announce.Announcer()
+	if err != nil {
+		log.Fatalf("AnnounceOptions.Announcer: %v\n", err)
 	}
 
 	// configure
 	log.Printf("Configure...\n")
 
-	for config := range configReader.Listen() {
-		if err := ipvsDriver.Config(config); err != nil {
-			log.Fatalf("IPVSDriver.Config: %v\n\tconfig=%#v\n", err, config)
-		}
+	err = run(ipvsDrivers, configReader.Listen(), httpChan, Options.Check.Checker(), announcer)
 
-		if Options.Print {
-			ipvsDriver.Print()
-		}
+	// stop attracting traffic, leaving the IPVS services as-is for a soft restart
+	if announcer == nil {
+
+	} else if err := announcer.Withdraw(); err != nil {
+		log.Printf("Announcer.Withdraw: %v\n", err)
+	}
+
+	if err != nil {
+		log.Fatalf("%v\n", err)
 	}
 
 	log.Printf("Exit\n")
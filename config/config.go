@@ -30,6 +30,25 @@ type ServiceFrontend struct {
 	IPv6 string `json:"ipv6,omitempty"`
 	TCP  uint16 `json:"tcp,omitempty"`
 	UDP  uint16 `json:"udp,omitempty"`
+	SCTP uint16 `json:"sctp,omitempty"`
+
+	// firewall mark, configured for each address family of the backends, independently of any ipv4/ipv6 tcp/udp
+	FwMark uint32 `json:"fwmark,omitempty"`
+
+	// IPVS scheduler, default given by clusterf-ipvs
+	Scheduler string `json:"scheduler,omitempty"`
+
+	// Persistence timeout in seconds, for clients within the same netmask prefix length.
+	// The IPv4 netmask also applies to IPv6-only frontends without any netmask6.
+	Persistence uint32 `json:"persistence,omitempty"`
+	Netmask     uint   `json:"netmask,omitempty"`
+	Netmask6    uint   `json:"netmask6,omitempty"`
+
+	// Persistence engine for persistent services: sip
+	PersistenceEngine string `json:"persistence_engine,omitempty"`
+
+	// one-packet sh-fallback sh-port
+	Flags []string `json:"flags,omitempty"`
 }
 
 type ServiceBackend struct {
@@ -39,17 +58,50 @@ type ServiceBackend struct {
 	IPv6 string `json:"ipv6,omitempty"`
 	TCP  uint16 `json:"tcp,omitempty"`
 	UDP  uint16 `json:"udp,omitempty"`
+	SCTP uint16 `json:"sctp,omitempty"`
 
 	Weight uint `json:"weight"` // default: 10
+
+	// Connection thresholds, default 0 is unlimited
+	UpperThreshold uint `json:"upper_threshold,omitempty"`
+	LowerThreshold uint `json:"lower_threshold,omitempty"`
 }
 
 const ServiceBackendWeight uint = 10
 
+// Health check applied to each of the service backends
+type ServiceCheck struct {
+	Meta `json:"-"`
+
+	// tcp udp http
+	Type string `json:"type"`
+
+	// Check a different port than the backend's tcp/udp port
+	Port uint16 `json:"port,omitempty"`
+
+	// Durations, e.g. "5s". Defaults given by clusterf-ipvs
+	Interval string `json:"interval,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+
+	// Number of consecutive successes/failures to change backend state
+	Rise uint `json:"rise,omitempty"`
+	Fall uint `json:"fall,omitempty"`
+
+	// udp: payload to send, and optional response prefix to expect
+	Send   string `json:"send,omitempty"`
+	Expect string `json:"expect,omitempty"`
+
+	// http: GET path, and the expected response status, default 2xx/3xx
+	Path   string `json:"path,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
 type Service struct {
 	Meta `json:"-"`
 
 	Frontend *ServiceFrontend
 	Backends map[string]ServiceBackend
+	Check    *ServiceCheck
 }
 
 func (service *Service) setBackend(backendName string, serviceBackend ServiceBackend) {
@@ -66,6 +118,10 @@ func (service *Service) merge(other Service) {
 		service.Frontend = other.Frontend
 	}
 
+	if other.Check != nil {
+		service.Check = other.Check
+	}
+
 	// backends
 	if service.Backends == nil {
 		service.Backends = make(map[string]ServiceBackend)
@@ -90,12 +146,39 @@ type Route struct {
 	//  droute tunnel masq
 	// Filter out backend if set to empty string.
 	IPVSMethod string `json:",omitempty"`
+
+	// Configure IPVS tunnel encapsulation for tunnel destinations:
+	//  ipip gue gre
+	IPVSTunnel string `json:",omitempty"`
+
+	// Destination UDP port for gue tunnels
+	IPVSTunnelPort uint16 `json:",omitempty"`
+
+	// Tunnel checksum flags for gue/gre tunnels:
+	//  csum remcsum
+	IPVSTunnelFlags []string `json:",omitempty"`
+}
+
+// IPVS connection timeouts in seconds.
+// Zero values leave the kernel timeout as-is
+type IPVSTimeouts struct {
+	Meta `json:"-"`
+
+	TCP    uint32 `json:"tcp,omitempty"`
+	TCPFin uint32 `json:"tcp_fin,omitempty"`
+	UDP    uint32 `json:"udp,omitempty"`
+}
+
+// Cluster-wide IPVS settings
+type IPVS struct {
+	Timeouts *IPVSTimeouts
 }
 
 // Top-level config object
 type Config struct {
 	Routes   map[string]Route
 	Services map[string]Service
+	IPVS     IPVS
 }
 
 func (config *Config) setService(serviceName string, service Service) {
@@ -140,6 +223,20 @@ func (config *Config) updateServiceFrontend(node Node, serviceName string, servi
 	return nil
 }
 
+func (config *Config) updateServiceCheck(node Node, serviceName string, serviceCheck ServiceCheck) error {
+	service := config.Services[serviceName]
+
+	if node.Remove {
+		service.Check = nil
+	} else {
+		service.Check = &serviceCheck
+	}
+
+	config.setService(serviceName, service)
+
+	return nil
+}
+
 func (config *Config) updateServiceBackends(node Node, serviceName string) error {
 	service := config.Services[serviceName]
 
@@ -189,6 +286,24 @@ func (config *Config) updateRoute(node Node, routeName string, route Route) erro
 	return nil
 }
 
+func (config *Config) updateIPVS(node Node) error {
+	if node.Remove {
+		config.IPVS = IPVS{}
+	}
+
+	return nil
+}
+
+func (config *Config) updateIPVSTimeouts(node Node, timeouts IPVSTimeouts) error {
+	if node.Remove {
+		config.IPVS.Timeouts = nil
+	} else {
+		config.IPVS.Timeouts = &timeouts
+	}
+
+	return nil
+}
+
 // Update config from Node.
 //
 // This modifieds the Config in-place, and is not safe against any concurrent usage.
@@ -226,6 +341,17 @@ func (config *Config) update(node Node) error {
 
 			return config.updateServiceFrontend(node, serviceName, serviceFrontend)
 
+		} else if len(nodePath) == 3 && nodePath[2] == "check" && !node.IsDir {
+			var serviceCheck = ServiceCheck{
+				Meta: Meta{node: node},
+			}
+
+			if err := node.unmarshal(&serviceCheck); err != nil {
+				return fmt.Errorf("service %s check: %s", serviceName, err)
+			}
+
+			return config.updateServiceCheck(node, serviceName, serviceCheck)
+
 		} else if len(nodePath) == 3 && nodePath[2] == "backends" && node.IsDir {
 			// recursive on all backends
 			return config.updateServiceBackends(node, serviceName)
@@ -273,6 +399,21 @@ func (config *Config) update(node Node) error {
 		} else {
 			return fmt.Errorf("Ignore unknown route node")
 		}
+
+	} else if len(nodePath) == 1 && nodePath[0] == "ipvs" && node.IsDir {
+		return config.updateIPVS(node)
+
+	} else if len(nodePath) == 2 && nodePath[0] == "ipvs" && nodePath[1] == "timeouts" && !node.IsDir {
+		var timeouts = IPVSTimeouts{
+			Meta: Meta{node: node},
+		}
+
+		if err := node.unmarshal(&timeouts); err != nil {
+			return fmt.Errorf("ipvs timeouts: %s", err)
+		}
+
+		return config.updateIPVSTimeouts(node, timeouts)
+
 	} else {
 		return fmt.Errorf("Ignore unknown node")
 	}
@@ -304,12 +445,20 @@ func (config Config) walk(visit func(node Node)) (err error) {
 				visit(makeNode(service.Frontend, "services", serviceName, "frontend"))
 			}
 
+			if service.Check != nil {
+				visit(makeNode(service.Check, "services", serviceName, "check"))
+			}
+
 			for backendName, backend := range service.Backends {
 				visit(makeNode(backend, "services", serviceName, "backends", backendName))
 			}
 		}
 	}
 
+	if config.IPVS.Timeouts != nil {
+		visit(makeNode(config.IPVS.Timeouts, "ipvs", "timeouts"))
+	}
+
 	return
 }
 
@@ -346,4 +495,8 @@ func (config *Config) merge(mergeConfig Config) {
 			config.Routes[routeName] = route
 		}
 	}
+
+	if mergeConfig.IPVS.Timeouts != nil {
+		config.IPVS.Timeouts = mergeConfig.IPVS.Timeouts
+	}
 }
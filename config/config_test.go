@@ -103,6 +103,12 @@ var testConfigUpdate = []struct {
 		},
 		error: "service test backend test2: invalid character 'o' in literal null (expecting 'u')",
 	},
+	{
+		nodes: []Node{
+			Node{Path: "services/test/check", Value: "not json"},
+		},
+		error: "service test check: invalid character 'o' in literal null (expecting 'u')",
+	},
 	{
 		nodes: []Node{
 			Node{Path: "routes/test", Value: "not json"},
@@ -130,6 +136,76 @@ var testConfigUpdate = []struct {
 		config: testConfig,
 	},
 
+	{
+		initConfig: testConfig,
+		nodes: []Node{
+			Node{Path: "services/test/check", Value: `{"type":"http","path":"/health","interval":"1s","fall":2}`},
+		},
+		config: Config{
+			Services: map[string]Service{
+				"test": Service{
+					Frontend: &ServiceFrontend{
+						IPv4: "127.0.0.1",
+						TCP:  8080,
+					},
+					Backends: map[string]ServiceBackend{
+						"test1": ServiceBackend{
+							IPv4:   "127.0.0.1",
+							TCP:    8081,
+							Weight: 10,
+						},
+						"test2": ServiceBackend{
+							IPv4:   "127.0.0.1",
+							TCP:    8082,
+							Weight: 10,
+						},
+					},
+					Check: &ServiceCheck{
+						Type:     "http",
+						Path:     "/health",
+						Interval: "1s",
+						Fall:     2,
+					},
+				},
+				"test6": Service{
+					Frontend: &ServiceFrontend{
+						IPv6: "2001:db8::1",
+						TCP:  8080,
+					},
+				},
+			},
+		},
+	},
+	{
+		initConfig: Config{
+			Services: map[string]Service{
+				"test6": Service{
+					Frontend: &ServiceFrontend{
+						IPv6: "2001:db8::1",
+						TCP:  8080,
+					},
+					Check: &ServiceCheck{
+						Type: "tcp",
+					},
+				},
+			},
+		},
+		nodes: []Node{
+			Node{Path: "services/test6/check", Remove: true},
+		},
+		config: Config{
+			Services: map[string]Service{
+				"test6": Service{
+					Frontend: &ServiceFrontend{
+						IPv6: "2001:db8::1",
+						TCP:  8080,
+					},
+					Backends: map[string]ServiceBackend{},
+				},
+			},
+		},
+	},
+
 	{
 		nodes: []Node{
 			Node{Path: "routes", IsDir: true},
@@ -290,6 +366,41 @@ var testConfigUpdate = []struct {
 			Services: map[string]Service{},
 		},
 	},
+
+	{
+		nodes: []Node{
+			Node{Path: "ipvs", IsDir: true},
+			Node{Path: "ipvs/timeouts", Value: `{"tcp":900,"tcp_fin":120,"udp":300}`},
+		},
+		config: Config{
+			IPVS: IPVS{
+				Timeouts: &IPVSTimeouts{TCP: 900, TCPFin: 120, UDP: 300},
+			},
+		},
+	},
+	{
+		nodes: []Node{
+			Node{Path: "ipvs/timeouts", Value: `{"tcp":"15m"}`},
+		},
+		error: "ipvs timeouts: json: cannot unmarshal string into Go struct field IPVSTimeouts.tcp of type uint32",
+	},
+	{
+		nodes: []Node{
+			Node{Path: "ipvs/wtf", Value: `{}`},
+		},
+		error: "Ignore unknown node",
+	},
+	{
+		initConfig: Config{
+			IPVS: IPVS{
+				Timeouts: &IPVSTimeouts{TCP: 900},
+			},
+		},
+		nodes: []Node{
+			Node{Path: "ipvs", IsDir: true, Remove: true},
+		},
+		config: Config{},
+	},
 }
 
 func TestConfigUpdate(t *testing.T) {
@@ -360,6 +471,18 @@ var testConfigCompile = []struct {
 			Node{Path: "services/test6/frontend", Value: `{"ipv6":"2001:db8::1","tcp":8080}`},
 		}),
 	},
+	{
+		config: Config{
+			Services: map[string]Service{
+				"test": Service{
+					Check: &ServiceCheck{Type: "udp", Port: 53, Send: "ping", Expect: "pong"},
+				},
+			},
+		},
+		nodes: makeNodeMap([]Node{
+			Node{Path: "services/test/check", Value: `{"type":"udp","port":53,"send":"ping","expect":"pong"}`},
+		}),
+	},
 	{
 		config: Config{
 			Routes: map[string]Route{
@@ -375,6 +498,16 @@ var testConfigCompile = []struct {
 			Node{Path: "routes/test1", Value: `{"Prefix":"10.0.1.0/24","IPVSMethod":"droute"}`},
 		}),
 	},
+	{
+		config: Config{
+			IPVS: IPVS{
+				Timeouts: &IPVSTimeouts{TCP: 900, UDP: 300},
+			},
+		},
+		nodes: makeNodeMap([]Node{
+			Node{Path: "ipvs/timeouts", Value: `{"tcp":900,"udp":300}`},
+		}),
+	},
 }
 
 func TestConfigCompile(t *testing.T) {
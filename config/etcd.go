@@ -284,6 +284,21 @@ func (etcd *EtcdSource) set(node Node) error {
 	}
 }
 
+// Persistently write nodes, without any TTL
+func (etcd *EtcdSource) Import(nodes map[string]Node) error {
+	for _, node := range nodes {
+		var opts = client.SetOptions{
+			Dir: node.IsDir,
+		}
+
+		if _, err := etcd.keysAPI.Set(context.Background(), etcd.path(node.Path), node.Value, &opts); err != nil {
+			return fmt.Errorf("config:EtcdSource %v: Import %v: %v", etcd, node, fixupClusterError(err))
+		}
+	}
+
+	return nil
+}
+
 func (etcd *EtcdSource) remove(node Node) error {
 	var opts = client.DeleteOptions{
 		Dir: node.IsDir,
@@ -83,3 +83,22 @@ func (fs *FileSource) Scan() (nodes []Node, err error) {
 
 	return
 }
+
+// Write nodes as files under the path, creating any directories
+func (fs *FileSource) Import(nodes map[string]Node) error {
+	for _, node := range nodes {
+		path := filepath.Join(fs.options.Path, filepath.FromSlash(node.Path))
+
+		if node.IsDir {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		} else if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		} else if err := ioutil.WriteFile(path, []byte(node.Value+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
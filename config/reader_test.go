@@ -2,7 +2,9 @@ package config
 
 import (
 	"github.com/kylelemons/godebug/pretty"
+	"io/ioutil"
 	"math/rand"
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -81,6 +83,32 @@ func TestReaderFiles(t *testing.T) {
 	}
 }
 
+func TestImportFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clusterf-config")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := (SourceOptions{}).Import("file://"+dir, testFilesConfig); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	reader, err := ReaderOptions{SourceURLs: []string{"file://" + dir}}.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+
+	prettyConfig := pretty.Config{
+		// omit Meta node
+		IncludeUnexported: false,
+	}
+
+	if diff := prettyConfig.Compare(testFilesConfig, reader.Get()); diff != "" {
+		t.Errorf("reader config:\n%s", diff)
+	}
+}
+
 type testReaderSource struct {
 	name      string
 	scanNodes []Node
@@ -58,3 +58,10 @@ type writeSource interface {
 	// Remove any written nodes
 	Flush() error
 }
+
+type importSource interface {
+	Source
+
+	// Persistently write the nodes, without any TTL, retaining any other existing nodes
+	Import(nodes map[string]Node) error
+}
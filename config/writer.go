@@ -21,6 +21,19 @@ func (options WriterOptions) Writer() (*Writer, error) {
 	return &writer, nil
 }
 
+// Persistently write the config to the given source, retaining any other existing config
+func (options SourceOptions) Import(sourceURL string, config Config) error {
+	if source, err := options.openURL(sourceURL); err != nil {
+		return err
+	} else if importSource, ok := source.(importSource); !ok {
+		return fmt.Errorf("Config source does not support import: %v", source)
+	} else if nodes, err := config.compile(); err != nil {
+		return err
+	} else {
+		return importSource.Import(nodes)
+	}
+}
+
 type Writer struct {
 	options WriterOptions
 	source  writeSource
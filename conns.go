@@ -0,0 +1,97 @@
+package clusterf
+
+import (
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+)
+
+// Map kernel IPVS connections back to the config service and backend names
+type ConnNames struct {
+	services Services
+}
+
+func (options IPVSOptions) ConnNames(config config.Config) (*ConnNames, error) {
+	routes, err := configRoutes(config.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := configServices(config.Services, routes, nil, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnNames{services: services}, nil
+}
+
+// Lookup the config service for the connection.
+//
+// Connections for fwmark services are matched using their dest address.
+func (connNames *ConnNames) lookupService(conn ipvs.Conn) (Service, bool) {
+	if service, exists := connNames.services[conn.Service().String()]; exists {
+		return service, true
+	}
+
+	for _, service := range connNames.services {
+		if service.FwMark == 0 || service.Af != conn.Af {
+			continue
+		} else if _, exists := service.lookupDest(conn); exists {
+			return service, true
+		}
+	}
+
+	return Service{}, false
+}
+
+// Lookup the service dest for the connection, ignoring the port for fwmark dests
+func (service Service) lookupDest(conn ipvs.Conn) (Dest, bool) {
+	for _, dest := range service.dests {
+		if !dest.Addr.Equal(conn.DestAddr) {
+			continue
+		} else if dest.Port != 0 && dest.Port != conn.DestPort {
+			continue
+		}
+
+		return dest, true
+	}
+
+	return Dest{}, false
+}
+
+// Lookup the config service and backend names for the connection.
+//
+// Returns an empty service name if the connection does not match any configured service,
+// and multiple backend names for merged backends.
+func (connNames *ConnNames) Lookup(conn ipvs.Conn) (serviceName string, backendNames []string) {
+	service, exists := connNames.lookupService(conn)
+	if !exists {
+		return "", nil
+	}
+
+	if dest, exists := service.lookupDest(conn); exists {
+		return service.name, dest.backends
+	}
+
+	return service.name, nil
+}
+
+// Match the connection against the given config service and backend names, which may be empty to match any
+func (connNames *ConnNames) Match(conn ipvs.Conn, serviceName string, backendName string) bool {
+	connService, connBackends := connNames.Lookup(conn)
+
+	if serviceName != "" && serviceName != connService {
+		return false
+	}
+
+	if backendName == "" {
+		return true
+	}
+
+	for _, connBackend := range connBackends {
+		if connBackend == backendName {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package clusterf
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"strings"
+	"testing"
+)
+
+var testConnsConfig = config.Config{
+	Routes: map[string]config.Route{
+		"test3": config.Route{Prefix: "10.3.0.0/16", Gateway: "10.0.3.1", IPVSMethod: "droute"},
+	},
+	Services: map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+				"test2": config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10},
+			},
+		},
+		"merge": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test3-1": config.ServiceBackend{IPv4: "10.3.0.1", TCP: 8080, Weight: 10},
+				"test3-2": config.ServiceBackend{IPv4: "10.3.0.2", TCP: 8080, Weight: 10},
+			},
+		},
+		"fwmark": config.Service{
+			Frontend: &config.ServiceFrontend{FwMark: 42},
+			Backends: map[string]config.ServiceBackend{
+				"test4": config.ServiceBackend{IPv4: "10.4.0.1", Weight: 10},
+			},
+		},
+	},
+}
+
+const testConnsTable = `Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData
+TCP C0A80164 D431 0A000001 0050 0A010001 1F90 ESTABLISHED     899
+TCP C0A80165 E2A4 0A000001 0050 0A010002 1F90 TIME_WAIT        59
+TCP C0A80166 C350 0A000002 0050 0A000301 0050 ESTABLISHED     899
+TCP C0A80167 C351 0A000042 0015 0A040001 0015 ESTABLISHED     899
+IP  C0A80167 0000 0000002A 0000 0A040001 0000 NONE            120
+TCP C0A80168 C352 0A000009 0050 0A090001 0050 ESTABLISHED     899
+`
+
+var testConnNames = []struct {
+	service  string
+	backends []string
+}{
+	{"test", []string{"test1"}},
+	{"test", []string{"test2"}},
+	{"merge", []string{"test3-1", "test3-2"}},
+	{"fwmark", []string{"test4"}},
+	{"fwmark", []string{"test4"}},
+	{"", nil},
+}
+
+func TestConnNames(t *testing.T) {
+	connNames, err := IPVSOptions{SchedName: "wlc", FwdMethod: ipvs.IP_VS_CONN_F_MASQ}.ConnNames(testConnsConfig)
+	if err != nil {
+		t.Fatalf("ConnNames: %v", err)
+	}
+
+	conns, err := ipvs.ParseConns(strings.NewReader(testConnsTable))
+	if err != nil {
+		t.Fatalf("ParseConns: %v", err)
+	}
+
+	if len(conns) != len(testConnNames) {
+		t.Fatalf("ParseConns: %d conns", len(conns))
+	}
+
+	for i, test := range testConnNames {
+		service, backends := connNames.Lookup(conns[i])
+
+		if service != test.service {
+			t.Errorf("Lookup %v: service %#v", conns[i], service)
+		}
+		if diff := pretty.Compare(test.backends, backends); diff != "" {
+			t.Errorf("Lookup %v: backends:\n%s", conns[i], diff)
+		}
+	}
+}
+
+var testConnMatch = []struct {
+	conn    int
+	service string
+	backend string
+	match   bool
+}{
+	{0, "", "", true},
+	{0, "test", "", true},
+	{0, "test", "test1", true},
+	{0, "test", "test2", false},
+	{0, "merge", "", false},
+	{2, "", "test3-2", true},
+	{2, "merge", "test3-1", true},
+	{3, "fwmark", "test4", true},
+	{5, "", "", true},
+	{5, "test", "", false},
+}
+
+func TestConnMatch(t *testing.T) {
+	connNames, err := IPVSOptions{SchedName: "wlc", FwdMethod: ipvs.IP_VS_CONN_F_MASQ}.ConnNames(testConnsConfig)
+	if err != nil {
+		t.Fatalf("ConnNames: %v", err)
+	}
+
+	conns, err := ipvs.ParseConns(strings.NewReader(testConnsTable))
+	if err != nil {
+		t.Fatalf("ParseConns: %v", err)
+	}
+
+	for _, test := range testConnMatch {
+		if match := connNames.Match(conns[test.conn], test.service, test.backend); match != test.match {
+			t.Errorf("Match %v service=%#v backend=%#v: %v", conns[test.conn], test.service, test.backend, match)
+		}
+	}
+}
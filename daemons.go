@@ -0,0 +1,88 @@
+package clusterf
+
+import (
+	"fmt"
+	"github.com/qmsk/clusterf/ipvs"
+	"log"
+)
+
+// Build the configured sync daemons
+func (options IPVSOptions) syncDaemons() []ipvs.Daemon {
+	var daemons []ipvs.Daemon
+
+	for _, state := range options.SyncDaemon {
+		daemons = append(daemons, ipvs.Daemon{
+			State:    state,
+			McastIfn: options.SyncInterface,
+			SyncID:   options.SyncID,
+		})
+	}
+
+	return daemons
+}
+
+// Compare the configured and running sync daemons, returning the daemons to stop and start
+func diffDaemons(daemons []ipvs.Daemon, running []ipvs.Daemon) (stop []ipvs.Daemon, start []ipvs.Daemon) {
+	var runningStates = make(map[ipvs.DaemonState]ipvs.Daemon)
+	var states = make(map[ipvs.DaemonState]ipvs.Daemon)
+
+	for _, daemon := range running {
+		runningStates[daemon.State] = daemon
+	}
+	for _, daemon := range daemons {
+		states[daemon.State] = daemon
+	}
+
+	for _, daemon := range running {
+		if states[daemon.State] != daemon {
+			stop = append(stop, daemon)
+		}
+	}
+	for _, daemon := range daemons {
+		if runningDaemon, exists := runningStates[daemon.State]; !exists || runningDaemon != daemon {
+			start = append(start, daemon)
+		}
+	}
+
+	return
+}
+
+// Reconcile the kernel sync daemons with the configured daemons.
+//
+// Any other running sync daemons are stopped. The kernel state is left as-is if no sync daemons are configured.
+func (driver *IPVSDriver) syncDaemons() error {
+	var daemons = driver.options.syncDaemons()
+
+	if len(daemons) == 0 {
+		return nil
+	}
+
+	running, err := driver.readClient.ListDaemons()
+	if err != nil {
+		return fmt.Errorf("ipvs.ListDaemons: %v", err)
+	}
+
+	stop, start := diffDaemons(daemons, running)
+
+	for _, daemon := range stop {
+		log.Printf("IPVS: Stop sync daemon %v\n", daemon)
+
+		if driver.writeClient == nil {
+
+		} else if err := driver.writeClient.DelDaemon(daemon); err != nil {
+			return fmt.Errorf("ipvs.DelDaemon %v: %v", daemon, err)
+		}
+	}
+
+	for _, daemon := range start {
+		log.Printf("IPVS: Start sync daemon %v\n", daemon)
+
+		if driver.writeClient == nil {
+
+		} else if err := driver.writeClient.NewDaemon(daemon); err != nil {
+			return fmt.Errorf("ipvs.NewDaemon %v: %v", daemon, err)
+		}
+	}
+
+	return nil
+}
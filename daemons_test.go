@@ -0,0 +1,62 @@
+package clusterf
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/ipvs"
+	"testing"
+)
+
+var testDiffDaemons = map[string]struct {
+	daemons []ipvs.Daemon
+	running []ipvs.Daemon
+	stop    []ipvs.Daemon
+	start   []ipvs.Daemon
+}{
+	"start": {
+		daemons: []ipvs.Daemon{
+			{State: ipvs.IP_VS_STATE_MASTER, McastIfn: "eth0", SyncID: 1},
+			{State: ipvs.IP_VS_STATE_BACKUP, McastIfn: "eth0", SyncID: 1},
+		},
+		start: []ipvs.Daemon{
+			{State: ipvs.IP_VS_STATE_MASTER, McastIfn: "eth0", SyncID: 1},
+			{State: ipvs.IP_VS_STATE_BACKUP, McastIfn: "eth0", SyncID: 1},
+		},
+	},
+	"running": {
+		daemons: []ipvs.Daemon{
+			{State: ipvs.IP_VS_STATE_MASTER, McastIfn: "eth0", SyncID: 1},
+		},
+		running: []ipvs.Daemon{
+			{State: ipvs.IP_VS_STATE_MASTER, McastIfn: "eth0", SyncID: 1},
+		},
+	},
+	"restart": {
+		daemons: []ipvs.Daemon{
+			{State: ipvs.IP_VS_STATE_MASTER, McastIfn: "eth1", SyncID: 1},
+		},
+		running: []ipvs.Daemon{
+			{State: ipvs.IP_VS_STATE_MASTER, McastIfn: "eth0", SyncID: 1},
+			{State: ipvs.IP_VS_STATE_BACKUP, McastIfn: "eth0", SyncID: 1},
+		},
+		stop: []ipvs.Daemon{
+			{State: ipvs.IP_VS_STATE_MASTER, McastIfn: "eth0", SyncID: 1},
+			{State: ipvs.IP_VS_STATE_BACKUP, McastIfn: "eth0", SyncID: 1},
+		},
+		start: []ipvs.Daemon{
+			{State: ipvs.IP_VS_STATE_MASTER, McastIfn: "eth1", SyncID: 1},
+		},
+	},
+}
+
+func TestDiffDaemons(t *testing.T) {
+	for testName, test := range testDiffDaemons {
+		stop, start := diffDaemons(test.daemons, test.running)
+
+		if diff := pretty.Compare(test.stop, stop); diff != "" {
+			t.Errorf("%v diffDaemons stop:\n%s", testName, diff)
+		}
+		if diff := pretty.Compare(test.start, start); diff != "" {
+			t.Errorf("%v diffDaemons start:\n%s", testName, diff)
+		}
+	}
+}
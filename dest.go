@@ -5,17 +5,39 @@ import (
 	"github.com/qmsk/clusterf/config"
 	"github.com/qmsk/clusterf/ipvs"
 	"net"
+	"sort"
+	"strings"
 	"syscall"
 )
 
+// Sorted config backend names merged into a Dest
+type destBackends []string
+
+func (backends destBackends) add(backendName string) destBackends {
+	backends = append(append(destBackends(nil), backends...), backendName)
+
+	sort.Strings(backends)
+
+	return backends
+}
+
+func (backends destBackends) String() string {
+	return strings.Join(backends, ",")
+}
+
 type Dest struct {
 	ipvs.Dest
+
+	// config backend names, empty if not configured
+	backends destBackends
 }
 
 func configServiceBackend(ipvsService ipvs.Service, backend config.ServiceBackend, routes Routes, options IPVSOptions) (*ipvs.Dest, error) {
 	ipvsDest := ipvs.Dest{
 		FwdMethod: options.FwdMethod, // default, overriden by route
 		Weight:    uint32(backend.Weight),
+		UThresh:   uint32(backend.UpperThreshold),
+		LThresh:   uint32(backend.LowerThreshold),
 	}
 
 	switch ipvsService.Af {
@@ -43,19 +65,28 @@ func configServiceBackend(ipvsService ipvs.Service, backend config.ServiceBacken
 		panic("invalid af")
 	}
 
-	switch ipvsService.Protocol {
-	case syscall.IPPROTO_TCP:
+	switch {
+	case ipvsService.FwMark != 0:
+		// dest port is not used for fwmark services
+		ipvsDest.Port = 0
+	case ipvsService.Protocol == syscall.IPPROTO_TCP:
 		if backend.TCP == 0 {
 			return nil, nil
 		} else {
 			ipvsDest.Port = backend.TCP
 		}
-	case syscall.IPPROTO_UDP:
+	case ipvsService.Protocol == syscall.IPPROTO_UDP:
 		if backend.UDP == 0 {
 			return nil, nil
 		} else {
 			ipvsDest.Port = backend.UDP
 		}
+	case ipvsService.Protocol == syscall.IPPROTO_SCTP:
+		if backend.SCTP == 0 {
+			return nil, nil
+		} else {
+			ipvsDest.Port = backend.SCTP
+		}
 	default:
 		panic("invalid proto")
 	}
@@ -70,11 +101,22 @@ func configServiceBackend(ipvsService ipvs.Service, backend config.ServiceBacken
 		return nil, nil
 	} else {
 		ipvsDest.FwdMethod = *route.IPVSMethod
+		ipvsDest.TunType = route.TunType
+		ipvsDest.TunPort = route.TunPort
+		ipvsDest.TunFlags = route.TunFlags
 	}
 
 	// IPVS chaning to next frontend
-	if route.Gateway != nil {
-		// TODO: mixed-family routes
+	if route.Gateway == nil {
+
+	} else if gatewayAf := routeAf(route.Gateway); gatewayAf == ipvsService.Af {
+		ipvsDest.Addr = route.Gateway
+		ipvsDest.Port = ipvsService.Port
+	} else if ipvsDest.FwdMethod != ipvs.IP_VS_CONN_F_TUNNEL {
+		return nil, fmt.Errorf("Invalid %v gateway %v for %v service: requires tunnel method, not %v", gatewayAf, route.Gateway, ipvsService.Af, ipvsDest.FwdMethod)
+	} else {
+		// mixed-family
+		ipvsDest.Af = gatewayAf
 		ipvsDest.Addr = route.Gateway
 		ipvsDest.Port = ipvsService.Port
 	}
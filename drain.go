@@ -0,0 +1,134 @@
+package clusterf
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Identify a draining service dest within the running state
+type drainID struct {
+	Service string
+	Dest    string
+}
+
+// Start draining an unconfigured dest, or continue draining it.
+//
+// Retains the dest in the running state with a zero weight, or with its existing weight if the update fails.
+func (driver *IPVSDriver) drainServiceDest(serviceName string, service Service, dests ServiceDests, destName string, dest Dest, ops *updateOps) {
+	id := drainID{serviceName, destName}
+
+	if _, draining := driver.drains[id]; !draining {
+		log.Printf("IPVS: Drain service %v dest %v\n", service, dest)
+
+		driver.drains[id] = time.Now()
+	}
+
+	dests[destName] = dest
+
+	if dest.Weight != 0 {
+		drainDest := dest
+		drainDest.Weight = 0
+
+		dests[destName] = drainDest
+
+		ops.add("drain", serviceName, service, &drainDest, func() {
+			dests[destName] = dest
+		})
+	}
+}
+
+// Start draining all dests for an unconfigured service, which is removed once all dests have been drained.
+//
+// Returns the service to be retained in the running state.
+func (driver *IPVSDriver) drainService(serviceName string, oldService Service, ops *updateOps) Service {
+	service := Service{
+		Service: oldService.Service,
+		name:    oldService.name,
+		dests:   make(ServiceDests),
+		drain:   true,
+	}
+
+	for destName, dest := range oldService.dests {
+		driver.drainServiceDest(serviceName, service, service.dests, destName, dest, ops)
+	}
+
+	return service
+}
+
+// Lookup active connections for the service dests
+func (driver *IPVSDriver) activeConns(service Service) (map[string]uint32, error) {
+	var activeConns = make(map[string]uint32)
+
+	if ipvsDests, err := driver.readClient.ListDests(service.Service); err != nil {
+		return nil, fmt.Errorf("ipvs.ListDests %v: %v", service, err)
+	} else {
+		for _, ipvsDest := range ipvsDests {
+			activeConns[ipvsDest.String()] = ipvsDest.ActiveConns
+		}
+	}
+
+	return activeConns, nil
+}
+
+// Remove any draining dests that no longer have any active connections, or have timed out.
+//
+// Removes any unconfigured services once all of their dests have been removed.
+// Any failed removals are retried on the next Drain.
+func (driver *IPVSDriver) Drain() error {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	var now = time.Now()
+	var errors UpdateErrors
+
+	for serviceName, service := range driver.services {
+		var activeConns map[string]uint32
+
+		for destName, dest := range service.dests {
+			drainTime, draining := driver.drains[drainID{serviceName, destName}]
+			if !draining {
+				continue
+			}
+
+			if activeConns != nil {
+
+			} else if conns, err := driver.activeConns(service); err != nil {
+				return err
+			} else {
+				activeConns = conns
+			}
+
+			if conns := activeConns[destName]; conns == 0 {
+				log.Printf("IPVS: Drained service %v dest %v\n", service, dest)
+			} else if drainDuration := now.Sub(drainTime); drainDuration >= driver.options.DrainTimeout {
+				log.Printf("IPVS: Drain service %v dest %v timeout after %v with %d active connections\n", service, dest, drainDuration, conns)
+			} else {
+				continue
+			}
+
+			if !errors.check("del", service, &dest, driver.delServiceDest(service, dest)) {
+				continue
+			}
+
+			delete(service.dests, destName)
+			delete(driver.drains, drainID{serviceName, destName})
+		}
+
+		if !service.drain || len(service.dests) > 0 {
+
+		} else if errors.check("del", service, nil, driver.delService(service)) {
+			delete(driver.services, serviceName)
+		}
+	}
+
+	errors = append(errors, driver.updateVIPs(driver.services)...)
+
+	driver.updateState(driver.services)
+
+	if len(errors) > 0 {
+		return errors
+	}
+
+	return nil
+}
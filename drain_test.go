@@ -0,0 +1,147 @@
+package clusterf
+
+import (
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName:    "wlc",
+		FwdMethod:    ipvs.IP_VS_CONN_F_MASQ,
+		DrainTimeout: time.Minute,
+	}, client)
+
+	var frontend = &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80}
+	var backend1 = config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10}
+	var backend2 = config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10}
+
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{Frontend: frontend, Backends: map[string]config.ServiceBackend{"test1": backend1, "test2": backend2}},
+	}, []string{
+		"new inet+tcp://10.0.0.1:80",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+		"new inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=10",
+	})
+
+	// removed backend is drained
+	client.activeConns["10.1.0.2:8080"] = 5
+
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{Frontend: frontend, Backends: map[string]config.ServiceBackend{"test1": backend1}},
+	}, []string{
+		"set inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=0",
+	})
+	testDriverDrain(t, driver, client, nil)
+
+	// concurrent config updates retain the draining backend
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{Frontend: frontend, Backends: map[string]config.ServiceBackend{"test1": backend1}},
+	}, nil)
+	testDriverDrain(t, driver, client, nil)
+
+	// re-added backend is no longer drained
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{Frontend: frontend, Backends: map[string]config.ServiceBackend{"test1": backend1, "test2": backend2}},
+	}, []string{
+		"set inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=10",
+	})
+	testDriverDrain(t, driver, client, nil)
+
+	// removed once drained
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{Frontend: frontend, Backends: map[string]config.ServiceBackend{"test1": backend1}},
+	}, []string{
+		"set inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=0",
+	})
+
+	client.activeConns["10.1.0.2:8080"] = 0
+
+	testDriverDrain(t, driver, client, []string{
+		"del inet+tcp://10.0.0.1:80 10.1.0.2:8080",
+	})
+}
+
+func TestDrainTimeout(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName:    "wlc",
+		FwdMethod:    ipvs.IP_VS_CONN_F_MASQ,
+		DrainTimeout: time.Minute,
+	}, client)
+
+	var frontend = &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80}
+	var backend1 = config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10}
+
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{Frontend: frontend, Backends: map[string]config.ServiceBackend{"test1": backend1}},
+	}, []string{
+		"new inet+tcp://10.0.0.1:80",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+	})
+
+	// removed service is retained while draining
+	client.activeConns["10.1.0.1:8080"] = 1
+
+	testDriverConfig(t, driver, client, nil, []string{
+		"set inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=0",
+	})
+	testDriverDrain(t, driver, client, nil)
+
+	// timeout
+	driver.drains[drainID{"inet+tcp://10.0.0.1:80", "10.1.0.1:8080"}] = time.Now().Add(-time.Minute)
+
+	testDriverDrain(t, driver, client, []string{
+		"del inet+tcp://10.0.0.1:80",
+		"del inet+tcp://10.0.0.1:80 10.1.0.1:8080",
+	})
+}
+
+func TestDrainDisabled(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName: "wlc",
+		FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+	}, client)
+
+	var frontend = &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80}
+	var backend1 = config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10}
+	var backend2 = config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10}
+
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{Frontend: frontend, Backends: map[string]config.ServiceBackend{"test1": backend1, "test2": backend2}},
+	}, []string{
+		"new inet+tcp://10.0.0.1:80",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+		"new inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=10",
+	})
+
+	client.activeConns["10.1.0.2:8080"] = 5
+
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{Frontend: frontend, Backends: map[string]config.ServiceBackend{"test1": backend1}},
+	}, []string{
+		"del inet+tcp://10.0.0.1:80 10.1.0.2:8080",
+	})
+}
+
+func TestDrainInterval(t *testing.T) {
+	var options = IPVSOptions{
+		SchedName:    "wlc",
+		DrainTimeout: time.Minute,
+		Mock:         true,
+	}
+
+	if _, err := options.Open(); err == nil {
+		t.Errorf("IPVSOptions.Open: expected error for zero --ipvs-drain-interval")
+	}
+
+	options.DrainInterval = time.Second
+
+	if _, err := options.Open(); err != nil {
+		t.Errorf("IPVSOptions.Open: %v", err)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"github.com/qmsk/clusterf/config"
 	"github.com/qmsk/clusterf/ipvs"
 	"log"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type IPVSOptions struct {
@@ -16,7 +19,30 @@ type IPVSOptions struct {
 
 	Elide bool `long:"ipvs-elide" description:"Omit services with no backends"`
 
-	Mock bool `long:"ipvs-mock" description:"Do not connect to the kernel IPVS state"`
+	DrainTimeout  time.Duration `long:"ipvs-drain-timeout" value-name:"DURATION" description:"Drain removed backends with zero weight until any active connections close, or the timeout expires. Default is to remove immediately"`
+	DrainInterval time.Duration `long:"ipvs-drain-interval" value-name:"DURATION" default:"5s" description:"Check draining backends for active connections"`
+
+	RetryInterval time.Duration `long:"ipvs-retry-interval" value-name:"DURATION" default:"1s" description:"Retry failed IPVS updates, doubling the interval after each failed retry"`
+	RetryMax      time.Duration `long:"ipvs-retry-max" value-name:"DURATION" default:"60s" description:"Maximum interval between retries of failed IPVS updates"`
+
+	ReconcileInterval time.Duration `long:"ipvs-reconcile-interval" value-name:"DURATION" default:"60s" description:"Re-read the kernel IPVS state, and repair any differences. Zero to disable"`
+
+	SyncDaemon    []ipvs.DaemonState `long:"ipvs-sync-daemon" value-name:"master|backup" description:"Run IPVS connection sync daemon, stopping any other running sync daemons"`
+	SyncInterface string             `long:"ipvs-sync-interface" value-name:"IFACE" description:"Multicast interface for the IPVS connection sync daemon"`
+	SyncID        uint32             `long:"ipvs-sync-id" value-name:"ID" description:"IPVS connection sync daemon ID"`
+
+	Netns          string   `long:"ipvs-netns" value-name:"NAME|PATH" description:"Operate on the IPVS state in the given network namespace, by name in /var/run/netns or path"`
+	FilterServices string   `long:"ipvs-filter-services" value-name:"NAME-PREFIX" description:"Only apply config services with a matching name"`
+	Instances      []string `long:"ipvs-instance" value-name:"NETNS[=NAME-PREFIX]" description:"Run a separate IPVS driver for each network namespace, applying the config services with a matching name"`
+
+	ScopePrefix []string `long:"ipvs-scope-prefix" value-name:"PREFIX" description:"Only manage IPVS services with a VIP within the prefix, leaving any other services alone"`
+	ScopePort   []uint16 `long:"ipvs-scope-port" value-name:"PORT" description:"Only manage IPVS services with a VIP on the port, leaving any other services alone"`
+	ScopeFwMark []string `long:"ipvs-scope-fwmark" value-name:"MARK[-MARK]" description:"Only manage IPVS fwmark services within the range, leaving any other services alone"`
+	State       string   `long:"ipvs-state" value-name:"PATH" description:"Persist the IPVS services created by clusterf, and only manage those services"`
+
+	VIPInterface string `long:"ipvs-vip-interface" value-name:"IFACE" description:"Add the service VIPs to the local interface, such as a dummy device, and remove them once unused, requiring --ipvs-state or --ipvs-scope-prefix"`
+
+	Mock bool `long:"ipvs-mock" description:"Use an in-memory emulation of the kernel IPVS state"`
 	Noop bool `long:"ipvs-noop" description:"Do not write to the kernel IPVS state"`
 }
 
@@ -30,36 +56,136 @@ func (options IPVSOptions) Open() (*IPVSDriver, error) {
 	return &driver, nil
 }
 
+// Name of the --ipvs-netns instance, suitable for use in file and URL paths
+func (options IPVSOptions) InstanceName() string {
+	return strings.Replace(strings.Trim(options.Netns, "/"), "/", "-", -1)
+}
+
+// Expand the options for each --ipvs-instance, or the options as-is if there are none.
+//
+// Each instance must use a separate network namespace.
+func (options IPVSOptions) InstanceOptions() ([]IPVSOptions, error) {
+	var instances []IPVSOptions
+	var netnsInstances = make(map[string]bool)
+
+	if len(options.Instances) == 0 {
+		return []IPVSOptions{options}, nil
+	}
+
+	for _, instance := range options.Instances {
+		var instanceOptions = options
+		var parts = strings.SplitN(instance, "=", 2)
+
+		instanceOptions.Netns = parts[0]
+		instanceOptions.Instances = nil
+
+		if options.State != "" {
+			instanceOptions.State = options.State + "." + instanceOptions.InstanceName()
+		}
+
+		if len(parts) > 1 {
+			instanceOptions.FilterServices = parts[1]
+		}
+
+		if instanceOptions.Netns == "" {
+			return nil, fmt.Errorf("Invalid --ipvs-instance=%v: missing netns", instance)
+		} else if netnsPath := ipvs.NetnsPath(instanceOptions.Netns); netnsInstances[netnsPath] {
+			return nil, fmt.Errorf("Invalid --ipvs-instance=%v: duplicate netns %v", instance, netnsPath)
+		} else {
+			netnsInstances[netnsPath] = true
+		}
+
+		instances = append(instances, instanceOptions)
+	}
+
+	return instances, nil
+}
+
 // Used to expand ServiceFrontend/Backend -> multiple ipvs.service/Dest
 type ipvsType struct {
 	Af       ipvs.Af
 	Protocol ipvs.Protocol
+	FwMark   bool // Protocol is not used
 }
 
 var ipvsTypes = []ipvsType{
-	{syscall.AF_INET, syscall.IPPROTO_TCP},
-	{syscall.AF_INET6, syscall.IPPROTO_TCP},
-	{syscall.AF_INET, syscall.IPPROTO_UDP},
-	{syscall.AF_INET6, syscall.IPPROTO_UDP},
+	{syscall.AF_INET, syscall.IPPROTO_TCP, false},
+	{syscall.AF_INET6, syscall.IPPROTO_TCP, false},
+	{syscall.AF_INET, syscall.IPPROTO_UDP, false},
+	{syscall.AF_INET6, syscall.IPPROTO_UDP, false},
+	{syscall.AF_INET, syscall.IPPROTO_SCTP, false},
+	{syscall.AF_INET6, syscall.IPPROTO_SCTP, false},
+	{syscall.AF_INET, 0, true},
+	{syscall.AF_INET6, 0, true},
 }
 
 // Running state
 type IPVSDriver struct {
 	options     IPVSOptions
-	readClient  *ipvs.Client
-	writeClient *ipvs.Client
+	readClient  ipvs.Interface
+	writeClient ipvs.Interface
+
+	// optional --ipvs-vip-interface
+	addrs ipvs.AddrInterface
+
+	// protects the state against concurrent metrics requests
+	mutex sync.Mutex
+
+	// configured state
+	config     config.Config
+	configured bool
+	health     Health
+
+	// managed services
+	scope      ipvsScope
+	owned      map[string]bool
+	ownedVIPs  map[string]bool // added by us, from the --ipvs-state
+	adopt      bool            // no --ipvs-state yet, adopt any configured services on the first update
+	stateSaved bool
 
 	// running state
-	routes   Routes
-	services Services
+	routes      Routes
+	services    Services
+	unowned     Services // never modified
+	vips        vips
+	unownedVIPs map[string]bool // existing addresses not added by us, never modified
+	timeouts    ipvs.Timeouts
+	drains      map[drainID]time.Time
+
+	// consecutive failed updates, retried with backoff
+	failures uint
+
+	// total differences repaired by Reconcile
+	drift uint64
 }
 
 func (driver *IPVSDriver) init(options IPVSOptions) error {
 	driver.options = options
+	driver.drains = make(map[drainID]time.Time)
 
-	if options.Mock {
+	if options.DrainTimeout > 0 && options.DrainInterval <= 0 {
+		return fmt.Errorf("--ipvs-drain-timeout requires a positive --ipvs-drain-interval")
+	}
+
+	if scope, err := options.scope(); err != nil {
+		return err
+	} else {
+		driver.scope = scope
+	}
+
+	if options.State == "" {
 
-	} else if ipvsClient, err := ipvs.Open(); err != nil {
+	} else if owned, ownedVIPs, err := loadState(options.State); err != nil {
+		return fmt.Errorf("Load state %v: %v", options.State, err)
+	} else {
+		driver.owned = owned
+		driver.ownedVIPs = ownedVIPs
+		driver.adopt = owned == nil
+	}
+
+	if options.Mock {
+		driver.readClient = ipvs.NewEmulator()
+	} else if ipvsClient, err := ipvs.OpenNetns(options.Netns); err != nil {
 		return err
 	} else {
 		if options.Debug {
@@ -75,49 +201,130 @@ func (driver *IPVSDriver) init(options IPVSOptions) error {
 		driver.writeClient = driver.readClient
 	}
 
-	if driver.readClient == nil {
-		// mock'd
-	} else if info, err := driver.readClient.GetInfo(); err != nil {
+	if options.VIPInterface == "" {
+
+	} else if options.State == "" && len(options.ScopePrefix) == 0 {
+		return fmt.Errorf("--ipvs-vip-interface requires --ipvs-state or --ipvs-scope-prefix")
+	} else if options.Mock {
+		driver.addrs = ipvs.NewAddrEmulator()
+	} else if addrClient, err := ipvs.OpenAddrs(options.VIPInterface, options.Netns); err != nil {
+		return err
+	} else {
+		driver.addrs = addrClient
+	}
+
+	if err := driver.syncVIPs(); err != nil {
+		return fmt.Errorf("List VIPs on %v: %v", options.VIPInterface, err)
+	}
+
+	if info, err := driver.readClient.GetInfo(); err != nil {
 		return err
 	} else {
 		log.Printf("ipvs.GetInfo: version=%s, conn_tab_size=%d\n", info.Version, info.ConnTabSize)
 	}
 
+	if len(options.SyncDaemon) > 0 && options.SyncInterface == "" {
+		return fmt.Errorf("--ipvs-sync-daemon requires --ipvs-sync-interface")
+	}
+
+	if err := driver.syncDaemons(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Reset running state in kernel
+// Reset running state in kernel.
+//
+// Only removes the owned services when using any --ipvs-scope or --ipvs-state.
 func (driver *IPVSDriver) Flush() error {
-	if driver.writeClient == nil {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	if !driver.scoped() {
+		if driver.writeClient == nil {
 
-	} else if err := driver.writeClient.Flush(); err != nil {
+		} else if err := driver.writeClient.Flush(); err != nil {
+			return err
+		}
+	} else if services, err := driver.list(); err != nil {
 		return err
+	} else {
+		for _, service := range driver.own(services) {
+			if err := driver.delService(service); err != nil {
+				return fmt.Errorf("ipvs.DelService %v: %v", service, err)
+			}
+		}
 	}
 
 	driver.services = nil
+	driver.drains = make(map[drainID]time.Time)
+
+	var errors = driver.updateVIPs(nil)
+
+	driver.updateState(nil)
+
+	if len(errors) > 0 {
+		return errors
+	}
 
 	return nil
 }
 
-// Sync running state from kernel
-func (driver *IPVSDriver) Sync() error {
+// Reset kernel stats, retaining the running state
+func (driver *IPVSDriver) Zero() error {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	log.Printf("IPVS: Zero\n")
+
+	if driver.writeClient == nil {
+		return nil
+	} else {
+		return driver.writeClient.Zero()
+	}
+}
+
+// Read kernel state
+func (driver *IPVSDriver) list() (Services, error) {
 	services := make(Services)
 
-	if driver.readClient == nil {
-		return fmt.Errorf("Cannot sync against a mock'd ipvs.Client")
-	} else if ipvsServices, err := driver.readClient.ListServices(); err != nil {
-		return fmt.Errorf("ipvs.ListServices: %v\n", err)
+	if ipvsServices, err := driver.readClient.ListServices(); err != nil {
+		return nil, fmt.Errorf("ipvs.ListServices: %v", err)
+	} else if lister, ok := driver.readClient.(ipvs.DestsLister); ok && len(ipvsServices) > 1 {
+		if serviceDests, err := lister.ListServicesDests(ipvsServices); err != nil {
+			return nil, fmt.Errorf("ipvs.ListServicesDests: %v", err)
+		} else {
+			for i, ipvsService := range ipvsServices {
+				services.sync(ipvsService, serviceDests[i])
+			}
+		}
 	} else {
 		for _, ipvsService := range ipvsServices {
 			if dests, err := driver.readClient.ListDests(ipvsService); err != nil {
-				return fmt.Errorf("ipvs.ListDests %v: %v\n", ipvsService, err)
+				return nil, fmt.Errorf("ipvs.ListDests %v: %v", ipvsService, err)
 			} else {
 				services.sync(ipvsService, dests)
 			}
 		}
 	}
 
-	driver.services = services
+	return services, nil
+}
+
+// Sync running state from kernel
+func (driver *IPVSDriver) Sync() error {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	services, err := driver.list()
+	if err != nil {
+		return err
+	}
+
+	driver.services = driver.own(services)
+	driver.drains = make(map[drainID]time.Time)
+	driver.updateState(driver.services)
 
 	return nil
 }
@@ -182,72 +389,112 @@ func (driver *IPVSDriver) delServiceDest(service Service, dest Dest) error {
 	}
 }
 
-// Apply new state
-func (driver *IPVSDriver) update(routes Routes, services Services) error {
-	for serviceName, service := range services {
-		oldService, exists := driver.services[serviceName]
+func (driver *IPVSDriver) setTimeouts(timeouts ipvs.Timeouts) error {
+	log.Printf("IPVS: Set timeouts tcp=%d tcp_fin=%d udp=%d\n", timeouts.TCP, timeouts.TCPFin, timeouts.UDP)
 
-		if !exists {
-			driver.newService(service)
-		} else if !service.Equals(oldService.Service) {
-			driver.setService(service)
-		}
-
-		for destName, dest := range service.dests {
-			oldDest, exists := oldService.dests[destName]
-
-			if !exists {
-				driver.newServiceDest(service, dest)
-			} else if !dest.Equals(oldDest.Dest) {
-				driver.setServiceDest(service, dest)
-			}
-		}
-
-		for destName, oldDest := range oldService.dests {
-			if _, exists := service.dests[destName]; !exists {
-				driver.delServiceDest(service, oldDest)
-			}
-		}
+	if driver.writeClient == nil {
+		return nil
+	} else {
+		return driver.writeClient.SetTimeouts(timeouts)
 	}
+}
 
-	for serviceName, oldService := range driver.services {
-		if _, exists := services[serviceName]; !exists {
-			// removing a service also removes all service.dests
-			driver.delService(oldService)
-		}
+// Apply new timeouts, if changed.
+// Unconfigured timeouts are left as-is.
+func (driver *IPVSDriver) updateTimeouts(timeouts ipvs.Timeouts) error {
+	if timeouts == driver.timeouts {
+		return nil
+	} else if timeouts == (ipvs.Timeouts{}) {
+
+	} else if err := driver.setTimeouts(timeouts); err != nil {
+		return fmt.Errorf("ipvs.SetTimeouts: %v", err)
 	}
 
-	driver.routes = routes
-	driver.services = services
+	driver.timeouts = timeouts
 
 	return nil
 }
 
-// Update state from config
-func (driver *IPVSDriver) Config(config config.Config) error {
+// Build the IPVS timeouts from Config, with zero timeouts if unconfigured
+func configTimeouts(configTimeouts *config.IPVSTimeouts) ipvs.Timeouts {
+	if configTimeouts == nil {
+		return ipvs.Timeouts{}
+	}
+
+	return ipvs.Timeouts{
+		TCP:    configTimeouts.TCP,
+		TCPFin: configTimeouts.TCPFin,
+		UDP:    configTimeouts.UDP,
+	}
+}
+
+// Apply configured state
+func (driver *IPVSDriver) configure() error {
 	// routes
-	routes, err := configRoutes(config.Routes)
+	routes, err := configRoutes(driver.config.Routes)
 	if err != nil {
 		return err
 	}
 
 	// services
-	services, err := configServices(config.Services, routes, driver.options)
+	services, err := configServices(driver.config.Services, routes, driver.health, driver.options)
 	if err != nil {
 		return err
 	}
 
+	// timeouts
+	if err := driver.updateTimeouts(configTimeouts(driver.config.IPVS.Timeouts)); err != nil {
+		return err
+	}
+
 	return driver.update(routes, services)
 }
 
+// Update state from config
+func (driver *IPVSDriver) Config(config config.Config) error {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	driver.config = config
+	driver.configured = true
+
+	return driver.configure()
+}
+
+// Update backend health state from checks
+func (driver *IPVSDriver) Health(health Health) error {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	driver.health = health
+
+	if !driver.configured {
+		// wait for initial config before applying anything
+		return nil
+	}
+
+	return driver.configure()
+}
+
 func (driver *IPVSDriver) Print() {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
 	fmt.Printf("Proto                           Addr:Port\n")
 	for _, service := range driver.services {
-		fmt.Printf("%-5v %30s:%-5d %s\n",
-			service.Protocol,
-			service.Addr, service.Port,
-			service.SchedName,
-		)
+		if service.FwMark != 0 {
+			fmt.Printf("%-5v %36d %s\n",
+				"fwm",
+				service.FwMark,
+				service.SchedName,
+			)
+		} else {
+			fmt.Printf("%-5v %30s:%-5d %s\n",
+				service.Protocol,
+				service.Addr, service.Port,
+				service.SchedName,
+			)
+		}
 
 		for _, dest := range service.dests {
 			fmt.Printf("%5s %30s:%-5d %v\n",
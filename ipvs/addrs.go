@@ -0,0 +1,305 @@
+package ipvs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Local host addresses on a network interface, implemented by the rtnetlink AddrClient, or the in-memory AddrEmulator.
+//
+// Only host addresses with a /32 or /128 prefix are listed.
+type AddrInterface interface {
+	ListAddrs() ([]net.IP, error)
+	AddAddr(net.IP) error
+	DelAddr(net.IP) error
+}
+
+// rtnetlink ifaddrmsg flags
+const IFA_F_NODAD = 0x02
+
+// Pack a rtnetlink ifaddrmsg request for a host address
+func packAddrRequest(msgType uint16, flags uint16, seq uint32, index int, ip net.IP) []byte {
+	var family uint8 = syscall.AF_INET6
+	var prefixLen uint8 = 128
+	var ifaFlags uint8 = IFA_F_NODAD
+	var addr = ip.To16()
+	var attrs []byte
+
+	if ip4 := ip.To4(); ip4 != nil {
+		family = syscall.AF_INET
+		prefixLen = 32
+		ifaFlags = 0
+		addr = ip4
+	}
+
+	// struct rtattr
+	for _, attrType := range []uint16{syscall.IFA_LOCAL, syscall.IFA_ADDRESS} {
+		var attr = make([]byte, (syscall.SizeofRtAttr+len(addr)+syscall.RTA_ALIGNTO-1) & ^(syscall.RTA_ALIGNTO-1))
+
+		binary.NativeEndian.PutUint16(attr[0:2], uint16(syscall.SizeofRtAttr+len(addr)))
+		binary.NativeEndian.PutUint16(attr[2:4], attrType)
+		copy(attr[4:], addr)
+
+		attrs = append(attrs, attr...)
+	}
+
+	var length = syscall.NLMSG_HDRLEN + syscall.SizeofIfAddrmsg + len(attrs)
+	var buf = make([]byte, length)
+
+	// struct nlmsghdr
+	binary.NativeEndian.PutUint32(buf[0:4], uint32(length))
+	binary.NativeEndian.PutUint16(buf[4:6], msgType)
+	binary.NativeEndian.PutUint16(buf[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK|flags)
+	binary.NativeEndian.PutUint32(buf[8:12], seq)
+	binary.NativeEndian.PutUint32(buf[12:16], 0)
+
+	// struct ifaddrmsg
+	buf[16] = family
+	buf[17] = prefixLen
+	buf[18] = ifaFlags
+	buf[19] = syscall.RT_SCOPE_UNIVERSE
+	binary.NativeEndian.PutUint32(buf[20:24], uint32(index))
+
+	copy(buf[24:], attrs)
+
+	return buf
+}
+
+// Unpack a rtnetlink RTM_NEWADDR message, returning the interface index, and a nil IP if not a host address
+func unpackAddrMessage(msg syscall.NetlinkMessage) (int, net.IP, error) {
+	if len(msg.Data) < syscall.SizeofIfAddrmsg {
+		return 0, nil, fmt.Errorf("short ifaddrmsg")
+	}
+
+	var family = msg.Data[0]
+	var prefixLen = msg.Data[1]
+	var index = int(binary.NativeEndian.Uint32(msg.Data[4:8]))
+	var local, address net.IP
+
+	attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+	if err != nil {
+		return index, nil, err
+	}
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case syscall.IFA_LOCAL:
+			local = net.IP(attr.Value)
+		case syscall.IFA_ADDRESS:
+			address = net.IP(attr.Value)
+		}
+	}
+
+	if family == syscall.AF_INET && prefixLen == 32 && local != nil {
+		// IFA_ADDRESS is the peer address for point-to-point interfaces
+		return index, local, nil
+	} else if family == syscall.AF_INET6 && prefixLen == 128 && address != nil {
+		return index, address, nil
+	} else {
+		return index, nil, nil
+	}
+}
+
+// Host addresses on a network interface, managed using rtnetlink
+type AddrClient struct {
+	iface *net.Interface
+	fd    int
+	seq   uint32
+}
+
+// Open a rtnetlink socket for the named interface, within the given network namespace name or path, or the current network namespace if empty.
+func OpenAddrs(ifname string, netns string) (*AddrClient, error) {
+	var client = AddrClient{
+		seq: uint32(time.Now().Unix()),
+	}
+
+	if err := withNetns(NetnsPath(netns), func() error {
+		if iface, err := net.InterfaceByName(ifname); err != nil {
+			return err
+		} else {
+			client.iface = iface
+		}
+
+		if fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE); err != nil {
+			return fmt.Errorf("socket: %v", err)
+		} else {
+			client.fd = fd
+		}
+
+		if err := syscall.Bind(client.fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+			syscall.Close(client.fd)
+
+			return fmt.Errorf("bind: %v", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("ipvs:OpenAddrs %v: %v", ifname, err)
+	}
+
+	return &client, nil
+}
+
+func (client *AddrClient) String() string {
+	return client.iface.Name
+}
+
+// Write a request, and call the given function for each returned message until the ack or dump is done
+func (client *AddrClient) exec(buf []byte, f func(syscall.NetlinkMessage) error) error {
+	var seq = binary.NativeEndian.Uint32(buf[8:12])
+
+	if err := syscall.Sendto(client.fd, buf, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return fmt.Errorf("sendto: %v", err)
+	}
+
+	var recvBuf = make([]byte, 65536)
+
+	for {
+		n, _, err := syscall.Recvfrom(client.fd, recvBuf, 0)
+		if err != nil {
+			return fmt.Errorf("recvfrom: %v", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(recvBuf[:n])
+		if err != nil {
+			return fmt.Errorf("recvfrom: %v", err)
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq {
+				// stale
+				continue
+			}
+
+			switch msg.Header.Type {
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				if len(msg.Data) < 4 {
+					return fmt.Errorf("short nlmsgerr")
+				} else if errno := int32(binary.NativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+					return syscall.Errno(-errno)
+				} else {
+					return nil
+				}
+			default:
+				if err := f(msg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (client *AddrClient) nextSeq() uint32 {
+	client.seq++
+
+	return client.seq
+}
+
+func (client *AddrClient) ListAddrs() ([]net.IP, error) {
+	var addrs []net.IP
+
+	// struct nlmsghdr + struct ifaddrmsg
+	var buf = make([]byte, syscall.NLMSG_HDRLEN+syscall.SizeofIfAddrmsg)
+
+	binary.NativeEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	binary.NativeEndian.PutUint16(buf[4:6], syscall.RTM_GETADDR)
+	binary.NativeEndian.PutUint16(buf[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	binary.NativeEndian.PutUint32(buf[8:12], client.nextSeq())
+	buf[16] = syscall.AF_UNSPEC
+
+	if err := client.exec(buf, func(msg syscall.NetlinkMessage) error {
+		if msg.Header.Type != syscall.RTM_NEWADDR {
+			return nil
+		} else if index, ip, err := unpackAddrMessage(msg); err != nil {
+			return err
+		} else if index == client.iface.Index && ip != nil {
+			addrs = append(addrs, ip)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("ipvs:AddrClient.ListAddrs %v: %v", client, err)
+	}
+
+	return addrs, nil
+}
+
+func (client *AddrClient) AddAddr(ip net.IP) error {
+	var buf = packAddrRequest(syscall.RTM_NEWADDR, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, client.nextSeq(), client.iface.Index, ip)
+
+	return client.exec(buf, func(syscall.NetlinkMessage) error { return nil })
+}
+
+func (client *AddrClient) DelAddr(ip net.IP) error {
+	var buf = packAddrRequest(syscall.RTM_DELADDR, 0, client.nextSeq(), client.iface.Index, ip)
+
+	return client.exec(buf, func(syscall.NetlinkMessage) error { return nil })
+}
+
+// In-memory emulation of the interface host addresses, following the kernel semantics for errors.
+type AddrEmulator struct {
+	mutex sync.Mutex
+
+	addrs map[string]net.IP
+}
+
+func NewAddrEmulator() *AddrEmulator {
+	return &AddrEmulator{
+		addrs: make(map[string]net.IP),
+	}
+}
+
+// Sorted by address
+func (emulator *AddrEmulator) ListAddrs() ([]net.IP, error) {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	var addrs []net.IP
+	var keys []string
+
+	for key := range emulator.addrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		addrs = append(addrs, emulator.addrs[key])
+	}
+
+	return addrs, nil
+}
+
+func (emulator *AddrEmulator) AddAddr(ip net.IP) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if ip.To16() == nil {
+		return syscall.EINVAL
+	} else if _, exists := emulator.addrs[ip.String()]; exists {
+		return syscall.EEXIST
+	}
+
+	emulator.addrs[ip.String()] = ip
+
+	return nil
+}
+
+func (emulator *AddrEmulator) DelAddr(ip net.IP) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if _, exists := emulator.addrs[ip.String()]; !exists {
+		return syscall.EADDRNOTAVAIL
+	}
+
+	delete(emulator.addrs, ip.String())
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package ipvs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestAddrRequest(t *testing.T) {
+	for _, test := range []struct {
+		ip     net.IP
+		family uint8
+		flags  uint8
+	}{
+		{net.ParseIP("10.0.0.1"), syscall.AF_INET, 0},
+		{net.ParseIP("2001:db8::1"), syscall.AF_INET6, IFA_F_NODAD},
+	} {
+		var buf = packAddrRequest(syscall.RTM_NEWADDR, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, 100, 3, test.ip)
+
+		msgs, err := syscall.ParseNetlinkMessage(buf)
+		if err != nil {
+			t.Fatalf("ParseNetlinkMessage %v: %v", test.ip, err)
+		} else if len(msgs) != 1 {
+			t.Fatalf("ParseNetlinkMessage %v: %d messages", test.ip, len(msgs))
+		}
+
+		var msg = msgs[0]
+
+		if msg.Header.Type != syscall.RTM_NEWADDR {
+			t.Errorf("message %v type: %d", test.ip, msg.Header.Type)
+		}
+		if msg.Header.Flags != syscall.NLM_F_REQUEST|syscall.NLM_F_ACK|syscall.NLM_F_CREATE|syscall.NLM_F_EXCL {
+			t.Errorf("message %v flags: %#04x", test.ip, msg.Header.Flags)
+		}
+		if msg.Header.Seq != 100 {
+			t.Errorf("message %v seq: %d", test.ip, msg.Header.Seq)
+		}
+		if msg.Data[0] != test.family || msg.Data[2] != test.flags {
+			t.Errorf("message %v ifaddrmsg: %v", test.ip, msg.Data[0:8])
+		}
+
+		if index, ip, err := unpackAddrMessage(msg); err != nil {
+			t.Errorf("unpackAddrMessage %v: %v", test.ip, err)
+		} else if index != 3 || !ip.Equal(test.ip) {
+			t.Errorf("unpackAddrMessage %v: index=%d ip=%v", test.ip, index, ip)
+		}
+	}
+}
+
+func TestAddrEmulator(t *testing.T) {
+	var emulator = NewAddrEmulator()
+
+	if err := emulator.AddAddr(net.ParseIP("10.0.0.2")); err != nil {
+		t.Fatalf("AddAddr: %v", err)
+	}
+	if err := emulator.AddAddr(net.ParseIP("10.0.0.1")); err != nil {
+		t.Fatalf("AddAddr: %v", err)
+	}
+	if err := emulator.AddAddr(net.ParseIP("10.0.0.1")); err != syscall.EEXIST {
+		t.Errorf("AddAddr exists: %v", err)
+	}
+	if err := emulator.DelAddr(net.ParseIP("10.0.0.2")); err != nil {
+		t.Fatalf("DelAddr: %v", err)
+	}
+	if err := emulator.DelAddr(net.ParseIP("10.0.0.2")); err != syscall.EADDRNOTAVAIL {
+		t.Errorf("DelAddr not exists: %v", err)
+	}
+
+	if addrs, err := emulator.ListAddrs(); err != nil {
+		t.Fatalf("ListAddrs: %v", err)
+	} else if len(addrs) != 1 || !addrs[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("ListAddrs: %v", addrs)
+	}
+}
+
+func TestAddrClient(t *testing.T) {
+	netns, done := testNetns(t)
+	defer done()
+
+	client, err := OpenAddrs("lo", netns)
+	if err != nil {
+		t.Skipf("OpenAddrs: %v", err)
+	}
+
+	var testIPs = []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")}
+
+	for _, ip := range testIPs {
+		if err := client.AddAddr(ip); err != nil {
+			t.Skipf("AddAddr %v: %v", ip, err)
+		}
+	}
+
+	if err := client.AddAddr(testIPs[0]); err != syscall.EEXIST {
+		t.Errorf("AddAddr exists: %v", err)
+	}
+
+	if addrs, err := client.ListAddrs(); err != nil {
+		t.Fatalf("ListAddrs: %v", err)
+	} else {
+		for _, ip := range testIPs {
+			var found = false
+
+			for _, addr := range addrs {
+				if addr.Equal(ip) {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("ListAddrs: missing %v in %v", ip, addrs)
+			}
+		}
+	}
+
+	for _, ip := range testIPs {
+		if err := client.DelAddr(ip); err != nil {
+			t.Errorf("DelAddr %v: %v", ip, err)
+		}
+	}
+
+	if addrs, err := client.ListAddrs(); err != nil {
+		t.Fatalf("ListAddrs: %v", err)
+	} else if len(addrs) != 0 {
+		t.Errorf("ListAddrs: %v", addrs)
+	}
+}
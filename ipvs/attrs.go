@@ -15,14 +15,15 @@ func nlattr(typ uint16, value nlgo.NlaValue) nlgo.Attr {
 }
 
 // Helpers for struct <-> nlgo.Binary
+// The kernel structs are in host byte order, like the nlgo.U16/U32 attrs
 func unpack(value nlgo.Binary, out interface{}) error {
-	return binary.Read(bytes.NewReader(([]byte)(value)), binary.BigEndian, out)
+	return binary.Read(bytes.NewReader(([]byte)(value)), binary.NativeEndian, out)
 }
 
 func pack(in interface{}) nlgo.Binary {
 	var buf bytes.Buffer
 
-	if err := binary.Write(&buf, binary.BigEndian, in); err != nil {
+	if err := binary.Write(&buf, binary.NativeEndian, in); err != nil {
 		panic(err)
 	}
 
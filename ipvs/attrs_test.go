@@ -46,6 +46,94 @@ func TestInfo(t *testing.T) {
 	}
 }
 
+func TestTimeouts(t *testing.T) {
+	testTimeouts := Timeouts{TCP: 900, UDP: 300}
+	testBytes := []byte{
+		0x08, 0x00, 0x04, 0x00, 0x84, 0x03, 0x00, 0x00, // IPVS_CMD_ATTR_TIMEOUT_TCP 900
+		0x08, 0x00, 0x06, 0x00, 0x2c, 0x01, 0x00, 0x00, // IPVS_CMD_ATTR_TIMEOUT_UDP 300
+	}
+
+	// pack
+	if packBytes := testTimeouts.attrs().Bytes(); !bytes.Equal(packBytes, testBytes) {
+		t.Errorf("fail Timeouts.attrs(): \n%s", hex.Dump(packBytes))
+	}
+
+	// unpack
+	if unpackedAttrs, err := ipvs_cmd_policy.Parse(testBytes); err != nil {
+		t.Fatalf("error ipvs_cmd_policy.Parse: %s", err)
+	} else if timeouts, err := unpackTimeouts(unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackTimeouts: %s", err)
+	} else if timeouts != testTimeouts {
+		t.Errorf("fail unpackTimeouts: %+v", timeouts)
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	testDaemon := Daemon{
+		State:    IP_VS_STATE_BACKUP,
+		McastIfn: "eth0",
+		SyncID:   7,
+	}
+	testBytes := []byte{
+		0x08, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, // IPVS_DAEMON_ATTR_STATE     backup
+		0x09, 0x00, 0x02, 0x00, 'e', 't', 'h', '0', 0x00, 0x00, 0x00, 0x00, // IPVS_DAEMON_ATTR_MCAST_IFN eth0
+		0x08, 0x00, 0x03, 0x00, 0x07, 0x00, 0x00, 0x00, // IPVS_DAEMON_ATTR_SYNC_ID   7
+	}
+
+	// pack
+	if packBytes := testDaemon.attrs(true).Bytes(); !bytes.Equal(packBytes, testBytes) {
+		t.Errorf("fail Daemon.attrs(): \n%s", hex.Dump(packBytes))
+	}
+
+	// unpack
+	if unpackedAttrs, err := ipvs_daemon_policy.Parse(testBytes); err != nil {
+		t.Fatalf("error ipvs_daemon_policy.Parse: %s", err)
+	} else if daemon, err := unpackDaemon(unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackDaemon: %s", err)
+	} else if daemon != testDaemon {
+		t.Errorf("fail unpackDaemon: %+v", daemon)
+	}
+
+	if str := testDaemon.String(); str != "backup@eth0/7" {
+		t.Errorf("fail Daemon.String(): %s", str)
+	}
+}
+
+func TestZero(t *testing.T) {
+	testService := Service{
+		Af:       syscall.AF_INET,
+		Protocol: syscall.IPPROTO_TCP,
+		Addr:     net.ParseIP("10.107.107.0"),
+		Port:     1337,
+	}
+
+	var tests = []struct {
+		service *Service
+		bytes   []byte
+	}{
+		{nil, nil},
+		{&testService, []byte{
+			0x24, 0x00, 0x01, 0x00, // IPVS_CMD_ATTR_SERVICE
+			0x06, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, // IPVS_SVC_ATTR_AF       2
+			0x06, 0x00, 0x02, 0x00, 0x06, 0x00, 0x00, 0x00, // IPVS_SVC_ATTR_PROTOCOL 6
+			0x08, 0x00, 0x03, 0x00, 0x0a, 0x6b, 0x6b, 0x00, // IPVS_SVC_ATTR_ADDR     10.107.107.0
+			0x06, 0x00, 0x04, 0x00, 0x05, 0x39, 0x00, 0x00, // IPVS_SVC_ATTR_PORT     1337
+		}},
+	}
+
+	for _, test := range tests {
+		request := zeroRequest(test.service)
+
+		if request.Cmd != IPVS_CMD_ZERO {
+			t.Errorf("fail zeroRequest(%v).Cmd: %d", test.service, request.Cmd)
+		}
+
+		if packBytes := request.Attrs.Bytes(); !bytes.Equal(packBytes, test.bytes) {
+			t.Errorf("fail zeroRequest(%v).Attrs: \n%s", test.service, hex.Dump(packBytes))
+		}
+	}
+}
+
 func testServiceEquals(t *testing.T, testService Service, service Service) {
 	if service.Af != testService.Af {
 		t.Errorf("fail Service.Af: %s", service.Af)
@@ -115,6 +203,113 @@ func TestService(t *testing.T) {
 	}
 }
 
+func TestServiceFwMark(t *testing.T) {
+	testService := Service{
+		Af:        syscall.AF_INET6, // 10
+		FwMark:    42,
+		SchedName: "wlc",
+		Flags:     Flags{0, 0},
+		Timeout:   0,
+		Netmask:   128,
+	}
+	testBytes := []byte{
+		0x06, 0x00, 0x01, 0x00, // IPVS_SVC_ATTR_AF
+		0x0a, 0x00, 0x00, 0x00, // 10
+		0x08, 0x00, 0x05, 0x00, 0x2a, 0x00, 0x00, 0x00, // IPVS_SVC_ATTR_FWMARK     42
+		0x08, 0x00, 0x06, 0x00, 'w', 'l', 'c', 0x00, // IPVS_SVC_ATTR_SCHED_NAME wlc
+		0x0c, 0x00, 0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // IPVS_SVC_ATTR_FLAGS 0:0
+		0x08, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, // IPVS_SVC_ATTR_TIMEOUT    0
+		0x08, 0x00, 0x09, 0x00, 0x80, 0x00, 0x00, 0x00, // IPVS_SVC_ATTR_NETMASK    128
+	}
+
+	// pack
+	packAttrs := testService.attrs(true)
+	packBytes := packAttrs.Bytes()
+
+	if !bytes.Equal(packBytes, testBytes) {
+		t.Errorf("fail Service.attrs(): \n%s", hex.Dump(packBytes))
+	}
+
+	// unpack
+	if unpackedAttrs, err := ipvs_service_policy.Parse(packBytes); err != nil {
+		t.Fatalf("error ipvs_service_policy.Parse: %s", err)
+	} else if unpackedService, err := unpackService(unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackService: %s", err)
+	} else {
+		testServiceEquals(t, testService, unpackedService)
+
+		if unpackedService.FwMark != testService.FwMark {
+			t.Errorf("fail Service.FwMark: %d", unpackedService.FwMark)
+		}
+		if unpackedService.String() != "inet6+fwmark://42" {
+			t.Errorf("fail Service.String(): %s", unpackedService.String())
+		}
+	}
+}
+
+func TestServicePEName(t *testing.T) {
+	testService := Service{
+		Af:        syscall.AF_INET,
+		FwMark:    5060,
+		SchedName: "rr",
+		Flags:     Flags{IP_VS_SVC_F_PERSISTENT, 0xffffffff},
+		Timeout:   300,
+		Netmask:   0xffffffff,
+		PEName:    "sip",
+	}
+	testBytes := []byte{
+		0x06, 0x00, 0x01, 0x00, // IPVS_SVC_ATTR_AF
+		0x02, 0x00, 0x00, 0x00, // 2
+		0x08, 0x00, 0x05, 0x00, 0xc4, 0x13, 0x00, 0x00, // IPVS_SVC_ATTR_FWMARK     5060
+		0x07, 0x00, 0x06, 0x00, 'r', 'r', 0x00, 0x00, // IPVS_SVC_ATTR_SCHED_NAME rr
+		0x0c, 0x00, 0x07, 0x00, 0x01, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, // IPVS_SVC_ATTR_FLAGS 1:ffffffff
+		0x08, 0x00, 0x08, 0x00, 0x2c, 0x01, 0x00, 0x00, // IPVS_SVC_ATTR_TIMEOUT    300
+		0x08, 0x00, 0x09, 0x00, 0xff, 0xff, 0xff, 0xff, // IPVS_SVC_ATTR_NETMASK    255.255.255.255
+		0x08, 0x00, 0x0b, 0x00, 's', 'i', 'p', 0x00, // IPVS_SVC_ATTR_PE_NAME    sip
+	}
+
+	// pack
+	if packBytes := testService.attrs(true).Bytes(); !bytes.Equal(packBytes, testBytes) {
+		t.Errorf("fail Service.attrs(): \n%s", hex.Dump(packBytes))
+	}
+
+	// unpack
+	if unpackedAttrs, err := ipvs_service_policy.Parse(testBytes); err != nil {
+		t.Fatalf("error ipvs_service_policy.Parse: %s", err)
+	} else if unpackedService, err := unpackService(unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackService: %s", err)
+	} else if unpackedService.PEName != "sip" {
+		t.Errorf("fail Service.PEName: %s", unpackedService.PEName)
+	} else if !unpackedService.Equals(testService) {
+		t.Errorf("fail Service.Equals: %+v", unpackedService)
+	}
+
+	// changing the persistence engine requires a SetService
+	otherService := testService
+	otherService.PEName = ""
+
+	if otherService.Equals(testService) {
+		t.Errorf("fail Service.Equals: PEName")
+	}
+}
+
+func TestServiceFlags(t *testing.T) {
+	testFlags := Flags{IP_VS_SVC_F_PERSISTENT | IP_VS_SVC_F_HASHED, 0xffffffff}
+	testBytes := []byte{0x03, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff}
+
+	if packBytes := pack(&testFlags); !bytes.Equal(packBytes, testBytes) {
+		t.Errorf("fail pack(Flags): \n%s", hex.Dump(packBytes))
+	}
+
+	var flags Flags
+
+	if err := unpack(testBytes, &flags); err != nil {
+		t.Errorf("error unpack(Flags): %s", err)
+	} else if flags != testFlags {
+		t.Errorf("fail unpack(Flags): %+v", flags)
+	}
+}
+
 func testDestEquals(t *testing.T, testDest Dest, dest Dest) {
 	if dest.Addr.String() != testDest.Addr.String() {
 		t.Errorf("fail testDest.unpack(): Addr %v", dest.Addr.String())
@@ -175,3 +370,209 @@ func TestDest(t *testing.T) {
 		testDestEquals(t, testDest, unpackedDest)
 	}
 }
+
+func TestDestMixed(t *testing.T) {
+	testService := Service{
+		Af: syscall.AF_INET,
+	}
+	testDest := Dest{
+		Af:   syscall.AF_INET6,
+		Addr: net.ParseIP("2001:db8:6b:6b::1"),
+		Port: 1337,
+
+		FwdMethod: IP_VS_CONN_F_TUNNEL,
+		Weight:    10,
+	}
+	testAttrs := nlgo.AttrSlice{
+		nlattr(IPVS_DEST_ATTR_ADDR_FAMILY, nlgo.U16(syscall.AF_INET6)),
+		nlattr(IPVS_DEST_ATTR_ADDR, nlgo.Binary([]byte{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x6b, 0x00, 0x6b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01})),
+		nlattr(IPVS_DEST_ATTR_PORT, nlgo.U16(0x3905)),
+	}
+
+	// pack
+	packBytes := testDest.attrs(&testService, false).Bytes()
+
+	if !bytes.Equal(packBytes, testAttrs.Bytes()) {
+		t.Errorf("fail Dest.attrs(): \n%s", hex.Dump(packBytes))
+	}
+
+	// unpack
+	if unpackedAttrs, err := ipvs_dest_policy.Parse(packBytes); err != nil {
+		t.Fatalf("error ipvs_dest_policy.Parse: %s", err)
+	} else if unpackedDest, err := unpackDest(testService, unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackDest: %s", err)
+	} else if unpackedDest.Af != syscall.AF_INET6 {
+		t.Errorf("fail Dest.Af: %v", unpackedDest.Af)
+	} else if unpackedDest.Addr.String() != "2001:db8:6b:6b::1" {
+		t.Errorf("fail Dest.Addr: %v", unpackedDest.Addr)
+	}
+
+	// the kernel also includes the attr for same-family dests
+	sameAttrs := nlgo.AttrSlice{
+		nlattr(IPVS_DEST_ATTR_ADDR_FAMILY, nlgo.U16(syscall.AF_INET)),
+		nlattr(IPVS_DEST_ATTR_ADDR, nlgo.Binary([]byte{10, 107, 107, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})),
+		nlattr(IPVS_DEST_ATTR_PORT, nlgo.U16(0x3905)),
+	}
+
+	if unpackedAttrs, err := ipvs_dest_policy.Parse(sameAttrs.Bytes()); err != nil {
+		t.Fatalf("error ipvs_dest_policy.Parse: %s", err)
+	} else if unpackedDest, err := unpackDest(testService, unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackDest: %s", err)
+	} else if unpackedDest.Af != 0 {
+		t.Errorf("fail Dest.Af: %v", unpackedDest.Af)
+	} else if unpackedDest.Addr.String() != "10.107.107.1" {
+		t.Errorf("fail Dest.Addr: %v", unpackedDest.Addr)
+	}
+}
+
+func TestDestTunnel(t *testing.T) {
+	testService := Service{
+		Af: syscall.AF_INET,
+	}
+	testDest := Dest{
+		Addr: net.IP{10, 107, 107, 1},
+		Port: 1337,
+
+		FwdMethod: IP_VS_CONN_F_TUNNEL,
+		Weight:    10,
+
+		TunType:  IP_VS_CONN_F_TUNNEL_TYPE_GUE,
+		TunPort:  6080,
+		TunFlags: IP_VS_TUNNEL_ENCAP_FLAG_CSUM,
+	}
+	testAttrs := nlgo.AttrSlice{
+		nlattr(IPVS_DEST_ATTR_ADDR, nlgo.Binary([]byte{10, 107, 107, 1})),
+		nlattr(IPVS_DEST_ATTR_PORT, nlgo.U16(0x3905)),
+		nlattr(IPVS_DEST_ATTR_FWD_METHOD, nlgo.U32(IP_VS_CONN_F_TUNNEL)),
+		nlattr(IPVS_DEST_ATTR_WEIGHT, nlgo.U32(10)),
+		nlattr(IPVS_DEST_ATTR_U_THRESH, nlgo.U32(0)),
+		nlattr(IPVS_DEST_ATTR_L_THRESH, nlgo.U32(0)),
+		nlattr(IPVS_DEST_ATTR_TUN_TYPE, nlgo.U8(IP_VS_CONN_F_TUNNEL_TYPE_GUE)),
+		nlattr(IPVS_DEST_ATTR_TUN_PORT, nlgo.U16(0xc017)),
+		nlattr(IPVS_DEST_ATTR_TUN_FLAGS, nlgo.U16(IP_VS_TUNNEL_ENCAP_FLAG_CSUM)),
+	}
+
+	// pack
+	packBytes := testDest.attrs(&testService, true).Bytes()
+
+	if !bytes.Equal(packBytes, testAttrs.Bytes()) {
+		t.Errorf("fail Dest.attrs(): \n%s", hex.Dump(packBytes))
+	}
+
+	// unpack
+	if unpackedAttrs, err := ipvs_dest_policy.Parse(packBytes); err != nil {
+		t.Fatalf("error ipvs_dest_policy.Parse: %s", err)
+	} else if unpackedDest, err := unpackDest(testService, unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackDest: %s", err)
+	} else if !unpackedDest.Equals(testDest) {
+		t.Errorf("fail Dest.Equals: %#v", unpackedDest)
+	} else if unpackedDest.TunPort != 6080 {
+		t.Errorf("fail Dest.TunPort: %v", unpackedDest.TunPort)
+	}
+
+	// ipip dests do not include the tunnel attrs
+	testDest.TunType = IP_VS_CONN_F_TUNNEL_TYPE_IPIP
+
+	if packBytes := testDest.attrs(&testService, true).Bytes(); !bytes.Equal(packBytes, testAttrs[:6].Bytes()) {
+		t.Errorf("fail Dest.attrs() ipip: \n%s", hex.Dump(packBytes))
+	}
+}
+
+// Dest attrs as dumped by a 5.2+ kernel, with the type numbers from the kernel uapi
+func TestDestKernelAttrs(t *testing.T) {
+	testService := Service{
+		Af: syscall.AF_INET,
+	}
+	testDest := Dest{
+		Addr: net.IP{10, 107, 107, 1},
+		Port: 1337,
+
+		FwdMethod: IP_VS_CONN_F_TUNNEL,
+		Weight:    10,
+
+		TunType:  IP_VS_CONN_F_TUNNEL_TYPE_GUE,
+		TunPort:  6080,
+		TunFlags: IP_VS_TUNNEL_ENCAP_FLAG_CSUM,
+	}
+	testBytes := []byte{
+		0x08, 0x00, 0x01, 0x00, 0x0a, 0x6b, 0x6b, 0x01, // IPVS_DEST_ATTR_ADDR       10.107.107.1
+		0x06, 0x00, 0x02, 0x00, 0x05, 0x39, 0x00, 0x00, // IPVS_DEST_ATTR_PORT       1337
+		0x08, 0x00, 0x03, 0x00, 0x02, 0x00, 0x00, 0x00, // IPVS_DEST_ATTR_FWD_METHOD tunnel
+		0x08, 0x00, 0x04, 0x00, 0x0a, 0x00, 0x00, 0x00, // IPVS_DEST_ATTR_WEIGHT     10
+		0x08, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, // IPVS_DEST_ATTR_U_THRESH   0
+		0x08, 0x00, 0x06, 0x00, 0x00, 0x00, 0x00, 0x00, // IPVS_DEST_ATTR_L_THRESH   0
+		0x05, 0x00, 0x0d, 0x00, 0x01, 0x00, 0x00, 0x00, // IPVS_DEST_ATTR_TUN_TYPE   gue
+		0x06, 0x00, 0x0e, 0x00, 0x17, 0xc0, 0x00, 0x00, // IPVS_DEST_ATTR_TUN_PORT   6080
+		0x06, 0x00, 0x0f, 0x00, 0x01, 0x00, 0x00, 0x00, // IPVS_DEST_ATTR_TUN_FLAGS  csum
+	}
+	dumpBytes := append([]byte{
+		0x06, 0x00, 0x0b, 0x00, 0x02, 0x00, 0x00, 0x00, // IPVS_DEST_ATTR_ADDR_FAMILY  inet
+		0x08, 0x00, 0x07, 0x00, 0x02, 0x00, 0x00, 0x00, // IPVS_DEST_ATTR_ACTIVE_CONNS 2
+		0x10, 0x00, 0x0c, 0x00, // IPVS_DEST_ATTR_STATS64
+		0x0c, 0x00, 0x01, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // IPVS_STATS_ATTR_CONNS 5
+	}, testBytes...)
+
+	// pack
+	if packBytes := testDest.attrs(&testService, true).Bytes(); !bytes.Equal(packBytes, testBytes) {
+		t.Errorf("fail Dest.attrs(): \n%s", hex.Dump(packBytes))
+	}
+
+	// unpack
+	if unpackedAttrs, err := ipvs_dest_policy.Parse(dumpBytes); err != nil {
+		t.Fatalf("error ipvs_dest_policy.Parse: %s", err)
+	} else if unpackedDest, err := unpackDest(testService, unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackDest: %s", err)
+	} else if !unpackedDest.Equals(testDest) {
+		t.Errorf("fail Dest.Equals: %#v", unpackedDest)
+	} else if unpackedDest.ActiveConns != 2 {
+		t.Errorf("fail Dest.ActiveConns: %v", unpackedDest.ActiveConns)
+	}
+}
+
+func TestDestStats(t *testing.T) {
+	testService := Service{
+		Af: syscall.AF_INET,
+	}
+	testStats := Stats{
+		Conns:    5,
+		InPkts:   100,
+		OutPkts:  90,
+		InBytes:  1 << 33,
+		OutBytes: 12345,
+		CPS:      1,
+		InPPS:    10,
+		OutPPS:   9,
+		InBPS:    1000,
+		OutBPS:   900,
+	}
+	testAttrs := nlgo.AttrSlice{
+		nlattr(IPVS_DEST_ATTR_ADDR, nlgo.Binary([]byte{10, 107, 107, 1})),
+		nlattr(IPVS_DEST_ATTR_PORT, nlgo.U16(0x3905)),
+		nlattr(IPVS_DEST_ATTR_ACTIVE_CONNS, nlgo.U32(2)),
+		nlattr(IPVS_DEST_ATTR_STATS, nlgo.AttrSlice{
+			nlattr(IPVS_STATS_ATTR_CONNS, nlgo.U32(5)),
+			nlattr(IPVS_STATS_ATTR_INPKTS, nlgo.U32(100)),
+			nlattr(IPVS_STATS_ATTR_OUTPKTS, nlgo.U32(90)),
+			nlattr(IPVS_STATS_ATTR_INBYTES, nlgo.U64(1<<33)),
+			nlattr(IPVS_STATS_ATTR_OUTBYTES, nlgo.U64(12345)),
+			nlattr(IPVS_STATS_ATTR_CPS, nlgo.U32(1)),
+			nlattr(IPVS_STATS_ATTR_INPPS, nlgo.U32(10)),
+			nlattr(IPVS_STATS_ATTR_OUTPPS, nlgo.U32(9)),
+			nlattr(IPVS_STATS_ATTR_INBPS, nlgo.U32(1000)),
+			nlattr(IPVS_STATS_ATTR_OUTBPS, nlgo.U32(900)),
+		}),
+	}
+
+	if unpackedAttrs, err := ipvs_dest_policy.Parse(testAttrs.Bytes()); err != nil {
+		t.Fatalf("error ipvs_dest_policy.Parse: %s", err)
+	} else if unpackedDest, err := unpackDest(testService, unpackedAttrs.(nlgo.AttrMap)); err != nil {
+		t.Fatalf("error unpackDest: %s", err)
+	} else {
+		if unpackedDest.ActiveConns != 2 {
+			t.Errorf("fail Dest.ActiveConns: %v", unpackedDest.ActiveConns)
+		}
+		if unpackedDest.Stats != testStats {
+			t.Errorf("fail Dest.Stats: %+v", unpackedDest.Stats)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package ipvs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/hkwi/nlgo"
+	"syscall"
+	"time"
+)
+
+// Maximum number of requests written at once, limited by the socket buffer for any returned errors
+const batchSize = 256
+
+// Maximum time to wait for the kernel to ack a batch, before giving up on any lost acks
+const batchTimeout = 10 * time.Second
+
+type batchCommand struct {
+	cmd     uint8
+	command command
+}
+
+func (batchCommand batchCommand) request() Request {
+	return Request{
+		Cmd:   batchCommand.cmd,
+		Attrs: batchCommand.command.attrs(),
+	}
+}
+
+// Execute the command using the non-batched interface
+func (batchCommand batchCommand) exec(client Interface) error {
+	var service = batchCommand.command.service
+	var dest = batchCommand.command.dest
+
+	switch batchCommand.cmd {
+	case IPVS_CMD_NEW_SERVICE:
+		return client.NewService(*service)
+	case IPVS_CMD_SET_SERVICE:
+		return client.SetService(*service)
+	case IPVS_CMD_DEL_SERVICE:
+		return client.DelService(*service)
+	case IPVS_CMD_NEW_DEST:
+		return client.NewDest(*service, *dest)
+	case IPVS_CMD_SET_DEST:
+		return client.SetDest(*service, *dest)
+	case IPVS_CMD_DEL_DEST:
+		return client.DelDest(*service, *dest)
+	default:
+		return fmt.Errorf("Invalid batch cmd: %d", batchCommand.cmd)
+	}
+}
+
+// Pipelined service and dest commands, executed using a single netlink write per batchSize
+type Batch struct {
+	commands []batchCommand
+}
+
+func (batch *Batch) add(cmd uint8, command command) {
+	batch.commands = append(batch.commands, batchCommand{cmd, command})
+}
+
+func (batch *Batch) Len() int {
+	return len(batch.commands)
+}
+
+// Execute the batched commands one at a time, returning an error for each command
+func (batch *Batch) Exec(client Interface) []error {
+	var errors = make([]error, len(batch.commands))
+
+	for i, batchCommand := range batch.commands {
+		errors[i] = batchCommand.exec(client)
+	}
+
+	return errors
+}
+
+func (batch *Batch) NewService(service Service) {
+	batch.add(IPVS_CMD_NEW_SERVICE, command{service: &service, serviceFull: true})
+}
+
+func (batch *Batch) SetService(service Service) {
+	batch.add(IPVS_CMD_SET_SERVICE, command{service: &service, serviceFull: true})
+}
+
+func (batch *Batch) DelService(service Service) {
+	batch.add(IPVS_CMD_DEL_SERVICE, command{service: &service})
+}
+
+func (batch *Batch) NewDest(service Service, dest Dest) {
+	batch.add(IPVS_CMD_NEW_DEST, command{service: &service, dest: &dest, destFull: true})
+}
+
+func (batch *Batch) SetDest(service Service, dest Dest) {
+	batch.add(IPVS_CMD_SET_DEST, command{service: &service, dest: &dest, destFull: true})
+}
+
+func (batch *Batch) DelDest(service Service, dest Dest) {
+	batch.add(IPVS_CMD_DEL_DEST, command{service: &service, dest: &dest})
+}
+
+// Kernel IPVS state supporting batched commands.
+//
+// Returns an error for each batched command, or an error if the batch could not be executed.
+type Batcher interface {
+	ExecBatch(batch *Batch) ([]error, error)
+}
+
+// Kernel IPVS state supporting concurrent dest dumps.
+//
+// Returns the dests for each service.
+type DestsLister interface {
+	ListServicesDests(services []Service) ([][]Dest, error)
+}
+
+// Raw netlink socket, used to write multiple genl requests at once, and correlate the acks by seq
+type batchSocket struct {
+	fd  int
+	seq uint32
+}
+
+func openBatchSocket() (*batchSocket, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_GENERIC)
+	if err != nil {
+		return nil, fmt.Errorf("socket: %v", err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+
+		return nil, fmt.Errorf("bind: %v", err)
+	}
+
+	// fail instead of blocking forever on any lost acks
+	var timeout = syscall.NsecToTimeval(batchTimeout.Nanoseconds())
+
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+
+		return nil, fmt.Errorf("setsockopt SO_RCVTIMEO: %v", err)
+	}
+
+	return &batchSocket{
+		fd:  fd,
+		seq: uint32(time.Now().Unix()),
+	}, nil
+}
+
+func (sock *batchSocket) close() error {
+	return syscall.Close(sock.fd)
+}
+
+// Pack a genl request as a netlink message requesting an ack
+func packBatchRequest(familyID uint16, seq uint32, request Request) []byte {
+	attrs := request.Attrs.Bytes()
+	length := syscall.NLMSG_HDRLEN + 4 + len(attrs)
+	buf := make([]byte, (length+syscall.NLMSG_ALIGNTO-1) & ^(syscall.NLMSG_ALIGNTO-1))
+
+	// struct nlmsghdr
+	binary.NativeEndian.PutUint32(buf[0:4], uint32(length))
+	binary.NativeEndian.PutUint16(buf[4:6], familyID)
+	binary.NativeEndian.PutUint16(buf[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK|request.Flags)
+	binary.NativeEndian.PutUint32(buf[8:12], seq)
+	binary.NativeEndian.PutUint32(buf[12:16], 0)
+
+	// struct genlmsghdr
+	buf[16] = request.Cmd
+	buf[17] = IPVS_GENL_VERSION
+
+	copy(buf[20:], attrs)
+
+	return buf
+}
+
+// Write the requests, and wait for an ack for each request
+func (sock *batchSocket) exec(familyID uint16, requests []Request, errors []error) error {
+	var buf []byte
+	var seq = sock.seq
+
+	for _, request := range requests {
+		sock.seq++
+
+		buf = append(buf, packBatchRequest(familyID, sock.seq, request)...)
+	}
+
+	if err := syscall.Sendto(sock.fd, buf, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return fmt.Errorf("sendto: %v", err)
+	}
+
+	var recvBuf = make([]byte, 65536)
+
+	for pending := len(requests); pending > 0; {
+		n, _, err := syscall.Recvfrom(sock.fd, recvBuf, 0)
+		if err != nil {
+			return fmt.Errorf("recvfrom: %v", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(recvBuf[:n])
+		if err != nil {
+			return fmt.Errorf("recvfrom: %v", err)
+		}
+
+		for _, msg := range msgs {
+			// seq of the first request is seq+1
+			index := msg.Header.Seq - seq - 1
+
+			if index >= uint32(len(requests)) {
+				// stale
+				continue
+			} else if msg.Header.Type != syscall.NLMSG_ERROR || len(msg.Data) < 4 {
+				continue
+			}
+
+			// struct nlmsgerr
+			if errno := int32(binary.NativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+				errors[index] = syscall.Errno(-errno)
+			}
+
+			pending--
+		}
+	}
+
+	return nil
+}
+
+// Write a dump request, and pass the genl payload of each response message to the handler until done
+func (sock *batchSocket) dump(familyID uint16, request Request, handler func(data []byte) error) error {
+	sock.seq++
+
+	var seq = sock.seq
+
+	if err := syscall.Sendto(sock.fd, packBatchRequest(familyID, seq, request), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return fmt.Errorf("sendto: %v", err)
+	}
+
+	var recvBuf = make([]byte, 65536)
+
+	for {
+		n, _, err := syscall.Recvfrom(sock.fd, recvBuf, 0)
+		if err != nil {
+			return fmt.Errorf("recvfrom: %v", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(recvBuf[:n])
+		if err != nil {
+			return fmt.Errorf("recvfrom: %v", err)
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq {
+				// stale
+				continue
+			} else if msg.Header.Type == syscall.NLMSG_ERROR || msg.Header.Type == syscall.NLMSG_DONE {
+				// struct nlmsgerr, or the dump errno
+				if len(msg.Data) < 4 {
+
+				} else if errno := int32(binary.NativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+					return syscall.Errno(-errno)
+				}
+
+				if msg.Header.Type == syscall.NLMSG_DONE {
+					return nil
+				}
+			} else if len(msg.Data) < 4 {
+				return fmt.Errorf("recvfrom: short genl message")
+			} else if err := handler(msg.Data[4:]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Execute the batched commands
+func (client *Client) ExecBatch(batch *Batch) ([]error, error) {
+	var requests = make([]Request, len(batch.commands))
+	var errors = make([]error, len(batch.commands))
+
+	for i, batchCommand := range batch.commands {
+		requests[i] = batchCommand.request()
+	}
+
+	if client.batchSocket != nil {
+
+	} else if err := withNetns(client.netns, func() (err error) {
+		client.batchSocket, err = openBatchSocket()
+		return
+	}); err != nil {
+		return nil, fmt.Errorf("ipvs:Client.ExecBatch: %v", err)
+	}
+
+	for offset := 0; offset < len(requests); offset += batchSize {
+		var end = offset + batchSize
+
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		client.logDebug.Printf("Client.ExecBatch: %d requests", end-offset)
+
+		if err := client.batchSocket.exec(client.genlFamily.Id, requests[offset:end], errors[offset:end]); err != nil {
+			return nil, fmt.Errorf("ipvs:Client.ExecBatch: %v", err)
+		}
+	}
+
+	return errors, nil
+}
+
+// Number of concurrent dest dumps, each using a separate socket, as the kernel only runs one dump at a time per socket
+const dumpSockets = 8
+
+func (client *Client) dumpDests(sock *batchSocket, service Service) (dests []Dest, err error) {
+	request := Request{
+		Cmd:   IPVS_CMD_GET_DEST,
+		Flags: syscall.NLM_F_DUMP,
+		Attrs: command{service: &service}.attrs(),
+	}
+
+	err = sock.dump(client.genlFamily.Id, request, func(data []byte) error {
+		if attrsValue, err := ipvs_cmd_policy.Parse(data); err != nil {
+			return fmt.Errorf("Invalid response: %v", err)
+		} else if cmdAttrs, ok := attrsValue.(nlgo.AttrMap); !ok {
+			return fmt.Errorf("Invalid attrs value: %v", attrsValue)
+		} else if dest, err := unpackCmdDest(service, cmdAttrs); err != nil {
+			return err
+		} else {
+			dests = append(dests, dest)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// List the dests for each service, using concurrent dumps instead of one round-trip per service
+func (client *Client) ListServicesDests(services []Service) ([][]Dest, error) {
+	var serviceDests = make([][]Dest, len(services))
+	var sockets []*batchSocket
+
+	defer func() {
+		for _, sock := range sockets {
+			sock.close()
+		}
+	}()
+
+	if err := withNetns(client.netns, func() error {
+		for i := 0; i < dumpSockets && i < len(services); i++ {
+			if sock, err := openBatchSocket(); err != nil {
+				return err
+			} else {
+				sockets = append(sockets, sock)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("ipvs:Client.ListServicesDests: %v", err)
+	}
+
+	client.logDebug.Printf("Client.ListServicesDests: %d services using %d sockets", len(services), len(sockets))
+
+	var indexChan = make(chan int)
+	var errChan = make(chan error, len(sockets))
+
+	for _, sock := range sockets {
+		go func(sock *batchSocket) {
+			var err error
+
+			for i := range indexChan {
+				if err != nil {
+					// drain
+				} else if serviceDests[i], err = client.dumpDests(sock, services[i]); err != nil {
+					err = fmt.Errorf("%v: %v", services[i], err)
+				}
+			}
+
+			errChan <- err
+		}(sock)
+	}
+
+	for i := range services {
+		indexChan <- i
+	}
+	close(indexChan)
+
+	var err error
+
+	for range sockets {
+		if sockErr := <-errChan; sockErr != nil && err == nil {
+			err = sockErr
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("ipvs:Client.ListServicesDests: %v", err)
+	}
+
+	return serviceDests, nil
+}
@@ -0,0 +1,218 @@
+package ipvs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestBatchRequest(t *testing.T) {
+	var batch Batch
+	var service = Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80}
+	var dest = Dest{Addr: net.IP{10, 1, 0, 1}, Port: 8080, Weight: 10}
+
+	batch.NewDest(service, dest)
+	batch.DelService(service)
+
+	var buf []byte
+
+	for i, batchCommand := range batch.commands {
+		buf = append(buf, packBatchRequest(0x10, uint32(100+i), batchCommand.request())...)
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(buf)
+	if err != nil {
+		t.Fatalf("ParseNetlinkMessage: %v\n%s", err, hex.Dump(buf))
+	}
+
+	var testMsgs = []struct {
+		cmd   uint8
+		attrs []byte
+	}{
+		{IPVS_CMD_NEW_DEST, command{service: &service, dest: &dest, destFull: true}.attrs().Bytes()},
+		{IPVS_CMD_DEL_SERVICE, command{service: &service}.attrs().Bytes()},
+	}
+
+	if len(msgs) != len(testMsgs) {
+		t.Fatalf("ParseNetlinkMessage: %d messages", len(msgs))
+	}
+
+	for i, test := range testMsgs {
+		var msg = msgs[i]
+
+		if msg.Header.Type != 0x10 {
+			t.Errorf("message %d type: %#04x", i, msg.Header.Type)
+		}
+		if msg.Header.Flags != syscall.NLM_F_REQUEST|syscall.NLM_F_ACK {
+			t.Errorf("message %d flags: %#04x", i, msg.Header.Flags)
+		}
+		if msg.Header.Seq != uint32(100+i) {
+			t.Errorf("message %d seq: %d", i, msg.Header.Seq)
+		}
+		if !bytes.Equal(msg.Data[0:4], []byte{test.cmd, IPVS_GENL_VERSION, 0, 0}) {
+			t.Errorf("message %d genl header: %v", i, msg.Data[0:4])
+		}
+		if !bytes.Equal(msg.Data[4:], test.attrs) {
+			t.Errorf("message %d attrs:\n%s", i, hex.Dump(msg.Data[4:]))
+		}
+	}
+}
+
+// Benchmark fwmark services with dests
+const benchmarkServices = 100
+const benchmarkDests = 10
+
+// Open a client within a throwaway network namespace, flushing any services left behind by a failed benchmark
+func openBenchmark(b *testing.B) (*Client, func()) {
+	netns, done := testNetns(b)
+
+	client, err := OpenNetns(netns)
+	if err != nil {
+		done()
+		b.Skipf("ipvs.OpenNetns: %v", err)
+	}
+
+	return client, func() {
+		if err := client.Flush(); err != nil {
+			b.Errorf("Flush: %v", err)
+		}
+
+		done()
+	}
+}
+
+func benchmarkService(i int) Service {
+	return Service{Af: syscall.AF_INET, FwMark: 0x0c1f0000 + uint32(i), SchedName: "wlc", Flags: Flags{0, 0xffffffff}, Netmask: 0xffffffff}
+}
+
+func benchmarkDest(i int) Dest {
+	return Dest{Addr: net.IP{10, 255, 0, byte(1 + i)}, FwdMethod: IP_VS_CONN_F_DROUTE, Weight: 10}
+}
+
+func BenchmarkExec(b *testing.B) {
+	client, done := openBenchmark(b)
+	defer done()
+
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < benchmarkServices; i++ {
+			if err := client.NewService(benchmarkService(i)); err != nil {
+				b.Fatalf("NewService: %v", err)
+			}
+
+			for j := 0; j < benchmarkDests; j++ {
+				if err := client.NewDest(benchmarkService(i), benchmarkDest(j)); err != nil {
+					b.Fatalf("NewDest: %v", err)
+				}
+			}
+		}
+
+		for i := 0; i < benchmarkServices; i++ {
+			if err := client.DelService(benchmarkService(i)); err != nil {
+				b.Fatalf("DelService: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkExecBatch(b *testing.B) {
+	client, done := openBenchmark(b)
+	defer done()
+
+	for n := 0; n < b.N; n++ {
+		var batch Batch
+
+		for i := 0; i < benchmarkServices; i++ {
+			batch.NewService(benchmarkService(i))
+
+			for j := 0; j < benchmarkDests; j++ {
+				batch.NewDest(benchmarkService(i), benchmarkDest(j))
+			}
+		}
+
+		for i := 0; i < benchmarkServices; i++ {
+			batch.DelService(benchmarkService(i))
+		}
+
+		if errors, err := client.ExecBatch(&batch); err != nil {
+			b.Fatalf("ExecBatch: %v", err)
+		} else {
+			for i, err := range errors {
+				if err != nil {
+					b.Fatalf("ExecBatch %d: %v", i, err)
+				}
+			}
+		}
+	}
+}
+
+// Create the benchmark services with dests, returning the services as listed
+func setupBenchmarkDests(b *testing.B, client *Client) []Service {
+	var batch Batch
+
+	for i := 0; i < benchmarkServices; i++ {
+		batch.NewService(benchmarkService(i))
+
+		for j := 0; j < benchmarkDests; j++ {
+			batch.NewDest(benchmarkService(i), benchmarkDest(j))
+		}
+	}
+
+	if errors, err := client.ExecBatch(&batch); err != nil {
+		b.Fatalf("ExecBatch: %v", err)
+	} else {
+		for i, err := range errors {
+			if err != nil {
+				b.Fatalf("ExecBatch %d: %v", i, err)
+			}
+		}
+	}
+
+	services, err := client.ListServices()
+	if err != nil {
+		b.Fatalf("ListServices: %v", err)
+	}
+
+	return services
+}
+
+func BenchmarkListDests(b *testing.B) {
+	client, done := openBenchmark(b)
+	defer done()
+
+	var services = setupBenchmarkDests(b, client)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for _, service := range services {
+			if dests, err := client.ListDests(service); err != nil {
+				b.Fatalf("ListDests: %v", err)
+			} else if len(dests) != benchmarkDests {
+				b.Fatalf("ListDests %v: %d dests", service, len(dests))
+			}
+		}
+	}
+}
+
+func BenchmarkListServicesDests(b *testing.B) {
+	client, done := openBenchmark(b)
+	defer done()
+
+	var services = setupBenchmarkDests(b, client)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if serviceDests, err := client.ListServicesDests(services); err != nil {
+			b.Fatalf("ListServicesDests: %v", err)
+		} else {
+			for i, dests := range serviceDests {
+				if len(dests) != benchmarkDests {
+					b.Fatalf("ListServicesDests %v: %d dests", services[i], len(dests))
+				}
+			}
+		}
+	}
+}
@@ -14,12 +14,25 @@ type Client struct {
 	genlHub    *nlgo.GenlHub
 	genlFamily nlgo.GenlFamily
 
+	// network namespace path, or empty for the current network namespace
+	netns string
+
+	// opened on first ExecBatch
+	batchSocket *batchSocket
+
 	logDebug   *log.Logger
 	logWarning *log.Logger
 }
 
+// Open the IPVS state in the current network namespace
 func Open() (*Client, error) {
+	return OpenNetns("")
+}
+
+// Open the IPVS state in the given network namespace, by name or path, see NetnsPath
+func OpenNetns(netns string) (*Client, error) {
 	client := &Client{
+		netns:      NetnsPath(netns),
 		logDebug:   log.New(ioutil.Discard, "DEBUG ipvs:", 0),
 		logWarning: log.New(os.Stderr, "WARN ipvs:", 0),
 	}
@@ -32,10 +45,11 @@ func Open() (*Client, error) {
 }
 
 func (self *Client) init() error {
-	if genlHub, err := nlgo.NewGenlHub(); err != nil {
+	if err := withNetns(self.netns, func() (err error) {
+		self.genlHub, err = nlgo.NewGenlHub()
+		return
+	}); err != nil {
 		return err
-	} else {
-		self.genlHub = genlHub
 	}
 
 	// lookup family
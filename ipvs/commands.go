@@ -12,6 +12,9 @@ type command struct {
 
 	dest     *Dest
 	destFull bool
+
+	daemon     *Daemon
+	daemonFull bool
 }
 
 func (self command) attrs() nlgo.AttrSlice {
@@ -25,6 +28,10 @@ func (self command) attrs() nlgo.AttrSlice {
 		attrs = append(attrs, nlattr(IPVS_CMD_ATTR_DEST, self.dest.attrs(self.service, self.destFull)))
 	}
 
+	if self.daemon != nil {
+		attrs = append(attrs, nlattr(IPVS_CMD_ATTR_DAEMON, self.daemon.attrs(self.daemonFull)))
+	}
+
 	return attrs
 }
 
@@ -99,9 +106,7 @@ func (client *Client) ListDests(service Service) (dests []Dest, err error) {
 	}
 
 	err = client.request(request, ipvs_cmd_policy, func(cmdAttrs nlgo.AttrMap) error {
-		if destAttrs := cmdAttrs.Get(IPVS_CMD_ATTR_DEST); destAttrs == nil {
-			return fmt.Errorf("IPVS_CMD_GET_DEST without IPVS_CMD_ATTR_DEST")
-		} else if dest, err := unpackDest(service, destAttrs.(nlgo.AttrMap)); err != nil {
+		if dest, err := unpackCmdDest(service, cmdAttrs); err != nil {
 			return err
 		} else {
 			dests = append(dests, dest)
@@ -113,6 +118,14 @@ func (client *Client) ListDests(service Service) (dests []Dest, err error) {
 	return
 }
 
+func unpackCmdDest(service Service, cmdAttrs nlgo.AttrMap) (Dest, error) {
+	if destAttrs := cmdAttrs.Get(IPVS_CMD_ATTR_DEST); destAttrs == nil {
+		return Dest{}, fmt.Errorf("IPVS_CMD_GET_DEST without IPVS_CMD_ATTR_DEST")
+	} else {
+		return unpackDest(service, destAttrs.(nlgo.AttrMap))
+	}
+}
+
 func (client *Client) GetInfo() (info Info, err error) {
 	request := Request{
 		Cmd: IPVS_CMD_GET_INFO,
@@ -131,6 +144,84 @@ func (client *Client) GetInfo() (info Info, err error) {
 	return
 }
 
+func (client *Client) NewDaemon(daemon Daemon) error {
+	return client.exec(Request{
+		Cmd:   IPVS_CMD_NEW_DAEMON,
+		Attrs: command{daemon: &daemon, daemonFull: true}.attrs(),
+	})
+}
+
+func (client *Client) DelDaemon(daemon Daemon) error {
+	return client.exec(Request{
+		Cmd:   IPVS_CMD_DEL_DAEMON,
+		Attrs: command{daemon: &daemon}.attrs(),
+	})
+}
+
+func (client *Client) ListDaemons() (daemons []Daemon, err error) {
+	request := Request{
+		Cmd:   IPVS_CMD_GET_DAEMON,
+		Flags: syscall.NLM_F_DUMP,
+	}
+
+	err = client.request(request, ipvs_cmd_policy, func(cmdAttrs nlgo.AttrMap) error {
+		if daemonAttrs := cmdAttrs.Get(IPVS_CMD_ATTR_DAEMON); daemonAttrs == nil {
+			return fmt.Errorf("IPVS_CMD_GET_DAEMON without IPVS_CMD_ATTR_DAEMON")
+		} else if daemon, err := unpackDaemon(daemonAttrs.(nlgo.AttrMap)); err != nil {
+			return err
+		} else {
+			daemons = append(daemons, daemon)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (client *Client) GetTimeouts() (timeouts Timeouts, err error) {
+	request := Request{
+		Cmd: IPVS_CMD_GET_TIMEOUT,
+	}
+
+	err = client.request(request, ipvs_cmd_policy, func(cmdAttrs nlgo.AttrMap) error {
+		if cmdTimeouts, err := unpackTimeouts(cmdAttrs); err != nil {
+			return err
+		} else {
+			timeouts = cmdTimeouts
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (client *Client) SetTimeouts(timeouts Timeouts) error {
+	return client.exec(Request{
+		Cmd:   IPVS_CMD_SET_TIMEOUT,
+		Attrs: timeouts.attrs(),
+	})
+}
+
+// Zero the counters and stats for the service and its dests, or all services if nil
+func zeroRequest(service *Service) Request {
+	return Request{
+		Cmd:   IPVS_CMD_ZERO,
+		Attrs: command{service: service}.attrs(),
+	}
+}
+
+// Zero the counters and stats for all services
+func (client *Client) Zero() error {
+	return client.exec(zeroRequest(nil))
+}
+
+// Zero the counters and stats for the given service and its dests
+func (client *Client) ZeroService(service Service) error {
+	return client.exec(zeroRequest(&service))
+}
+
 func (client *Client) Flush() error {
 	return client.exec(Request{Cmd: IPVS_CMD_FLUSH})
 }
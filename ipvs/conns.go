@@ -0,0 +1,221 @@
+package ipvs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Kernel IPVS connection table, including persistence templates
+const ConnsPath = "/proc/net/ip_vs_conn"
+
+// Connection or persistence template in the kernel IPVS connection table
+type Conn struct {
+	Af         Af
+	Protocol   Protocol // zero for fwmark templates
+	ClientAddr net.IP
+	ClientPort uint16
+	Addr       net.IP // virtual address, unset for fwmark templates
+	Port       uint16
+	FwMark     uint32 // fwmark templates only
+	DestAf     Af
+	DestAddr   net.IP
+	DestPort   uint16
+
+	State   string
+	Expires time.Duration
+
+	// persistence engine data
+	PEName string
+	PEData string
+
+	// persistence template, without any client port
+	Template bool
+}
+
+func (conn Conn) String() string {
+	return fmt.Sprintf("%v %s -> %s -> %s", conn.Protocol, conn.clientString(), conn.virtualString(), conn.destString())
+}
+
+func (conn Conn) clientString() string {
+	return net.JoinHostPort(conn.ClientAddr.String(), strconv.Itoa(int(conn.ClientPort)))
+}
+
+func (conn Conn) virtualString() string {
+	if conn.FwMark != 0 {
+		return fmt.Sprintf("fwmark:%d", conn.FwMark)
+	} else {
+		return net.JoinHostPort(conn.Addr.String(), strconv.Itoa(int(conn.Port)))
+	}
+}
+
+func (conn Conn) destString() string {
+	return net.JoinHostPort(conn.DestAddr.String(), strconv.Itoa(int(conn.DestPort)))
+}
+
+// Identify the Service for the connection
+func (conn Conn) Service() Service {
+	if conn.FwMark != 0 {
+		return Service{Af: conn.Af, FwMark: conn.FwMark}
+	} else {
+		return Service{Af: conn.Af, Protocol: conn.Protocol, Addr: conn.Addr, Port: conn.Port}
+	}
+}
+
+// Identify the Dest for the connection
+func (conn Conn) Dest() Dest {
+	return Dest{Addr: conn.DestAddr, Port: conn.DestPort}
+}
+
+func parseConnProtocol(value string) (Protocol, error) {
+	switch value {
+	case "IP":
+		return 0, nil
+	case "TCP":
+		return syscall.IPPROTO_TCP, nil
+	case "UDP":
+		return syscall.IPPROTO_UDP, nil
+	case "SCTP":
+		return syscall.IPPROTO_SCTP, nil
+	default:
+		return 0, fmt.Errorf("Invalid protocol: %s", value)
+	}
+}
+
+// IPv4 addresses are given in hex, IPv6 addresses in the full colon-separated form, with dest addresses in brackets
+func parseConnAddr(value string) (Af, net.IP, error) {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		value = value[1 : len(value)-1]
+	}
+
+	if strings.Contains(value, ":") {
+		if ip := net.ParseIP(value); ip == nil {
+			return 0, nil, fmt.Errorf("Invalid IPv6 address: %s", value)
+		} else {
+			return syscall.AF_INET6, ip, nil
+		}
+	} else if buf, err := hex.DecodeString(value); err != nil || len(buf) != 4 {
+		return 0, nil, fmt.Errorf("Invalid IPv4 address: %s", value)
+	} else {
+		return syscall.AF_INET, net.IP(buf), nil
+	}
+}
+
+func parseConnPort(value string) (uint16, error) {
+	if port, err := strconv.ParseUint(value, 16, 16); err != nil {
+		return 0, fmt.Errorf("Invalid port: %s", value)
+	} else {
+		return uint16(port), nil
+	}
+}
+
+// Parse a line from the connection table:
+//
+//	Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData
+func parseConn(line string) (conn Conn, err error) {
+	var fields = strings.Fields(line)
+
+	if len(fields) < 9 {
+		return conn, fmt.Errorf("Invalid line: %s", line)
+	}
+
+	if conn.Protocol, err = parseConnProtocol(fields[0]); err != nil {
+		return
+	}
+	if conn.Af, conn.ClientAddr, err = parseConnAddr(fields[1]); err != nil {
+		return
+	}
+	if conn.ClientPort, err = parseConnPort(fields[2]); err != nil {
+		return
+	}
+	if _, conn.Addr, err = parseConnAddr(fields[3]); err != nil {
+		return
+	}
+	if conn.Port, err = parseConnPort(fields[4]); err != nil {
+		return
+	}
+	if conn.DestAf, conn.DestAddr, err = parseConnAddr(fields[5]); err != nil {
+		return
+	}
+	if conn.DestPort, err = parseConnPort(fields[6]); err != nil {
+		return
+	}
+
+	conn.State = fields[7]
+
+	if expires, err := strconv.ParseUint(fields[8], 10, 32); err != nil {
+		return conn, fmt.Errorf("Invalid expires: %s", fields[8])
+	} else {
+		conn.Expires = time.Duration(expires) * time.Second
+	}
+
+	if len(fields) > 9 {
+		conn.PEName = fields[9]
+	}
+	if len(fields) > 10 {
+		conn.PEData = strings.Join(fields[10:], " ")
+	}
+
+	conn.Template = (conn.ClientPort == 0)
+
+	if conn.Template && conn.Protocol == 0 {
+		// fwmark templates use the fwmark as the leading 32 bits of the virtual address
+		switch conn.Af {
+		case syscall.AF_INET:
+			conn.FwMark = binary.BigEndian.Uint32(conn.Addr.To4())
+		case syscall.AF_INET6:
+			conn.FwMark = binary.BigEndian.Uint32(conn.Addr.To16()[0:4])
+		}
+
+		conn.Addr = nil
+		conn.Port = 0
+	}
+
+	return conn, nil
+}
+
+// Parse the connection table
+func ParseConns(reader io.Reader) ([]Conn, error) {
+	var conns []Conn
+	var scanner = bufio.NewScanner(reader)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+
+		if lineNumber == 1 && strings.HasPrefix(line, "Pro ") {
+			// header
+			continue
+		} else if strings.TrimSpace(line) == "" {
+			continue
+		} else if conn, err := parseConn(line); err != nil {
+			return conns, fmt.Errorf("ipvs:ParseConns: line %d: %v", lineNumber, err)
+		} else {
+			conns = append(conns, conn)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return conns, fmt.Errorf("ipvs:ParseConns: %v", err)
+	}
+
+	return conns, nil
+}
+
+// Read the connection table from the given path, typically ConnsPath
+func ReadConns(path string) ([]Conn, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseConns(file)
+}
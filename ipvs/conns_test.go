@@ -0,0 +1,152 @@
+package ipvs
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReadConns(t *testing.T) {
+	conns, err := ReadConns("testdata/ip_vs_conn")
+	if err != nil {
+		t.Fatalf("ReadConns: %v", err)
+	}
+
+	var testConns = []Conn{
+		{
+			Af:         syscall.AF_INET,
+			Protocol:   syscall.IPPROTO_TCP,
+			ClientAddr: net.IP{192, 168, 1, 100},
+			ClientPort: 54321,
+			Addr:       net.IP{10, 0, 0, 1},
+			Port:       80,
+			DestAf:     syscall.AF_INET,
+			DestAddr:   net.IP{10, 1, 0, 1},
+			DestPort:   8080,
+			State:      "ESTABLISHED",
+			Expires:    899 * time.Second,
+		},
+		{
+			Af:         syscall.AF_INET,
+			Protocol:   syscall.IPPROTO_TCP,
+			ClientAddr: net.IP{192, 168, 1, 101},
+			ClientPort: 58020,
+			Addr:       net.IP{10, 0, 0, 1},
+			Port:       80,
+			DestAf:     syscall.AF_INET,
+			DestAddr:   net.IP{10, 1, 0, 2},
+			DestPort:   8080,
+			State:      "TIME_WAIT",
+			Expires:    59 * time.Second,
+		},
+		{
+			Af:         syscall.AF_INET,
+			Protocol:   syscall.IPPROTO_TCP,
+			ClientAddr: net.IP{192, 168, 1, 0},
+			Addr:       net.IP{10, 0, 0, 1},
+			Port:       443,
+			DestAf:     syscall.AF_INET,
+			DestAddr:   net.IP{10, 1, 0, 1},
+			DestPort:   443,
+			State:      "NONE",
+			Expires:    287 * time.Second,
+			Template:   true,
+		},
+		{
+			Af:         syscall.AF_INET,
+			ClientAddr: net.IP{192, 168, 1, 100},
+			FwMark:     42,
+			DestAf:     syscall.AF_INET,
+			DestAddr:   net.IP{10, 1, 0, 3},
+			State:      "NONE",
+			Expires:    120 * time.Second,
+			Template:   true,
+		},
+		{
+			Af:         syscall.AF_INET,
+			Protocol:   syscall.IPPROTO_UDP,
+			ClientAddr: net.IP{192, 168, 1, 102},
+			ClientPort: 5060,
+			Addr:       net.IP{10, 0, 0, 1},
+			Port:       5060,
+			DestAf:     syscall.AF_INET,
+			DestAddr:   net.IP{10, 1, 0, 1},
+			DestPort:   5060,
+			State:      "UDP",
+			Expires:    170 * time.Second,
+			PEName:     "sip",
+			PEData:     "3848276298220188511@192.168.1.102",
+		},
+		{
+			Af:         syscall.AF_INET,
+			Protocol:   syscall.IPPROTO_UDP,
+			ClientAddr: net.IP{192, 168, 1, 102},
+			Addr:       net.IP{10, 0, 0, 1},
+			Port:       5060,
+			DestAf:     syscall.AF_INET,
+			DestAddr:   net.IP{10, 1, 0, 1},
+			DestPort:   5060,
+			State:      "NONE",
+			Expires:    900 * time.Second,
+			PEName:     "sip",
+			PEData:     "3848276298220188511@192.168.1.102",
+			Template:   true,
+		},
+		{
+			Af:         syscall.AF_INET6,
+			Protocol:   syscall.IPPROTO_TCP,
+			ClientAddr: net.ParseIP("2001:db8::64"),
+			ClientPort: 54321,
+			Addr:       net.ParseIP("2001:db8::1"),
+			Port:       80,
+			DestAf:     syscall.AF_INET6,
+			DestAddr:   net.ParseIP("2001:db8:1::1"),
+			DestPort:   8080,
+			State:      "SYN_RECV",
+			Expires:    30 * time.Second,
+		},
+		{
+			Af:         syscall.AF_INET,
+			Protocol:   syscall.IPPROTO_TCP,
+			ClientAddr: net.IP{192, 168, 1, 103},
+			ClientPort: 50000,
+			Addr:       net.IP{10, 0, 0, 1},
+			Port:       80,
+			DestAf:     syscall.AF_INET6,
+			DestAddr:   net.ParseIP("2001:db8:ff::1"),
+			DestPort:   80,
+			State:      "ESTABLISHED",
+			Expires:    900 * time.Second,
+		},
+	}
+
+	if diff := pretty.Compare(testConns, conns); diff != "" {
+		t.Errorf("ReadConns:\n%s", diff)
+	}
+
+	if str := conns[0].String(); str != "tcp 192.168.1.100:54321 -> 10.0.0.1:80 -> 10.1.0.1:8080" {
+		t.Errorf("Conn.String: %s", str)
+	}
+	if str := conns[0].Service().String(); str != "inet+tcp://10.0.0.1:80" {
+		t.Errorf("Conn.Service: %s", str)
+	}
+	if str := conns[3].Service().String(); str != "inet+fwmark://42" {
+		t.Errorf("Conn.Service: %s", str)
+	}
+}
+
+func TestParseConnsError(t *testing.T) {
+	for _, line := range []string{
+		"TCP C0A80164 D431 0A000001 0050 0A010001 1F90 ESTABLISHED",
+		"FOO C0A80164 D431 0A000001 0050 0A010001 1F90 ESTABLISHED     899",
+		"TCP C0A801 D431 0A000001 0050 0A010001 1F90 ESTABLISHED     899",
+		"TCP C0A80164 XXXX 0A000001 0050 0A010001 1F90 ESTABLISHED     899",
+	} {
+		if _, err := ParseConns(strings.NewReader(line)); err == nil {
+			t.Errorf("ParseConns %#v: expected error", line)
+		}
+	}
+}
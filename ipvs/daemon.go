@@ -0,0 +1,89 @@
+package ipvs
+
+import (
+	"fmt"
+	"github.com/hkwi/nlgo"
+)
+
+type DaemonState uint32
+
+func (self DaemonState) String() string {
+	switch self {
+	case IP_VS_STATE_MASTER:
+		return "master"
+	case IP_VS_STATE_BACKUP:
+		return "backup"
+	default:
+		return fmt.Sprintf("%#04x", uint32(self))
+	}
+}
+
+func ParseDaemonState(value string) (DaemonState, error) {
+	switch value {
+	case "master":
+		return IP_VS_STATE_MASTER, nil
+	case "backup":
+		return IP_VS_STATE_BACKUP, nil
+	default:
+		return 0, fmt.Errorf("Invalid DaemonState: %s", value)
+	}
+}
+
+// github.com/jessevdk/go-flags:Unmarshaler
+func (daemonState *DaemonState) UnmarshalFlag(value string) error {
+	if parsed, err := ParseDaemonState(value); err != nil {
+		return err
+	} else {
+		*daemonState = parsed
+
+		return nil
+	}
+}
+
+// Connection sync daemon; the kernel runs at most one master and one backup daemon
+type Daemon struct {
+	// id
+	State DaemonState
+
+	// params
+	McastIfn string
+	SyncID   uint32
+}
+
+func (self Daemon) String() string {
+	return fmt.Sprintf("%v@%s/%d", self.State, self.McastIfn, self.SyncID)
+}
+
+func unpackDaemon(attrs nlgo.AttrMap) (Daemon, error) {
+	var daemon Daemon
+
+	for _, attr := range attrs.Slice() {
+		switch attr.Field() {
+		case IPVS_DAEMON_ATTR_STATE:
+			daemon.State = (DaemonState)(attr.Value.(nlgo.U32))
+		case IPVS_DAEMON_ATTR_MCAST_IFN:
+			daemon.McastIfn = (string)(attr.Value.(nlgo.NulString))
+		case IPVS_DAEMON_ATTR_SYNC_ID:
+			daemon.SyncID = (uint32)(attr.Value.(nlgo.U32))
+		}
+	}
+
+	return daemon, nil
+}
+
+// Pack Daemon to a set of nlattrs.
+// If full is given, include daemon settings, otherwise only the identifying state is given.
+func (self *Daemon) attrs(full bool) nlgo.AttrSlice {
+	var attrs = nlgo.AttrSlice{
+		nlattr(IPVS_DAEMON_ATTR_STATE, nlgo.U32(self.State)),
+	}
+
+	if full {
+		attrs = append(attrs,
+			nlattr(IPVS_DAEMON_ATTR_MCAST_IFN, nlgo.NulString(self.McastIfn)),
+			nlattr(IPVS_DAEMON_ATTR_SYNC_ID, nlgo.U32(self.SyncID)),
+		)
+	}
+
+	return attrs
+}
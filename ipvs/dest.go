@@ -49,9 +49,50 @@ func (fwdMethod *FwdMethod) UnmarshalFlag(value string) error {
 	}
 }
 
+// Encapsulation for tunnel dests
+type TunType uint8
+
+func (tunType TunType) String() string {
+	switch tunType {
+	case IP_VS_CONN_F_TUNNEL_TYPE_IPIP:
+		return "ipip"
+	case IP_VS_CONN_F_TUNNEL_TYPE_GUE:
+		return "gue"
+	case IP_VS_CONN_F_TUNNEL_TYPE_GRE:
+		return "gre"
+	default:
+		return fmt.Sprintf("%d", uint8(tunType))
+	}
+}
+
+func ParseTunType(value string) (TunType, error) {
+	switch value {
+	case "ipip":
+		return IP_VS_CONN_F_TUNNEL_TYPE_IPIP, nil
+	case "gue":
+		return IP_VS_CONN_F_TUNNEL_TYPE_GUE, nil
+	case "gre":
+		return IP_VS_CONN_F_TUNNEL_TYPE_GRE, nil
+	default:
+		return 0, fmt.Errorf("Invalid TunType: %s", value)
+	}
+}
+
+// Checksum flags for GUE/GRE tunnel dests
+func ParseTunFlag(value string) (uint16, error) {
+	switch value {
+	case "csum":
+		return IP_VS_TUNNEL_ENCAP_FLAG_CSUM, nil
+	case "remcsum":
+		return IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM, nil
+	default:
+		return 0, fmt.Errorf("Invalid TunFlag: %s", value)
+	}
+}
+
 type Dest struct {
 	// id
-	// TODO: IPVS_DEST_ATTR_ADDR_FAMILY
+	Af   Af // zero for the Service Af
 	Addr net.IP
 	Port uint16
 
@@ -61,10 +102,16 @@ type Dest struct {
 	UThresh   uint32
 	LThresh   uint32
 
+	// tunnel encapsulation, zero for ipip
+	TunType  TunType
+	TunPort  uint16
+	TunFlags uint16
+
 	// info
 	ActiveConns  uint32
 	InactConns   uint32
 	PersistConns uint32
+	Stats        Stats
 }
 
 // Acts as an unique identifier for the Service
@@ -101,15 +148,22 @@ func (dest Dest) Equals(other Dest) bool {
 		return false
 	}
 
+	if dest.TunType != other.TunType || dest.TunPort != other.TunPort || dest.TunFlags != other.TunFlags {
+		return false
+	}
+
 	return true
 }
 
 func unpackDest(service Service, attrs nlgo.AttrMap) (Dest, error) {
 	var dest Dest
 	var addr []byte
+	var af = service.Af
 
 	for _, attr := range attrs.Slice() {
 		switch attr.Field() {
+		case IPVS_DEST_ATTR_ADDR_FAMILY:
+			af = (Af)(attr.Value.(nlgo.U16))
 		case IPVS_DEST_ATTR_ADDR:
 			addr = ([]byte)(attr.Value.(nlgo.Binary))
 		case IPVS_DEST_ATTR_PORT:
@@ -122,16 +176,32 @@ func unpackDest(service Service, attrs nlgo.AttrMap) (Dest, error) {
 			dest.UThresh = (uint32)(attr.Value.(nlgo.U32))
 		case IPVS_DEST_ATTR_L_THRESH:
 			dest.LThresh = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_DEST_ATTR_TUN_TYPE:
+			dest.TunType = (TunType)(attr.Value.(nlgo.U8))
+		case IPVS_DEST_ATTR_TUN_PORT:
+			dest.TunPort = unpackPort(attr.Value.(nlgo.U16))
+		case IPVS_DEST_ATTR_TUN_FLAGS:
+			dest.TunFlags = (uint16)(attr.Value.(nlgo.U16))
 		case IPVS_DEST_ATTR_ACTIVE_CONNS:
 			dest.ActiveConns = (uint32)(attr.Value.(nlgo.U32))
 		case IPVS_DEST_ATTR_INACT_CONNS:
 			dest.InactConns = (uint32)(attr.Value.(nlgo.U32))
 		case IPVS_DEST_ATTR_PERSIST_CONNS:
 			dest.PersistConns = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_DEST_ATTR_STATS:
+			if stats, err := unpackStats(attr.Value.(nlgo.AttrMap)); err != nil {
+				return dest, fmt.Errorf("ipvs:Dest.unpack: stats: %s", err)
+			} else {
+				dest.Stats = stats
+			}
 		}
 	}
 
-	if addrIP, err := unpackAddr(addr, service.Af); err != nil {
+	if af != service.Af {
+		dest.Af = af
+	}
+
+	if addrIP, err := unpackAddr(addr, af); err != nil {
 		return dest, fmt.Errorf("ipvs:Dest.unpack: addr: %s", err)
 	} else {
 		dest.Addr = addrIP
@@ -140,13 +210,20 @@ func unpackDest(service Service, attrs nlgo.AttrMap) (Dest, error) {
 	return dest, nil
 }
 
-// Dump Dest as nl attrs, using the Af of the corresponding Service.
+// Dump Dest as nl attrs, using the Af of the corresponding Service, unless the Dest has a different Af.
 // If full, includes Dest setting attrs, otherwise only identifying attrs.
 func (self *Dest) attrs(service *Service, full bool) nlgo.AttrSlice {
 	var attrs nlgo.AttrSlice
+	var af = service.Af
+
+	if self.Af != 0 && self.Af != service.Af {
+		af = self.Af
+
+		attrs = append(attrs, nlattr(IPVS_DEST_ATTR_ADDR_FAMILY, nlgo.U16(af)))
+	}
 
 	attrs = append(attrs,
-		nlattr(IPVS_DEST_ATTR_ADDR, packAddr(service.Af, self.Addr)),
+		nlattr(IPVS_DEST_ATTR_ADDR, packAddr(af, self.Addr)),
 		nlattr(IPVS_DEST_ATTR_PORT, packPort(self.Port)),
 	)
 
@@ -157,6 +234,15 @@ func (self *Dest) attrs(service *Service, full bool) nlgo.AttrSlice {
 			nlattr(IPVS_DEST_ATTR_U_THRESH, nlgo.U32(self.UThresh)),
 			nlattr(IPVS_DEST_ATTR_L_THRESH, nlgo.U32(self.LThresh)),
 		)
+
+		// only supported by newer kernels
+		if self.TunType != IP_VS_CONN_F_TUNNEL_TYPE_IPIP {
+			attrs = append(attrs,
+				nlattr(IPVS_DEST_ATTR_TUN_TYPE, nlgo.U8(self.TunType)),
+				nlattr(IPVS_DEST_ATTR_TUN_PORT, packPort(self.TunPort)),
+				nlattr(IPVS_DEST_ATTR_TUN_FLAGS, nlgo.U16(self.TunFlags)),
+			)
+		}
 	}
 
 	return attrs
@@ -0,0 +1,381 @@
+package ipvs
+
+import (
+	"sort"
+	"sync"
+	"syscall"
+)
+
+type emulatorService struct {
+	service Service
+	dests   map[string]Dest
+}
+
+// In-memory emulation of the kernel IPVS state, following the kernel semantics for errors.
+type Emulator struct {
+	mutex sync.Mutex
+
+	services map[string]emulatorService
+	timeouts Timeouts
+	daemons  map[DaemonState]Daemon
+}
+
+func NewEmulator() *Emulator {
+	return &Emulator{
+		services: make(map[string]emulatorService),
+		timeouts: Timeouts{TCP: 900, TCPFin: 120, UDP: 300},
+		daemons:  make(map[DaemonState]Daemon),
+	}
+}
+
+// Validate service parameters
+func (emulator *Emulator) checkService(service Service) error {
+	switch service.Af {
+	case syscall.AF_INET:
+	case syscall.AF_INET6:
+		if service.Netmask < 1 || service.Netmask > 128 {
+			return syscall.EINVAL
+		}
+	default:
+		return syscall.EAFNOSUPPORT
+	}
+
+	if service.FwMark != 0 {
+
+	} else if service.Protocol != syscall.IPPROTO_TCP && service.Protocol != syscall.IPPROTO_UDP && service.Protocol != syscall.IPPROTO_SCTP {
+		return syscall.EPROTONOSUPPORT
+	}
+
+	if _, err := ParseSchedName(service.SchedName); err != nil {
+		return syscall.ENOENT
+	}
+
+	if service.PEName == "" {
+
+	} else if _, err := ParsePEName(service.PEName); err != nil {
+		return syscall.ENOENT
+	}
+
+	return nil
+}
+
+// Validate dest parameters, mixed-family dests are only supported for tunneling
+func (emulator *Emulator) checkDest(service Service, dest Dest) error {
+	switch dest.TunType {
+	case IP_VS_CONN_F_TUNNEL_TYPE_IPIP:
+
+	case IP_VS_CONN_F_TUNNEL_TYPE_GUE:
+		if dest.TunPort == 0 {
+			return syscall.EINVAL
+		}
+	case IP_VS_CONN_F_TUNNEL_TYPE_GRE:
+
+	default:
+		return syscall.EINVAL
+	}
+
+	switch dest.Af {
+	case 0, service.Af:
+		return nil
+	case syscall.AF_INET, syscall.AF_INET6:
+		if dest.FwdMethod&IP_VS_CONN_F_FWD_MASK != IP_VS_CONN_F_TUNNEL {
+			return syscall.EINVAL
+		}
+
+		return nil
+	default:
+		return syscall.EAFNOSUPPORT
+	}
+}
+
+// The kernel only stores the dest params
+func (emulator *Emulator) dest(service Service, dest Dest) Dest {
+	if dest.Af == service.Af {
+		dest.Af = 0
+	}
+
+	return Dest{
+		Af:        dest.Af,
+		Addr:      dest.Addr,
+		Port:      dest.Port,
+		FwdMethod: dest.FwdMethod & IP_VS_CONN_F_FWD_MASK,
+		Weight:    dest.Weight,
+		UThresh:   dest.UThresh,
+		LThresh:   dest.LThresh,
+		TunType:   dest.TunType,
+		TunPort:   dest.TunPort,
+		TunFlags:  dest.TunFlags,
+	}
+}
+
+// The kernel only stores the service params, and flags the service as hashed
+func (emulator *Emulator) service(service Service) Service {
+	service = Service{
+		Af:        service.Af,
+		Protocol:  service.Protocol,
+		Addr:      service.Addr,
+		Port:      service.Port,
+		FwMark:    service.FwMark,
+		SchedName: service.SchedName,
+		Flags:     Flags{Flags: service.Flags.Flags | IP_VS_SVC_F_HASHED, Mask: 0xffffffff},
+		Timeout:   service.Timeout,
+		Netmask:   service.Netmask,
+		PEName:    service.PEName,
+	}
+
+	if service.FwMark != 0 {
+		service.Protocol = 0
+		service.Addr = nil
+		service.Port = 0
+	}
+
+	return service
+}
+
+func (emulator *Emulator) GetInfo() (Info, error) {
+	return Info{Version: 0x010201, ConnTabSize: 4096}, nil
+}
+
+func (emulator *Emulator) Flush() error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	emulator.services = make(map[string]emulatorService)
+
+	return nil
+}
+
+// No stats are emulated
+func (emulator *Emulator) Zero() error {
+	return nil
+}
+
+func (emulator *Emulator) ZeroService(service Service) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if _, exists := emulator.services[service.String()]; !exists {
+		return syscall.ESRCH
+	}
+
+	return nil
+}
+
+// Services are listed in String() order
+func (emulator *Emulator) ListServices() ([]Service, error) {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	var keys []string
+	var services []Service
+
+	for key := range emulator.services {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		services = append(services, emulator.services[key].service)
+	}
+
+	return services, nil
+}
+
+func (emulator *Emulator) NewService(service Service) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if _, exists := emulator.services[service.String()]; exists {
+		return syscall.EEXIST
+	} else if err := emulator.checkService(service); err != nil {
+		return err
+	}
+
+	emulator.services[service.String()] = emulatorService{
+		service: emulator.service(service),
+		dests:   make(map[string]Dest),
+	}
+
+	return nil
+}
+
+func (emulator *Emulator) SetService(service Service) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if emulatorService, exists := emulator.services[service.String()]; !exists {
+		return syscall.ESRCH
+	} else if err := emulator.checkService(service); err != nil {
+		return err
+	} else {
+		emulatorService.service = emulator.service(service)
+
+		emulator.services[service.String()] = emulatorService
+	}
+
+	return nil
+}
+
+// Also removes all dests
+func (emulator *Emulator) DelService(service Service) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if _, exists := emulator.services[service.String()]; !exists {
+		return syscall.ESRCH
+	}
+
+	delete(emulator.services, service.String())
+
+	return nil
+}
+
+// Dests are listed in String() order
+func (emulator *Emulator) ListDests(service Service) ([]Dest, error) {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	emulatorService, exists := emulator.services[service.String()]
+	if !exists {
+		return nil, syscall.ESRCH
+	}
+
+	var keys []string
+	var dests []Dest
+
+	for key := range emulatorService.dests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		dests = append(dests, emulatorService.dests[key])
+	}
+
+	return dests, nil
+}
+
+func (emulator *Emulator) NewDest(service Service, dest Dest) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if emulatorService, exists := emulator.services[service.String()]; !exists {
+		return syscall.ESRCH
+	} else if _, exists := emulatorService.dests[dest.String()]; exists {
+		return syscall.EEXIST
+	} else if err := emulator.checkDest(emulatorService.service, dest); err != nil {
+		return err
+	} else {
+		emulatorService.dests[dest.String()] = emulator.dest(emulatorService.service, dest)
+	}
+
+	return nil
+}
+
+func (emulator *Emulator) SetDest(service Service, dest Dest) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if emulatorService, exists := emulator.services[service.String()]; !exists {
+		return syscall.ESRCH
+	} else if _, exists := emulatorService.dests[dest.String()]; !exists {
+		return syscall.ENOENT
+	} else if err := emulator.checkDest(emulatorService.service, dest); err != nil {
+		return err
+	} else {
+		emulatorService.dests[dest.String()] = emulator.dest(emulatorService.service, dest)
+	}
+
+	return nil
+}
+
+func (emulator *Emulator) DelDest(service Service, dest Dest) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if emulatorService, exists := emulator.services[service.String()]; !exists {
+		return syscall.ESRCH
+	} else if _, exists := emulatorService.dests[dest.String()]; !exists {
+		return syscall.ENOENT
+	} else {
+		delete(emulatorService.dests, dest.String())
+	}
+
+	return nil
+}
+
+// Execute the batched commands one at a time, continuing after any failed commands like the kernel
+func (emulator *Emulator) ExecBatch(batch *Batch) ([]error, error) {
+	return batch.Exec(emulator), nil
+}
+
+func (emulator *Emulator) GetTimeouts() (Timeouts, error) {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	return emulator.timeouts, nil
+}
+
+// Zero timeouts are left unchanged
+func (emulator *Emulator) SetTimeouts(timeouts Timeouts) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if timeouts.TCP != 0 {
+		emulator.timeouts.TCP = timeouts.TCP
+	}
+	if timeouts.TCPFin != 0 {
+		emulator.timeouts.TCPFin = timeouts.TCPFin
+	}
+	if timeouts.UDP != 0 {
+		emulator.timeouts.UDP = timeouts.UDP
+	}
+
+	return nil
+}
+
+// Daemons are listed in State order
+func (emulator *Emulator) ListDaemons() ([]Daemon, error) {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	var daemons []Daemon
+
+	for _, state := range []DaemonState{IP_VS_STATE_MASTER, IP_VS_STATE_BACKUP} {
+		if daemon, exists := emulator.daemons[state]; exists {
+			daemons = append(daemons, daemon)
+		}
+	}
+
+	return daemons, nil
+}
+
+func (emulator *Emulator) NewDaemon(daemon Daemon) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if daemon.State != IP_VS_STATE_MASTER && daemon.State != IP_VS_STATE_BACKUP {
+		return syscall.EINVAL
+	} else if daemon.McastIfn == "" {
+		return syscall.EINVAL
+	} else if _, exists := emulator.daemons[daemon.State]; exists {
+		return syscall.EEXIST
+	}
+
+	emulator.daemons[daemon.State] = daemon
+
+	return nil
+}
+
+func (emulator *Emulator) DelDaemon(daemon Daemon) error {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	if _, exists := emulator.daemons[daemon.State]; !exists {
+		return syscall.ESRCH
+	}
+
+	delete(emulator.daemons, daemon.State)
+
+	return nil
+}
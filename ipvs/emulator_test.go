@@ -0,0 +1,150 @@
+package ipvs
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestEmulatorService(t *testing.T) {
+	var emulator = NewEmulator()
+	var service = Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc", Netmask: 0xffffffff}
+	var dest = Dest{Addr: net.IP{10, 1, 0, 1}, Port: 8080, FwdMethod: IP_VS_CONN_F_MASQ, Weight: 10}
+
+	if err := emulator.NewService(service); err != nil {
+		t.Fatalf("Emulator.NewService: %v", err)
+	}
+	if err := emulator.NewService(service); err != syscall.EEXIST {
+		t.Errorf("Emulator.NewService duplicate: %v", err)
+	}
+	if err := emulator.NewDest(service, dest); err != nil {
+		t.Fatalf("Emulator.NewDest: %v", err)
+	}
+	if err := emulator.NewDest(service, dest); err != syscall.EEXIST {
+		t.Errorf("Emulator.NewDest duplicate: %v", err)
+	}
+
+	if services, err := emulator.ListServices(); err != nil {
+		t.Fatalf("Emulator.ListServices: %v", err)
+	} else if diff := pretty.Compare([]Service{
+		{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc", Flags: Flags{IP_VS_SVC_F_HASHED, 0xffffffff}, Netmask: 0xffffffff},
+	}, services); diff != "" {
+		t.Errorf("Emulator.ListServices:\n%s", diff)
+	}
+
+	if dests, err := emulator.ListDests(service); err != nil {
+		t.Fatalf("Emulator.ListDests: %v", err)
+	} else if diff := pretty.Compare([]Dest{dest}, dests); diff != "" {
+		t.Errorf("Emulator.ListDests:\n%s", diff)
+	}
+
+	// deleting the service drops the dests
+	if err := emulator.DelService(service); err != nil {
+		t.Fatalf("Emulator.DelService: %v", err)
+	}
+	if err := emulator.NewService(service); err != nil {
+		t.Fatalf("Emulator.NewService: %v", err)
+	}
+	if dests, err := emulator.ListDests(service); err != nil {
+		t.Fatalf("Emulator.ListDests: %v", err)
+	} else if len(dests) != 0 {
+		t.Errorf("Emulator.ListDests after DelService: %v", dests)
+	}
+}
+
+func TestEmulatorBatch(t *testing.T) {
+	var emulator = NewEmulator()
+	var batch Batch
+	var service = Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc", Netmask: 0xffffffff}
+	var dest = Dest{Addr: net.IP{10, 1, 0, 1}, Port: 8080, FwdMethod: IP_VS_CONN_F_MASQ, Weight: 10}
+
+	batch.NewService(service)
+	batch.NewService(service)
+	batch.NewDest(service, dest)
+	batch.SetDest(service, Dest{Addr: net.IP{10, 1, 0, 2}, Port: 8080})
+
+	if errors, err := emulator.ExecBatch(&batch); err != nil {
+		t.Fatalf("Emulator.ExecBatch: %v", err)
+	} else if diff := pretty.Compare([]error{nil, syscall.EEXIST, nil, syscall.ENOENT}, errors); diff != "" {
+		t.Errorf("Emulator.ExecBatch errors:\n%s", diff)
+	}
+
+	if dests, err := emulator.ListDests(service); err != nil {
+		t.Fatalf("Emulator.ListDests: %v", err)
+	} else if diff := pretty.Compare([]Dest{dest}, dests); diff != "" {
+		t.Errorf("Emulator.ListDests:\n%s", diff)
+	}
+}
+
+var testEmulatorErrors = []struct {
+	name string
+	run  func(emulator *Emulator) error
+	err  error
+}{
+	{"new-service-sched", func(emulator *Emulator) error {
+		return emulator.NewService(Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "foo"})
+	}, syscall.ENOENT},
+	{"new-service-af", func(emulator *Emulator) error {
+		return emulator.NewService(Service{Af: 0, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc"})
+	}, syscall.EAFNOSUPPORT},
+	{"new-service-netmask6", func(emulator *Emulator) error {
+		return emulator.NewService(Service{Af: syscall.AF_INET6, Protocol: syscall.IPPROTO_TCP, Addr: net.ParseIP("2001:db8::1"), Port: 80, SchedName: "wlc", Netmask: 0xffffffff})
+	}, syscall.EINVAL},
+	{"set-service", func(emulator *Emulator) error {
+		return emulator.SetService(Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc"})
+	}, syscall.ESRCH},
+	{"del-service", func(emulator *Emulator) error {
+		return emulator.DelService(Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80})
+	}, syscall.ESRCH},
+	{"new-dest-service", func(emulator *Emulator) error {
+		return emulator.NewDest(Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80}, Dest{Addr: net.IP{10, 1, 0, 1}, Port: 8080})
+	}, syscall.ESRCH},
+	{"set-dest", func(emulator *Emulator) error {
+		var service = Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc"}
+
+		if err := emulator.NewService(service); err != nil {
+			return err
+		}
+
+		return emulator.SetDest(service, Dest{Addr: net.IP{10, 1, 0, 1}, Port: 8080})
+	}, syscall.ENOENT},
+	{"new-dest-mixed", func(emulator *Emulator) error {
+		var service = Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc"}
+
+		if err := emulator.NewService(service); err != nil {
+			return err
+		}
+
+		return emulator.NewDest(service, Dest{Af: syscall.AF_INET6, Addr: net.ParseIP("2001:db8::1"), Port: 80, FwdMethod: IP_VS_CONN_F_DROUTE})
+	}, syscall.EINVAL},
+	{"new-dest-gue", func(emulator *Emulator) error {
+		var service = Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc"}
+
+		if err := emulator.NewService(service); err != nil {
+			return err
+		}
+
+		return emulator.NewDest(service, Dest{Addr: net.IP{10, 1, 0, 1}, Port: 80, FwdMethod: IP_VS_CONN_F_TUNNEL, TunType: IP_VS_CONN_F_TUNNEL_TYPE_GUE})
+	}, syscall.EINVAL},
+	{"new-daemon", func(emulator *Emulator) error {
+		var daemon = Daemon{State: IP_VS_STATE_MASTER, McastIfn: "eth0"}
+
+		if err := emulator.NewDaemon(daemon); err != nil {
+			return err
+		}
+
+		return emulator.NewDaemon(daemon)
+	}, syscall.EEXIST},
+	{"del-daemon", func(emulator *Emulator) error {
+		return emulator.DelDaemon(Daemon{State: IP_VS_STATE_BACKUP})
+	}, syscall.ESRCH},
+}
+
+func TestEmulatorErrors(t *testing.T) {
+	for _, test := range testEmulatorErrors {
+		if err := test.run(NewEmulator()); err != test.err {
+			t.Errorf("%s: %v != %v", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package ipvs
+
+// Kernel IPVS state, implemented by the netlink Client, or the in-memory Emulator
+type Interface interface {
+	GetInfo() (Info, error)
+	Flush() error
+	Zero() error
+	ZeroService(Service) error
+
+	ListServices() ([]Service, error)
+	NewService(Service) error
+	SetService(Service) error
+	DelService(Service) error
+
+	ListDests(Service) ([]Dest, error)
+	NewDest(Service, Dest) error
+	SetDest(Service, Dest) error
+	DelDest(Service, Dest) error
+
+	GetTimeouts() (Timeouts, error)
+	SetTimeouts(Timeouts) error
+
+	ListDaemons() ([]Daemon, error)
+	NewDaemon(Daemon) error
+	DelDaemon(Daemon) error
+}
@@ -49,6 +49,18 @@ const (
 	IP_VS_CONN_F_ONE_PACKET = 0x2000 /* forward only one packet */
 )
 
+const (
+	IP_VS_CONN_F_TUNNEL_TYPE_IPIP = 0 /* IPIP */
+	IP_VS_CONN_F_TUNNEL_TYPE_GUE  = 1 /* GUE */
+	IP_VS_CONN_F_TUNNEL_TYPE_GRE  = 2 /* GRE */
+)
+
+const (
+	IP_VS_TUNNEL_ENCAP_FLAG_NOCSUM  = 0x0000 /* no checksum */
+	IP_VS_TUNNEL_ENCAP_FLAG_CSUM    = 0x0001 /* outer udp/gre checksum */
+	IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM = 0x0002 /* remote checksum offload */
+)
+
 const (
 	IPVS_CMD_UNSPEC = iota
 
@@ -101,7 +113,7 @@ const (
 
 	IPVS_SVC_ATTR_STATS /* nested attribute for service stats */
 
-	IPVS_SVC_ATTR_PE_NAME /* name of scheduler */
+	IPVS_SVC_ATTR_PE_NAME /* name of persistence engine */
 )
 
 const (
@@ -122,6 +134,12 @@ const (
 	IPVS_DEST_ATTR_STATS /* nested attribute for dest stats */
 
 	IPVS_DEST_ATTR_ADDR_FAMILY /* Address family of address */
+
+	IPVS_DEST_ATTR_STATS64 /* nested attribute for dest stats */
+
+	IPVS_DEST_ATTR_TUN_TYPE  /* tunnel type */
+	IPVS_DEST_ATTR_TUN_PORT  /* tunnel port */
+	IPVS_DEST_ATTR_TUN_FLAGS /* tunnel flags */
 )
 
 const (
@@ -144,6 +162,7 @@ const (
 	IPVS_STATS_ATTR_OUTPPS /* current out packet rate */
 	IPVS_STATS_ATTR_INBPS  /* current in byte rate */
 	IPVS_STATS_ATTR_OUTBPS /* current out byte rate */
+	IPVS_STATS_ATTR_PAD
 )
 
 const (
@@ -180,6 +199,24 @@ var ipvs_stats_policy = nlgo.MapPolicy{
 	},
 }
 
+// All IPVS_*_ATTR_STATS64 counters and rates are u64
+var ipvs_stats64_policy = nlgo.MapPolicy{
+	Prefix: "IPVS_STATS_ATTR",
+	Names:  ipvs_stats_policy.Names,
+	Rule: map[uint16]nlgo.Policy{
+		IPVS_STATS_ATTR_CONNS:    nlgo.U64Policy,
+		IPVS_STATS_ATTR_INPKTS:   nlgo.U64Policy,
+		IPVS_STATS_ATTR_OUTPKTS:  nlgo.U64Policy,
+		IPVS_STATS_ATTR_INBYTES:  nlgo.U64Policy,
+		IPVS_STATS_ATTR_OUTBYTES: nlgo.U64Policy,
+		IPVS_STATS_ATTR_CPS:      nlgo.U64Policy,
+		IPVS_STATS_ATTR_INPPS:    nlgo.U64Policy,
+		IPVS_STATS_ATTR_OUTPPS:   nlgo.U64Policy,
+		IPVS_STATS_ATTR_INBPS:    nlgo.U64Policy,
+		IPVS_STATS_ATTR_OUTBPS:   nlgo.U64Policy,
+	},
+}
+
 var ipvs_service_policy = nlgo.MapPolicy{
 	Prefix: "IPVS_SVC_ATTR",
 	Names: map[uint16]string{
@@ -206,6 +243,7 @@ var ipvs_service_policy = nlgo.MapPolicy{
 		IPVS_SVC_ATTR_TIMEOUT:    nlgo.U32Policy,
 		IPVS_SVC_ATTR_NETMASK:    nlgo.U32Policy,
 		IPVS_SVC_ATTR_STATS:      ipvs_stats_policy,
+		IPVS_SVC_ATTR_PE_NAME:    nlgo.NulStringPolicy, // IP_VS_PENAME_MAXLEN
 	},
 }
 
@@ -222,6 +260,11 @@ var ipvs_dest_policy = nlgo.MapPolicy{
 		IPVS_DEST_ATTR_INACT_CONNS:   "INACT_CONNS",
 		IPVS_DEST_ATTR_PERSIST_CONNS: "PERSIST_CONNS",
 		IPVS_DEST_ATTR_STATS:         "STATS",
+		IPVS_DEST_ATTR_ADDR_FAMILY:   "ADDR_FAMILY",
+		IPVS_DEST_ATTR_STATS64:       "STATS64",
+		IPVS_DEST_ATTR_TUN_TYPE:      "TUN_TYPE",
+		IPVS_DEST_ATTR_TUN_PORT:      "TUN_PORT",
+		IPVS_DEST_ATTR_TUN_FLAGS:     "TUN_FLAGS",
 	},
 	Rule: map[uint16]nlgo.Policy{
 		IPVS_DEST_ATTR_ADDR:          nlgo.BinaryPolicy, // struct in6_addr
@@ -234,6 +277,11 @@ var ipvs_dest_policy = nlgo.MapPolicy{
 		IPVS_DEST_ATTR_INACT_CONNS:   nlgo.U32Policy,
 		IPVS_DEST_ATTR_PERSIST_CONNS: nlgo.U32Policy,
 		IPVS_DEST_ATTR_STATS:         ipvs_stats_policy,
+		IPVS_DEST_ATTR_ADDR_FAMILY:   nlgo.U16Policy,
+		IPVS_DEST_ATTR_STATS64:       ipvs_stats64_policy,
+		IPVS_DEST_ATTR_TUN_TYPE:      nlgo.U8Policy,
+		IPVS_DEST_ATTR_TUN_PORT:      nlgo.U16Policy, // network order
+		IPVS_DEST_ATTR_TUN_FLAGS:     nlgo.U16Policy,
 	},
 }
 
@@ -246,7 +294,7 @@ var ipvs_daemon_policy = nlgo.MapPolicy{
 	},
 	Rule: map[uint16]nlgo.Policy{
 		IPVS_DAEMON_ATTR_STATE:     nlgo.U32Policy,
-		IPVS_DAEMON_ATTR_MCAST_IFN: nlgo.StringPolicy, // maxlen = IP_VS_IFNAME_MAXLEN
+		IPVS_DAEMON_ATTR_MCAST_IFN: nlgo.NulStringPolicy, // maxlen = IP_VS_IFNAME_MAXLEN
 		IPVS_DAEMON_ATTR_SYNC_ID:   nlgo.U32Policy,
 	},
 }
@@ -0,0 +1,83 @@
+package ipvs
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// Named network namespaces, as created by `ip netns add`
+const NetnsDir = "/var/run/netns"
+
+// Resolve a network namespace name within NetnsDir, or an absolute path such as /proc/$pid/ns/net.
+//
+// Returns an empty path for the current network namespace.
+func NetnsPath(netns string) string {
+	if netns == "" {
+		return ""
+	} else if strings.Contains(netns, "/") {
+		return netns
+	} else {
+		return filepath.Join(NetnsDir, netns)
+	}
+}
+
+// The syscall package does not define SYS_SETNS for all architectures
+func setns(file *os.File) error {
+	return unix.Setns(int(file.Fd()), unix.CLONE_NEWNET)
+}
+
+// Call the given function within the network namespace at the given path, or the current network namespace if empty.
+//
+// Any sockets opened by the function remain within the network namespace.
+func withNetns(path string, f func() error) error {
+	if path == "" {
+		return f()
+	}
+
+	var errChan = make(chan error, 1)
+
+	// the network namespace is per-thread, and a thread that fails to restore its network namespace must not be re-used
+	go func() {
+		runtime.LockOSThread()
+
+		currentFile, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errChan <- err
+			return
+		}
+		defer currentFile.Close()
+
+		netnsFile, err := os.Open(path)
+		if err != nil {
+			runtime.UnlockOSThread()
+			errChan <- err
+			return
+		}
+		defer netnsFile.Close()
+
+		if err := setns(netnsFile); err != nil {
+			runtime.UnlockOSThread()
+			errChan <- fmt.Errorf("setns %v: %v", path, err)
+			return
+		}
+
+		err = f()
+
+		if restoreErr := setns(currentFile); restoreErr != nil {
+			// exits the locked thread with the goroutine
+			errChan <- fmt.Errorf("setns %v: %v", currentFile.Name(), restoreErr)
+			return
+		}
+
+		runtime.UnlockOSThread()
+		errChan <- err
+	}()
+
+	return <-errChan
+}
@@ -0,0 +1,110 @@
+package ipvs
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestNetnsPath(t *testing.T) {
+	for _, test := range []struct {
+		netns string
+		path  string
+	}{
+		{"", ""},
+		{"test", "/var/run/netns/test"},
+		{"/proc/1/ns/net", "/proc/1/ns/net"},
+	} {
+		if path := NetnsPath(test.netns); path != test.path {
+			t.Errorf("NetnsPath %#v: %#v", test.netns, path)
+		}
+	}
+}
+
+// Create a throwaway network namespace, returning its path.
+//
+// The network namespace is held by a locked thread until the returned func is called.
+func testNetns(t testing.TB) (string, func()) {
+	var pathChan = make(chan string)
+	var errChan = make(chan error)
+	var doneChan = make(chan struct{})
+
+	go func() {
+		// the thread is not unlocked, and exits with the goroutine
+		runtime.LockOSThread()
+
+		if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+			errChan <- err
+			return
+		}
+
+		pathChan <- fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), syscall.Gettid())
+
+		<-doneChan
+	}()
+
+	select {
+	case err := <-errChan:
+		t.Skipf("unshare: %v", err)
+		return "", nil
+	case path := <-pathChan:
+		return path, func() { close(doneChan) }
+	}
+}
+
+func TestWithNetns(t *testing.T) {
+	netns, done := testNetns(t)
+	defer done()
+
+	var current, inside string
+
+	if err := withNetns("", func() (err error) {
+		current, err = os.Readlink("/proc/thread-self/ns/net")
+		return
+	}); err != nil {
+		t.Fatalf("withNetns: %v", err)
+	}
+
+	if err := withNetns(netns, func() (err error) {
+		inside, err = os.Readlink("/proc/thread-self/ns/net")
+		return
+	}); err != nil {
+		t.Fatalf("withNetns %v: %v", netns, err)
+	}
+
+	if expected, err := os.Readlink(netns); err != nil {
+		t.Fatalf("readlink %v: %v", netns, err)
+	} else if inside != expected {
+		t.Errorf("withNetns %v: %v", netns, inside)
+	} else if inside == current {
+		t.Errorf("withNetns %v: in current netns %v", netns, current)
+	}
+
+	if err := withNetns("/nonexistent", func() error { return nil }); err == nil {
+		t.Errorf("withNetns /nonexistent: expected error")
+	}
+}
+
+func TestOpenNetns(t *testing.T) {
+	netns, done := testNetns(t)
+	defer done()
+
+	client, err := OpenNetns(netns)
+	if err != nil {
+		t.Skipf("ipvs.OpenNetns: %v", err)
+	}
+
+	var service = Service{Af: syscall.AF_INET, FwMark: 1, SchedName: "wlc", Flags: Flags{0, 0xffffffff}, Netmask: 0xffffffff}
+
+	if err := client.NewService(service); err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	if services, err := client.ListServices(); err != nil {
+		t.Fatalf("ListServices: %v", err)
+	} else if len(services) != 1 {
+		t.Errorf("ListServices: %v", services)
+	}
+}
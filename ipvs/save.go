@@ -0,0 +1,420 @@
+package ipvs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Service and its Dests, in the ipvsadm-save (ipvsadm -S -n) format
+type SaveService struct {
+	Service Service
+	Dests   []Dest
+}
+
+func saveAddrPort(addr net.IP, port uint16) string {
+	if addr.To4() != nil {
+		return fmt.Sprintf("%s:%d", addr, port)
+	} else {
+		return fmt.Sprintf("[%s]:%d", addr, port)
+	}
+}
+
+// The ipvsadm service id args
+func (service Service) saveID() (string, error) {
+	if service.FwMark != 0 && service.Af == syscall.AF_INET6 {
+		return fmt.Sprintf("-f %d -6", service.FwMark), nil
+	} else if service.FwMark != 0 {
+		return fmt.Sprintf("-f %d", service.FwMark), nil
+	}
+
+	switch service.Protocol {
+	case syscall.IPPROTO_TCP:
+		return "-t " + saveAddrPort(service.Addr, service.Port), nil
+	case syscall.IPPROTO_UDP:
+		return "-u " + saveAddrPort(service.Addr, service.Port), nil
+	case syscall.IPPROTO_SCTP:
+		return "--sctp-service " + saveAddrPort(service.Addr, service.Port), nil
+	default:
+		return "", fmt.Errorf("ipvs:Service.save: unsupported protocol: %v", service.Protocol)
+	}
+}
+
+func (service Service) save() (string, error) {
+	id, err := service.saveID()
+	if err != nil {
+		return "", err
+	}
+
+	var args = []string{"-A", id, "-s", service.SchedName}
+
+	if service.Flags.Flags&IP_VS_SVC_F_PERSISTENT != 0 {
+		args = append(args, "-p", strconv.Itoa(int(service.Timeout)))
+
+		if service.Af == syscall.AF_INET && service.Netmask != 0xffffffff {
+			var mask = make(net.IP, 4)
+
+			binary.NativeEndian.PutUint32(mask, service.Netmask)
+
+			args = append(args, "-M", mask.String())
+		} else if service.Af == syscall.AF_INET6 && service.Netmask != 128 {
+			args = append(args, "-M", strconv.Itoa(int(service.Netmask)))
+		}
+	}
+
+	var schedFlags []string
+
+	if service.Flags.Flags&IP_VS_SVC_F_SCHED_SH_FALLBACK != 0 {
+		schedFlags = append(schedFlags, "sh-fallback")
+	}
+	if service.Flags.Flags&IP_VS_SVC_F_SCHED_SH_PORT != 0 {
+		schedFlags = append(schedFlags, "sh-port")
+	}
+	if len(schedFlags) > 0 {
+		args = append(args, "-b", strings.Join(schedFlags, ","))
+	}
+
+	if service.Flags.Flags&IP_VS_SVC_F_ONEPACKET != 0 {
+		args = append(args, "-o")
+	}
+
+	if service.PEName != "" {
+		args = append(args, "--pe", service.PEName)
+	}
+
+	return strings.Join(args, " "), nil
+}
+
+func (dest Dest) save(service Service) (string, error) {
+	id, err := service.saveID()
+	if err != nil {
+		return "", err
+	}
+
+	var args = []string{"-a", id, "-r", saveAddrPort(dest.Addr, dest.Port)}
+
+	switch dest.FwdMethod & IP_VS_CONN_F_FWD_MASK {
+	case IP_VS_CONN_F_MASQ:
+		args = append(args, "-m")
+	case IP_VS_CONN_F_TUNNEL:
+		args = append(args, "-i")
+	case IP_VS_CONN_F_DROUTE, IP_VS_CONN_F_LOCALNODE:
+		// the kernel reports local dests as localnode, which ipvsadm lists as -g
+		args = append(args, "-g")
+	default:
+		return "", fmt.Errorf("ipvs:Dest.save: unsupported fwd method: %v", dest.FwdMethod)
+	}
+
+	args = append(args, "-w", strconv.Itoa(int(dest.Weight)))
+
+	if dest.UThresh != 0 {
+		args = append(args, "-x", strconv.Itoa(int(dest.UThresh)))
+	}
+	if dest.LThresh != 0 {
+		args = append(args, "-y", strconv.Itoa(int(dest.LThresh)))
+	}
+
+	if dest.TunType != IP_VS_CONN_F_TUNNEL_TYPE_IPIP {
+		args = append(args, "--tun-type", dest.TunType.String())
+	}
+	if dest.TunPort != 0 {
+		args = append(args, "--tun-port", strconv.Itoa(int(dest.TunPort)))
+	}
+	if dest.TunFlags&IP_VS_TUNNEL_ENCAP_FLAG_CSUM != 0 {
+		args = append(args, "--tun-csum")
+	}
+	if dest.TunFlags&IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM != 0 {
+		args = append(args, "--tun-remcsum")
+	}
+
+	return strings.Join(args, " "), nil
+}
+
+// Single -A line for the service, in the ipvsadm-save format
+func (service Service) SaveLine() (string, error) {
+	return service.save()
+}
+
+// Single -a line for the service dest, in the ipvsadm-save format
+func (dest Dest) SaveLine(service Service) (string, error) {
+	return dest.save(service)
+}
+
+// Write the services and dests in the ipvsadm-save format, suitable for ipvsadm -R
+func WriteSave(writer io.Writer, services []SaveService) error {
+	for _, saveService := range services {
+		if line, err := saveService.Service.save(); err != nil {
+			return err
+		} else if _, err := fmt.Fprintln(writer, line); err != nil {
+			return err
+		}
+
+		for _, dest := range saveService.Dests {
+			if line, err := dest.save(saveService.Service); err != nil {
+				return err
+			} else if _, err := fmt.Fprintln(writer, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseSaveAddrPort(value string) (Af, net.IP, uint16, error) {
+	host, portString, err := net.SplitHostPort(value)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("Invalid address: %s", value)
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("Invalid port: %s", value)
+	}
+
+	if ip := net.ParseIP(host); ip == nil {
+		return 0, nil, 0, fmt.Errorf("Invalid address: %s", value)
+	} else if ip4 := ip.To4(); ip4 != nil && !strings.Contains(host, ":") {
+		return syscall.AF_INET, ip4, uint16(port), nil
+	} else {
+		return syscall.AF_INET6, ip.To16(), uint16(port), nil
+	}
+}
+
+func parseSaveUint(value string, bits int) (uint64, error) {
+	if u, err := strconv.ParseUint(value, 10, bits); err != nil {
+		return 0, fmt.Errorf("Invalid value: %s", value)
+	} else {
+		return u, nil
+	}
+}
+
+// Parse the netmask as an IPv4 mask or IPv6 prefix length, once the service af is known
+func parseSaveNetmask(af Af, value string) (uint32, error) {
+	if af == syscall.AF_INET6 {
+		if prefixLen, err := strconv.ParseUint(value, 10, 8); err != nil || prefixLen > 128 {
+			return 0, fmt.Errorf("Invalid IPv6 netmask: %s", value)
+		} else {
+			return uint32(prefixLen), nil
+		}
+	} else if ip := net.ParseIP(value).To4(); ip == nil {
+		return 0, fmt.Errorf("Invalid IPv4 netmask: %s", value)
+	} else {
+		return binary.NativeEndian.Uint32(ip), nil
+	}
+}
+
+// Parse a single -A or -a line, returning the service, and the dest for -a
+func parseSave(line string) (service Service, dest *Dest, err error) {
+	var args = strings.Fields(line)
+	var netmask string
+
+	if len(args) == 0 {
+		return service, nil, fmt.Errorf("Empty line")
+	}
+
+	switch args[0] {
+	case "-A", "--add-service":
+		service.SchedName = "wlc"
+		service.Flags.Mask = 0xffffffff
+	case "-a", "--add-server":
+		dest = &Dest{FwdMethod: IP_VS_CONN_F_DROUTE, Weight: 1}
+	default:
+		return service, nil, fmt.Errorf("Unsupported command: %s", args[0])
+	}
+
+	for i := 1; i < len(args); i++ {
+		var arg = args[i]
+		var value string
+
+		switch arg {
+		case "-6", "--ipv6", "-o", "--ops", "-m", "--masquerading", "-i", "--ipip", "-g", "--gatewaying", "--tun-nocsum", "--tun-csum", "--tun-remcsum":
+			// flag without value
+		default:
+			if i+1 >= len(args) {
+				return service, dest, fmt.Errorf("Missing value for %s", arg)
+			}
+
+			i++
+			value = args[i]
+		}
+
+		switch arg {
+		case "-t", "--tcp-service", "-u", "--udp-service", "--sctp-service":
+			if service.Af, service.Addr, service.Port, err = parseSaveAddrPort(value); err != nil {
+				return
+			}
+
+			switch arg {
+			case "-t", "--tcp-service":
+				service.Protocol = syscall.IPPROTO_TCP
+			case "-u", "--udp-service":
+				service.Protocol = syscall.IPPROTO_UDP
+			default:
+				service.Protocol = syscall.IPPROTO_SCTP
+			}
+		case "-f", "--fwmark-service":
+			if fwmark, err := parseSaveUint(value, 32); err != nil {
+				return service, dest, err
+			} else {
+				service.FwMark = uint32(fwmark)
+			}
+
+			if service.Af == 0 {
+				service.Af = syscall.AF_INET
+			}
+		case "-6", "--ipv6":
+			service.Af = syscall.AF_INET6
+		case "-s", "--scheduler":
+			if service.SchedName, err = ParseSchedName(value); err != nil {
+				return
+			}
+		case "-p", "--persistent":
+			if timeout, err := parseSaveUint(value, 32); err != nil {
+				return service, dest, err
+			} else {
+				service.Flags.Flags |= IP_VS_SVC_F_PERSISTENT
+				service.Timeout = uint32(timeout)
+			}
+		case "-M", "--netmask":
+			netmask = value
+		case "-b", "--sched-flags":
+			for _, flagName := range strings.Split(value, ",") {
+				if flag, err := ParseFlag(flagName); err != nil {
+					return service, dest, err
+				} else {
+					service.Flags.Flags |= flag
+				}
+			}
+		case "-o", "--ops":
+			service.Flags.Flags |= IP_VS_SVC_F_ONEPACKET
+		case "--pe":
+			if service.PEName, err = ParsePEName(value); err != nil {
+				return
+			}
+		case "-r", "--real-server":
+			if dest == nil {
+				return service, dest, fmt.Errorf("Unexpected %s for service", arg)
+			} else if dest.Af, dest.Addr, dest.Port, err = parseSaveAddrPort(value); err != nil {
+				return
+			}
+		case "-m", "--masquerading":
+			dest.FwdMethod = IP_VS_CONN_F_MASQ
+		case "-i", "--ipip":
+			dest.FwdMethod = IP_VS_CONN_F_TUNNEL
+		case "-g", "--gatewaying":
+			dest.FwdMethod = IP_VS_CONN_F_DROUTE
+		case "-w", "--weight":
+			if weight, err := parseSaveUint(value, 32); err != nil {
+				return service, dest, err
+			} else {
+				dest.Weight = uint32(weight)
+			}
+		case "-x", "--u-threshold":
+			if uthresh, err := parseSaveUint(value, 32); err != nil {
+				return service, dest, err
+			} else {
+				dest.UThresh = uint32(uthresh)
+			}
+		case "-y", "--l-threshold":
+			if lthresh, err := parseSaveUint(value, 32); err != nil {
+				return service, dest, err
+			} else {
+				dest.LThresh = uint32(lthresh)
+			}
+		case "--tun-type":
+			if dest.TunType, err = ParseTunType(value); err != nil {
+				return
+			}
+		case "--tun-port":
+			if tunPort, err := parseSaveUint(value, 16); err != nil {
+				return service, dest, err
+			} else {
+				dest.TunPort = uint16(tunPort)
+			}
+		case "--tun-nocsum":
+			dest.TunFlags = IP_VS_TUNNEL_ENCAP_FLAG_NOCSUM
+		case "--tun-csum":
+			dest.TunFlags |= IP_VS_TUNNEL_ENCAP_FLAG_CSUM
+		case "--tun-remcsum":
+			dest.TunFlags |= IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM
+		default:
+			return service, dest, fmt.Errorf("Unsupported option: %s", arg)
+		}
+	}
+
+	if service.Af == 0 {
+		return service, dest, fmt.Errorf("Missing service")
+	}
+
+	if dest != nil && dest.Addr == nil {
+		return service, dest, fmt.Errorf("Missing -r")
+	} else if dest != nil && dest.Af == service.Af {
+		dest.Af = 0
+	}
+
+	if dest != nil {
+
+	} else if netmask != "" {
+		if service.Netmask, err = parseSaveNetmask(service.Af, netmask); err != nil {
+			return
+		}
+	} else if service.Af == syscall.AF_INET6 {
+		service.Netmask = 128
+	} else {
+		service.Netmask = 0xffffffff
+	}
+
+	return service, dest, nil
+}
+
+// Parse the ipvsadm-save format, as written by WriteSave or ipvsadm -S -n
+//
+// Each dest must follow its service.
+func ParseSave(reader io.Reader) ([]SaveService, error) {
+	var services []SaveService
+	var scanner = bufio.NewScanner(reader)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		service, dest, err := parseSave(line)
+		if err != nil {
+			return services, fmt.Errorf("ipvs:ParseSave: line %d: %v", lineNumber, err)
+		}
+
+		if dest == nil {
+			services = append(services, SaveService{Service: service})
+
+			continue
+		}
+
+		var found = false
+
+		for i := range services {
+			if services[i].Service.Match(service) {
+				services[i].Dests = append(services[i].Dests, *dest)
+				found = true
+			}
+		}
+
+		if !found {
+			return services, fmt.Errorf("ipvs:ParseSave: line %d: Unknown service %v", lineNumber, service)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return services, fmt.Errorf("ipvs:ParseSave: %v", err)
+	}
+
+	return services, nil
+}
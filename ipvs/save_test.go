@@ -0,0 +1,132 @@
+package ipvs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/kylelemons/godebug/pretty"
+	"io/ioutil"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSave(t *testing.T) {
+	golden, err := ioutil.ReadFile("testdata/ipvsadm.save")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	services, err := ParseSave(bytes.NewReader(golden))
+	if err != nil {
+		t.Fatalf("ParseSave: %v", err)
+	}
+
+	if len(services) != 8 {
+		t.Fatalf("ParseSave: %d services", len(services))
+	}
+
+	var testService = SaveService{
+		Service: Service{
+			Af:        syscall.AF_INET,
+			Protocol:  syscall.IPPROTO_TCP,
+			Addr:      net.IP{10, 0, 0, 2},
+			Port:      443,
+			SchedName: "sh",
+			Flags:     Flags{IP_VS_SVC_F_PERSISTENT | IP_VS_SVC_F_SCHED_SH_FALLBACK | IP_VS_SVC_F_SCHED_SH_PORT, 0xffffffff},
+			Timeout:   300,
+			Netmask:   binary.NativeEndian.Uint32(net.IP{255, 255, 255, 0}),
+		},
+		Dests: []Dest{
+			{
+				Addr:      net.IP{10, 255, 0, 1},
+				Port:      443,
+				FwdMethod: IP_VS_CONN_F_TUNNEL,
+				Weight:    10,
+				TunType:   IP_VS_CONN_F_TUNNEL_TYPE_GUE,
+				TunPort:   6080,
+				TunFlags:  IP_VS_TUNNEL_ENCAP_FLAG_CSUM,
+			},
+			{
+				Af:        syscall.AF_INET6,
+				Addr:      net.ParseIP("2001:db8:ff::1"),
+				Port:      443,
+				FwdMethod: IP_VS_CONN_F_TUNNEL,
+				Weight:    10,
+			},
+		},
+	}
+
+	if diff := pretty.Compare(testService, services[3]); diff != "" {
+		t.Errorf("ParseSave:\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+
+	if err := WriteSave(&buf, services); err != nil {
+		t.Fatalf("WriteSave: %v", err)
+	}
+
+	if diff := pretty.Compare(string(golden), buf.String()); diff != "" {
+		t.Errorf("WriteSave:\n%s", diff)
+	}
+}
+
+func TestParseSaveDefaults(t *testing.T) {
+	services, err := ParseSave(strings.NewReader("# ipvsadm -S\n-A -t 10.0.0.1:80\n-a -t 10.0.0.1:80 -r 10.1.0.1:80\n"))
+	if err != nil {
+		t.Fatalf("ParseSave: %v", err)
+	}
+
+	var testServices = []SaveService{
+		{
+			Service: Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc", Flags: Flags{0, 0xffffffff}, Netmask: 0xffffffff},
+			Dests: []Dest{
+				{Addr: net.IP{10, 1, 0, 1}, Port: 80, FwdMethod: IP_VS_CONN_F_DROUTE, Weight: 1},
+			},
+		},
+	}
+
+	if diff := pretty.Compare(testServices, services); diff != "" {
+		t.Errorf("ParseSave:\n%s", diff)
+	}
+}
+
+func TestParseSaveError(t *testing.T) {
+	for _, save := range []string{
+		"-D -t 10.0.0.1:80",
+		"-A -t 10.0.0.1",
+		"-A -t 10.0.0.1:80 -s foo",
+		"-A -t 10.0.0.1:80 -p",
+		"-A -t 10.0.0.1:80 -p 300 -M 24",
+		"-A -t 10.0.0.1:80 --foo",
+		"-a -t 10.0.0.1:80 -r 10.1.0.1:80",
+		"-A -t 10.0.0.1:80\n-a -t 10.0.0.1:80 -w 10",
+		"-A -t 10.0.0.1:80\n-a -t 10.0.0.1:80 -r 10.1.0.1:80 --tun-type vxlan",
+	} {
+		if _, err := ParseSave(strings.NewReader(save)); err == nil {
+			t.Errorf("ParseSave %#v: expected error", save)
+		}
+	}
+}
+
+func TestWriteSave(t *testing.T) {
+	var service = Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc", Netmask: 0xffffffff}
+	var buf bytes.Buffer
+
+	// local dests are listed as droute
+	if err := WriteSave(&buf, []SaveService{{Service: service, Dests: []Dest{{Addr: net.IP{127, 0, 0, 1}, Port: 80, FwdMethod: IP_VS_CONN_F_LOCALNODE, Weight: 1}}}}); err != nil {
+		t.Fatalf("WriteSave: %v", err)
+	} else if diff := pretty.Compare("-A -t 10.0.0.1:80 -s wlc\n-a -t 10.0.0.1:80 -r 127.0.0.1:80 -g -w 1\n", buf.String()); diff != "" {
+		t.Errorf("WriteSave:\n%s", diff)
+	}
+
+	for _, saveService := range []SaveService{
+		{Service: Service{Af: syscall.AF_INET, Protocol: 132 + 1, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc"}},
+		{Service: service, Dests: []Dest{{Addr: net.IP{10, 1, 0, 1}, Port: 80, FwdMethod: IP_VS_CONN_F_BYPASS}}},
+	} {
+		if err := WriteSave(&bytes.Buffer{}, []SaveService{saveService}); err == nil {
+			t.Errorf("WriteSave %v: expected error", saveService.Service)
+		}
+	}
+}
@@ -40,6 +40,39 @@ func (self Protocol) String() string {
 	}
 }
 
+func ParseFlag(value string) (uint32, error) {
+	switch value {
+	case "one-packet":
+		return IP_VS_SVC_F_ONEPACKET, nil
+	case "sh-fallback":
+		return IP_VS_SVC_F_SCHED_SH_FALLBACK, nil
+	case "sh-port":
+		return IP_VS_SVC_F_SCHED_SH_PORT, nil
+	default:
+		return 0, fmt.Errorf("Invalid Flag: %s", value)
+	}
+}
+
+// Schedulers included in the mainline kernel
+func ParseSchedName(value string) (string, error) {
+	switch value {
+	case "rr", "wrr", "lc", "wlc", "lblc", "lblcr", "dh", "sh", "sed", "nq", "fo", "ovf", "mh":
+		return value, nil
+	default:
+		return "", fmt.Errorf("Invalid SchedName: %s", value)
+	}
+}
+
+// Persistence engines included in the mainline kernel
+func ParsePEName(value string) (string, error) {
+	switch value {
+	case "sip":
+		return value, nil
+	default:
+		return "", fmt.Errorf("Invalid PEName: %s", value)
+	}
+}
+
 type Service struct {
 	// id
 	Af       Af
@@ -53,6 +86,10 @@ type Service struct {
 	Flags     Flags
 	Timeout   uint32
 	Netmask   uint32
+	PEName    string
+
+	// info
+	Stats Stats
 }
 
 // Acts as an unique identifier for the Service
@@ -97,7 +134,8 @@ func (service Service) Equals(other Service) bool {
 		return false
 	}
 
-	if service.Flags != other.Flags {
+	// ignore the mask, and the internal flags set by the kernel
+	if (service.Flags.Flags &^ IP_VS_SVC_F_HASHED) != (other.Flags.Flags &^ IP_VS_SVC_F_HASHED) {
 		return false
 	}
 
@@ -109,6 +147,10 @@ func (service Service) Equals(other Service) bool {
 		return false
 	}
 
+	if service.PEName != other.PEName {
+		return false
+	}
+
 	return true
 }
 
@@ -138,10 +180,20 @@ func unpackService(attrs nlgo.AttrMap) (Service, error) {
 			service.Timeout = (uint32)(attr.Value.(nlgo.U32))
 		case IPVS_SVC_ATTR_NETMASK:
 			service.Netmask = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_SVC_ATTR_PE_NAME:
+			service.PEName = (string)(attr.Value.(nlgo.NulString))
+		case IPVS_SVC_ATTR_STATS:
+			if stats, err := unpackStats(attr.Value.(nlgo.AttrMap)); err != nil {
+				return service, fmt.Errorf("ipvs:Service.unpack: stats: %s", err)
+			} else {
+				service.Stats = stats
+			}
 		}
 	}
 
-	if addrIP, err := unpackAddr(addr, service.Af); err != nil {
+	if service.FwMark != 0 {
+		// fwmark services do not have any addr
+	} else if addrIP, err := unpackAddr(addr, service.Af); err != nil {
 		return service, fmt.Errorf("ipvs:Service.unpack: addr: %s", err)
 	} else {
 		service.Addr = addrIP
@@ -182,6 +234,11 @@ func (self *Service) attrs(full bool) nlgo.AttrSlice {
 			nlattr(IPVS_SVC_ATTR_TIMEOUT, nlgo.U32(self.Timeout)),
 			nlattr(IPVS_SVC_ATTR_NETMASK, nlgo.U32(self.Netmask)),
 		)
+
+		// omitted to remove any persistence engine
+		if self.PEName != "" {
+			attrs = append(attrs, nlattr(IPVS_SVC_ATTR_PE_NAME, nlgo.NulString(self.PEName)))
+		}
 	}
 
 	return attrs
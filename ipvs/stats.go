@@ -0,0 +1,49 @@
+package ipvs
+
+import (
+	"github.com/hkwi/nlgo"
+)
+
+// Service/Dest counters and rate estimates
+type Stats struct {
+	Conns    uint32 // connections scheduled
+	InPkts   uint32 // incoming packets
+	OutPkts  uint32 // outgoing packets
+	InBytes  uint64 // incoming bytes
+	OutBytes uint64 // outgoing bytes
+
+	CPS    uint32 // current connection rate
+	InPPS  uint32 // current in packet rate
+	OutPPS uint32 // current out packet rate
+	InBPS  uint32 // current in byte rate
+	OutBPS uint32 // current out byte rate
+}
+
+func unpackStats(attrs nlgo.AttrMap) (stats Stats, err error) {
+	for _, attr := range attrs.Slice() {
+		switch attr.Field() {
+		case IPVS_STATS_ATTR_CONNS:
+			stats.Conns = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_STATS_ATTR_INPKTS:
+			stats.InPkts = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_STATS_ATTR_OUTPKTS:
+			stats.OutPkts = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_STATS_ATTR_INBYTES:
+			stats.InBytes = (uint64)(attr.Value.(nlgo.U64))
+		case IPVS_STATS_ATTR_OUTBYTES:
+			stats.OutBytes = (uint64)(attr.Value.(nlgo.U64))
+		case IPVS_STATS_ATTR_CPS:
+			stats.CPS = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_STATS_ATTR_INPPS:
+			stats.InPPS = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_STATS_ATTR_OUTPPS:
+			stats.OutPPS = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_STATS_ATTR_INBPS:
+			stats.InBPS = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_STATS_ATTR_OUTBPS:
+			stats.OutBPS = (uint32)(attr.Value.(nlgo.U32))
+		}
+	}
+
+	return
+}
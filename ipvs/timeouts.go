@@ -0,0 +1,44 @@
+package ipvs
+
+import (
+	"github.com/hkwi/nlgo"
+)
+
+// Connection timeouts in seconds
+type Timeouts struct {
+	TCP    uint32
+	TCPFin uint32
+	UDP    uint32
+}
+
+func unpackTimeouts(attrs nlgo.AttrMap) (timeouts Timeouts, err error) {
+	for _, attr := range attrs.Slice() {
+		switch attr.Field() {
+		case IPVS_CMD_ATTR_TIMEOUT_TCP:
+			timeouts.TCP = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_CMD_ATTR_TIMEOUT_TCP_FIN:
+			timeouts.TCPFin = (uint32)(attr.Value.(nlgo.U32))
+		case IPVS_CMD_ATTR_TIMEOUT_UDP:
+			timeouts.UDP = (uint32)(attr.Value.(nlgo.U32))
+		}
+	}
+
+	return
+}
+
+// Pack the non-zero Timeouts; any omitted timeouts are left unchanged by the kernel
+func (timeouts Timeouts) attrs() nlgo.AttrSlice {
+	var attrs nlgo.AttrSlice
+
+	if timeouts.TCP != 0 {
+		attrs = append(attrs, nlattr(IPVS_CMD_ATTR_TIMEOUT_TCP, nlgo.U32(timeouts.TCP)))
+	}
+	if timeouts.TCPFin != 0 {
+		attrs = append(attrs, nlattr(IPVS_CMD_ATTR_TIMEOUT_TCP_FIN, nlgo.U32(timeouts.TCPFin)))
+	}
+	if timeouts.UDP != 0 {
+		attrs = append(attrs, nlattr(IPVS_CMD_ATTR_TIMEOUT_UDP, nlgo.U32(timeouts.UDP)))
+	}
+
+	return attrs
+}
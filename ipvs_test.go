@@ -0,0 +1,211 @@
+package clusterf
+
+import (
+	"fmt"
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"sort"
+	"testing"
+	"time"
+)
+
+// In-memory ipvs.Emulator, recording successful write operations
+type testClient struct {
+	*ipvs.Emulator
+
+	ops         []string
+	batches     int
+	activeConns map[string]uint32
+}
+
+func makeTestClient() *testClient {
+	return &testClient{
+		Emulator:    ipvs.NewEmulator(),
+		activeConns: make(map[string]uint32),
+	}
+}
+
+func (client *testClient) op(err error, format string, args ...interface{}) error {
+	if err == nil {
+		client.ops = append(client.ops, fmt.Sprintf(format, args...))
+	}
+
+	return err
+}
+
+// Return and reset the recorded ops, in sorted order
+func (client *testClient) flushOps() []string {
+	ops := client.ops
+
+	client.ops = nil
+
+	sort.Strings(ops)
+
+	return ops
+}
+
+func (client *testClient) Flush() error {
+	return client.op(client.Emulator.Flush(), "flush")
+}
+func (client *testClient) Zero() error {
+	return client.op(client.Emulator.Zero(), "zero")
+}
+
+func (client *testClient) NewService(service ipvs.Service) error {
+	return client.op(client.Emulator.NewService(service), "new %v", service)
+}
+func (client *testClient) SetService(service ipvs.Service) error {
+	return client.op(client.Emulator.SetService(service), "set %v", service)
+}
+func (client *testClient) DelService(service ipvs.Service) error {
+	return client.op(client.Emulator.DelService(service), "del %v", service)
+}
+
+// The emulator does not track connections
+func (client *testClient) ListDests(service ipvs.Service) ([]ipvs.Dest, error) {
+	dests, err := client.Emulator.ListDests(service)
+
+	for i := range dests {
+		dests[i].ActiveConns = client.activeConns[dests[i].String()]
+	}
+
+	return dests, err
+}
+func (client *testClient) NewDest(service ipvs.Service, dest ipvs.Dest) error {
+	return client.op(client.Emulator.NewDest(service, dest), "new %v %v weight=%d", service, dest, dest.Weight)
+}
+func (client *testClient) SetDest(service ipvs.Service, dest ipvs.Dest) error {
+	return client.op(client.Emulator.SetDest(service, dest), "set %v %v weight=%d", service, dest, dest.Weight)
+}
+func (client *testClient) DelDest(service ipvs.Service, dest ipvs.Dest) error {
+	return client.op(client.Emulator.DelDest(service, dest), "del %v %v", service, dest)
+}
+
+// Record the ops for each batched command
+func (client *testClient) ExecBatch(batch *ipvs.Batch) ([]error, error) {
+	client.batches++
+
+	return batch.Exec(client), nil
+}
+
+func (client *testClient) SetTimeouts(timeouts ipvs.Timeouts) error {
+	return client.op(client.Emulator.SetTimeouts(timeouts), "timeouts %+v", timeouts)
+}
+
+func (client *testClient) NewDaemon(daemon ipvs.Daemon) error {
+	return client.op(client.Emulator.NewDaemon(daemon), "new daemon %v", daemon)
+}
+func (client *testClient) DelDaemon(daemon ipvs.Daemon) error {
+	return client.op(client.Emulator.DelDaemon(daemon), "del daemon %v", daemon)
+}
+
+func makeTestDriver(options IPVSOptions, client ipvs.Interface) *IPVSDriver {
+	return &IPVSDriver{
+		options:     options,
+		readClient:  client,
+		writeClient: client,
+		drains:      make(map[drainID]time.Time),
+	}
+}
+
+func testDriverConfig(t *testing.T, driver *IPVSDriver, client *testClient, configServices map[string]config.Service, ops []string) {
+	if err := driver.Config(config.Config{Services: configServices}); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	if diff := pretty.Compare(ops, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Config ops:\n%s", diff)
+	}
+}
+
+func testDriverDrain(t *testing.T, driver *IPVSDriver, client *testClient, ops []string) {
+	if err := driver.Drain(); err != nil {
+		t.Fatalf("IPVSDriver.Drain: %v", err)
+	}
+
+	if diff := pretty.Compare(ops, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Drain ops:\n%s", diff)
+	}
+}
+
+func testDriverReconcile(t *testing.T, driver *IPVSDriver, client *testClient, ops []string) {
+	if err := driver.Reconcile(); err != nil {
+		t.Fatalf("IPVSDriver.Reconcile: %v", err)
+	}
+
+	if diff := pretty.Compare(ops, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Reconcile ops:\n%s", diff)
+	}
+}
+
+func testDriverRetry(t *testing.T, driver *IPVSDriver, client *testClient, ops []string) {
+	if err := driver.Retry(); err != nil {
+		t.Fatalf("IPVSDriver.Retry: %v", err)
+	}
+
+	if diff := pretty.Compare(ops, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Retry ops:\n%s", diff)
+	}
+}
+
+func TestIPVSInstanceOptions(t *testing.T) {
+	var options = IPVSOptions{
+		SchedName: "wlc",
+		Instances: []string{"test1=test1-", "test2", "/proc/1/ns/net=test3-"},
+	}
+
+	instances, err := options.InstanceOptions()
+	if err != nil {
+		t.Fatalf("InstanceOptions: %v", err)
+	}
+
+	var testInstances = []IPVSOptions{
+		{SchedName: "wlc", Netns: "test1", FilterServices: "test1-"},
+		{SchedName: "wlc", Netns: "test2"},
+		{SchedName: "wlc", Netns: "/proc/1/ns/net", FilterServices: "test3-"},
+	}
+
+	if diff := pretty.Compare(testInstances, instances); diff != "" {
+		t.Errorf("InstanceOptions:\n%s", diff)
+	}
+
+	for i, name := range []string{"test1", "test2", "proc-1-ns-net"} {
+		if instanceName := instances[i].InstanceName(); instanceName != name {
+			t.Errorf("InstanceName %v: %v", instances[i].Netns, instanceName)
+		}
+	}
+
+	for _, instances := range [][]string{
+		{"=test1-"},
+		{"test1", "/var/run/netns/test1=test2-"},
+	} {
+		if _, err := (IPVSOptions{Instances: instances}).InstanceOptions(); err == nil {
+			t.Errorf("InstanceOptions %v: expected error", instances)
+		}
+	}
+}
+
+func TestDriverZero(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{SchedName: "wlc"}, client)
+
+	if err := driver.Zero(); err != nil {
+		t.Fatalf("IPVSDriver.Zero: %v", err)
+	}
+
+	if diff := pretty.Compare([]string{"zero"}, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Zero ops:\n%s", diff)
+	}
+
+	// --ipvs-noop
+	driver.writeClient = nil
+
+	if err := driver.Zero(); err != nil {
+		t.Fatalf("IPVSDriver.Zero: %v", err)
+	}
+
+	if ops := client.flushOps(); len(ops) > 0 {
+		t.Errorf("IPVSDriver.Zero noop ops: %v", ops)
+	}
+}
@@ -0,0 +1,252 @@
+package clusterf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Prometheus text-format metrics
+type metricLabels []string // name, value pairs
+
+func (labels metricLabels) String() string {
+	var parts []string
+
+	if len(labels) == 0 {
+		return ""
+	}
+
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+type metricSample struct {
+	labels metricLabels
+	value  uint64
+}
+
+type metric struct {
+	name    string
+	typ     string // counter gauge
+	help    string
+	samples []metricSample
+}
+
+func (m *metric) add(labels metricLabels, value uint64) {
+	m.samples = append(m.samples, metricSample{labels, value})
+}
+
+func (m *metric) write(w io.Writer) error {
+	if len(m.samples) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ); err != nil {
+		return err
+	}
+
+	for _, sample := range m.samples {
+		if _, err := fmt.Fprintf(w, "%s%v %d\n", m.name, sample.labels, sample.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type ipvsMetrics struct {
+	serviceConns    metric
+	serviceInPkts   metric
+	serviceOutPkts  metric
+	serviceInBytes  metric
+	serviceOutBytes metric
+	serviceCPS      metric
+	serviceInPPS    metric
+	serviceOutPPS   metric
+	serviceInBPS    metric
+	serviceOutBPS   metric
+
+	destWeight       metric
+	destActiveConns  metric
+	destInactConns   metric
+	destPersistConns metric
+	destConns        metric
+	destInPkts       metric
+	destOutPkts      metric
+	destInBytes      metric
+	destOutBytes     metric
+	destCPS          metric
+	destInPPS        metric
+	destOutPPS       metric
+	destInBPS        metric
+	destOutBPS       metric
+
+	reconcileDrift metric
+}
+
+func makeIPVSMetrics() ipvsMetrics {
+	return ipvsMetrics{
+		serviceConns:    metric{name: "clusterf_ipvs_service_connections_total", typ: "counter", help: "Connections scheduled for the IPVS service"},
+		serviceInPkts:   metric{name: "clusterf_ipvs_service_in_packets_total", typ: "counter", help: "Incoming packets for the IPVS service"},
+		serviceOutPkts:  metric{name: "clusterf_ipvs_service_out_packets_total", typ: "counter", help: "Outgoing packets for the IPVS service"},
+		serviceInBytes:  metric{name: "clusterf_ipvs_service_in_bytes_total", typ: "counter", help: "Incoming bytes for the IPVS service"},
+		serviceOutBytes: metric{name: "clusterf_ipvs_service_out_bytes_total", typ: "counter", help: "Outgoing bytes for the IPVS service"},
+		serviceCPS:      metric{name: "clusterf_ipvs_service_connection_rate", typ: "gauge", help: "Current connections per second for the IPVS service"},
+		serviceInPPS:    metric{name: "clusterf_ipvs_service_in_packet_rate", typ: "gauge", help: "Current incoming packets per second for the IPVS service"},
+		serviceOutPPS:   metric{name: "clusterf_ipvs_service_out_packet_rate", typ: "gauge", help: "Current outgoing packets per second for the IPVS service"},
+		serviceInBPS:    metric{name: "clusterf_ipvs_service_in_byte_rate", typ: "gauge", help: "Current incoming bytes per second for the IPVS service"},
+		serviceOutBPS:   metric{name: "clusterf_ipvs_service_out_byte_rate", typ: "gauge", help: "Current outgoing bytes per second for the IPVS service"},
+
+		destWeight:       metric{name: "clusterf_ipvs_dest_weight", typ: "gauge", help: "IPVS dest weight"},
+		destActiveConns:  metric{name: "clusterf_ipvs_dest_active_connections", typ: "gauge", help: "Active connections for the IPVS dest"},
+		destInactConns:   metric{name: "clusterf_ipvs_dest_inactive_connections", typ: "gauge", help: "Inactive connections for the IPVS dest"},
+		destPersistConns: metric{name: "clusterf_ipvs_dest_persistent_connections", typ: "gauge", help: "Persistent connections for the IPVS dest"},
+		destConns:        metric{name: "clusterf_ipvs_dest_connections_total", typ: "counter", help: "Connections scheduled for the IPVS dest"},
+		destInPkts:       metric{name: "clusterf_ipvs_dest_in_packets_total", typ: "counter", help: "Incoming packets for the IPVS dest"},
+		destOutPkts:      metric{name: "clusterf_ipvs_dest_out_packets_total", typ: "counter", help: "Outgoing packets for the IPVS dest"},
+		destInBytes:      metric{name: "clusterf_ipvs_dest_in_bytes_total", typ: "counter", help: "Incoming bytes for the IPVS dest"},
+		destOutBytes:     metric{name: "clusterf_ipvs_dest_out_bytes_total", typ: "counter", help: "Outgoing bytes for the IPVS dest"},
+		destCPS:          metric{name: "clusterf_ipvs_dest_connection_rate", typ: "gauge", help: "Current connections per second for the IPVS dest"},
+		destInPPS:        metric{name: "clusterf_ipvs_dest_in_packet_rate", typ: "gauge", help: "Current incoming packets per second for the IPVS dest"},
+		destOutPPS:       metric{name: "clusterf_ipvs_dest_out_packet_rate", typ: "gauge", help: "Current outgoing packets per second for the IPVS dest"},
+		destInBPS:        metric{name: "clusterf_ipvs_dest_in_byte_rate", typ: "gauge", help: "Current incoming bytes per second for the IPVS dest"},
+		destOutBPS:       metric{name: "clusterf_ipvs_dest_out_byte_rate", typ: "gauge", help: "Current outgoing bytes per second for the IPVS dest"},
+
+		reconcileDrift: metric{name: "clusterf_ipvs_reconcile_drift_total", typ: "counter", help: "Differences between the kernel IPVS state and the running state, repaired by reconciling"},
+	}
+}
+
+// Collect metrics for the kernel stats, labeled using the names of the configured services
+func (metrics *ipvsMetrics) collect(stats Services, services Services) {
+	var serviceKeys []string
+
+	for key := range stats {
+		serviceKeys = append(serviceKeys, key)
+	}
+	sort.Strings(serviceKeys)
+
+	for _, serviceKey := range serviceKeys {
+		statsService := stats[serviceKey]
+		configService := services[serviceKey]
+
+		labels := metricLabels{"service", configService.name, "ipvs_service", serviceKey}
+
+		metrics.serviceConns.add(labels, uint64(statsService.Stats.Conns))
+		metrics.serviceInPkts.add(labels, uint64(statsService.Stats.InPkts))
+		metrics.serviceOutPkts.add(labels, uint64(statsService.Stats.OutPkts))
+		metrics.serviceInBytes.add(labels, statsService.Stats.InBytes)
+		metrics.serviceOutBytes.add(labels, statsService.Stats.OutBytes)
+		metrics.serviceCPS.add(labels, uint64(statsService.Stats.CPS))
+		metrics.serviceInPPS.add(labels, uint64(statsService.Stats.InPPS))
+		metrics.serviceOutPPS.add(labels, uint64(statsService.Stats.OutPPS))
+		metrics.serviceInBPS.add(labels, uint64(statsService.Stats.InBPS))
+		metrics.serviceOutBPS.add(labels, uint64(statsService.Stats.OutBPS))
+
+		var destKeys []string
+
+		for key := range statsService.dests {
+			destKeys = append(destKeys, key)
+		}
+		sort.Strings(destKeys)
+
+		for _, destKey := range destKeys {
+			statsDest := statsService.dests[destKey]
+			configDest := configService.dests[destKey]
+
+			labels := metricLabels{"service", configService.name, "backend", configDest.backends.String(), "ipvs_service", serviceKey, "ipvs_dest", destKey}
+
+			metrics.destWeight.add(labels, uint64(statsDest.Weight))
+			metrics.destActiveConns.add(labels, uint64(statsDest.ActiveConns))
+			metrics.destInactConns.add(labels, uint64(statsDest.InactConns))
+			metrics.destPersistConns.add(labels, uint64(statsDest.PersistConns))
+			metrics.destConns.add(labels, uint64(statsDest.Stats.Conns))
+			metrics.destInPkts.add(labels, uint64(statsDest.Stats.InPkts))
+			metrics.destOutPkts.add(labels, uint64(statsDest.Stats.OutPkts))
+			metrics.destInBytes.add(labels, statsDest.Stats.InBytes)
+			metrics.destOutBytes.add(labels, statsDest.Stats.OutBytes)
+			metrics.destCPS.add(labels, uint64(statsDest.Stats.CPS))
+			metrics.destInPPS.add(labels, uint64(statsDest.Stats.InPPS))
+			metrics.destOutPPS.add(labels, uint64(statsDest.Stats.OutPPS))
+			metrics.destInBPS.add(labels, uint64(statsDest.Stats.InBPS))
+			metrics.destOutBPS.add(labels, uint64(statsDest.Stats.OutBPS))
+		}
+	}
+}
+
+func (metrics *ipvsMetrics) write(w io.Writer) error {
+	for _, m := range []*metric{
+		&metrics.serviceConns,
+		&metrics.serviceInPkts,
+		&metrics.serviceOutPkts,
+		&metrics.serviceInBytes,
+		&metrics.serviceOutBytes,
+		&metrics.serviceCPS,
+		&metrics.serviceInPPS,
+		&metrics.serviceOutPPS,
+		&metrics.serviceInBPS,
+		&metrics.serviceOutBPS,
+		&metrics.destWeight,
+		&metrics.destActiveConns,
+		&metrics.destInactConns,
+		&metrics.destPersistConns,
+		&metrics.destConns,
+		&metrics.destInPkts,
+		&metrics.destOutPkts,
+		&metrics.destInBytes,
+		&metrics.destOutBytes,
+		&metrics.destCPS,
+		&metrics.destInPPS,
+		&metrics.destOutPPS,
+		&metrics.destInBPS,
+		&metrics.destOutBPS,
+		&metrics.reconcileDrift,
+	} {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write kernel IPVS service and dest stats in the Prometheus text format
+func (driver *IPVSDriver) WriteMetrics(w io.Writer) error {
+	var metrics = makeIPVSMetrics()
+
+	// listing the kernel stats does not need the running state, and must not block any updates
+	stats, err := driver.list()
+	if err != nil {
+		return err
+	}
+
+	driver.mutex.Lock()
+	metrics.collect(stats, driver.services)
+	metrics.reconcileDrift.add(nil, driver.drift)
+	driver.mutex.Unlock()
+
+	return metrics.write(w)
+}
+
+// Serve /metrics
+func (driver *IPVSDriver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+
+	if err := driver.WriteMetrics(&buf); err != nil {
+		log.Printf("IPVSDriver.WriteMetrics: %v\n", err)
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		buf.WriteTo(w)
+	}
+}
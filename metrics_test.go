@@ -0,0 +1,75 @@
+package clusterf
+
+import (
+	"bytes"
+	"github.com/qmsk/clusterf/ipvs"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	testService := ipvs.Service{
+		Af:       syscall.AF_INET,
+		Protocol: syscall.IPPROTO_TCP,
+		Addr:     net.IP{10, 0, 0, 1},
+		Port:     80,
+	}
+	testDest := ipvs.Dest{
+		Addr:   net.IP{10, 255, 0, 1},
+		Port:   80,
+		Weight: 20,
+	}
+
+	services := make(Services)
+	services.config("test", testService, ServiceDests{
+		"10.255.0.1:80": Dest{Dest: testDest, backends: destBackends{"test1-1", "test1-2"}},
+	})
+
+	testService.Stats = ipvs.Stats{Conns: 10, InBytes: 1 << 40}
+	testDest.ActiveConns = 3
+	testDest.Stats = ipvs.Stats{Conns: 7, CPS: 2}
+
+	stats := make(Services)
+	stats.sync(testService, []ipvs.Dest{testDest})
+	stats.sync(ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_UDP, Addr: net.IP{192, 0, 2, 1}, Port: 53}, nil)
+
+	var metrics = makeIPVSMetrics()
+	var buf bytes.Buffer
+
+	metrics.collect(stats, services)
+
+	if err := metrics.write(&buf); err != nil {
+		t.Fatalf("metrics.write: %v", err)
+	}
+
+	output := buf.String()
+
+	for _, line := range []string{
+		"# TYPE clusterf_ipvs_service_connections_total counter\n",
+		`clusterf_ipvs_service_connections_total{service="test",ipvs_service="inet+tcp://10.0.0.1:80"} 10` + "\n",
+		`clusterf_ipvs_service_connections_total{service="",ipvs_service="inet+udp://192.0.2.1:53"} 0` + "\n",
+		`clusterf_ipvs_service_in_bytes_total{service="test",ipvs_service="inet+tcp://10.0.0.1:80"} 1099511627776` + "\n",
+		`clusterf_ipvs_dest_weight{service="test",backend="test1-1,test1-2",ipvs_service="inet+tcp://10.0.0.1:80",ipvs_dest="10.255.0.1:80"} 20` + "\n",
+		`clusterf_ipvs_dest_active_connections{service="test",backend="test1-1,test1-2",ipvs_service="inet+tcp://10.0.0.1:80",ipvs_dest="10.255.0.1:80"} 3` + "\n",
+		`clusterf_ipvs_dest_connections_total{service="test",backend="test1-1,test1-2",ipvs_service="inet+tcp://10.0.0.1:80",ipvs_dest="10.255.0.1:80"} 7` + "\n",
+		`clusterf_ipvs_dest_connection_rate{service="test",backend="test1-1,test1-2",ipvs_service="inet+tcp://10.0.0.1:80",ipvs_dest="10.255.0.1:80"} 2` + "\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("metrics output missing line: %s", line)
+		}
+	}
+
+	if t.Failed() {
+		t.Logf("metrics output:\n%s", output)
+	}
+}
+
+func TestMetricLabels(t *testing.T) {
+	labels := metricLabels{"service", `test "quoted" \ name`}
+
+	if str := labels.String(); str != `{service="test \"quoted\" \\ name"}` {
+		t.Errorf("metricLabels.String: %s", str)
+	}
+}
@@ -0,0 +1,286 @@
+package clusterf
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"io"
+	"sort"
+	"time"
+)
+
+// Planned IPVS operation, identified by the config service and backend names.
+//
+// The Before and After values use the ipvsadm-save format.
+type PlanOp struct {
+	Op       string   `json:"op"`                 // new, set, drain, del
+	Service  string   `json:"service,omitempty"`  // config service name, empty if not configured
+	Backends []string `json:"backends,omitempty"` // config backend names, empty if not configured
+
+	IPVSService string `json:"ipvs_service,omitempty"`
+	IPVSDest    string `json:"ipvs_dest,omitempty"`
+	VIP         string `json:"vip,omitempty"`
+	Timeouts    bool   `json:"timeouts,omitempty"`
+
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+func (op PlanOp) String() string {
+	var service = op.IPVSService
+
+	if op.Service != "" {
+		service = fmt.Sprintf("%s %s", op.Service, op.IPVSService)
+	}
+
+	switch {
+	case op.Timeouts:
+		return fmt.Sprintf("%s timeouts", op.Op)
+	case op.VIP != "":
+		return fmt.Sprintf("%s vip %s", op.Op, op.VIP)
+	case op.IPVSDest == "":
+		return fmt.Sprintf("%s service %s", op.Op, service)
+	case len(op.Backends) > 0:
+		return fmt.Sprintf("%s service %s backend %v %s", op.Op, service, destBackends(op.Backends), op.IPVSDest)
+	default:
+		return fmt.Sprintf("%s service %s dest %s", op.Op, service, op.IPVSDest)
+	}
+}
+
+// Planned IPVS operations to apply a config, in the order that they would be applied.
+//
+// Any operations that would fail due to conflicts with unmanaged services are listed as errors.
+type Plan struct {
+	Netns  string   `json:"netns,omitempty"`
+	Ops    []PlanOp `json:"ops"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// No changes
+func (plan Plan) Empty() bool {
+	return len(plan.Ops) == 0 && len(plan.Errors) == 0
+}
+
+// Write the plan as text, with a +/- line for each before and after value, and a summary
+func (plan Plan) WriteText(w io.Writer) error {
+	var counts = make(map[string]int)
+
+	if plan.Netns != "" {
+		if _, err := fmt.Fprintf(w, "# netns %s\n", plan.Netns); err != nil {
+			return err
+		}
+	}
+
+	for _, op := range plan.Ops {
+		counts[op.Op]++
+
+		if _, err := fmt.Fprintf(w, "%v\n", op); err != nil {
+			return err
+		}
+
+		if op.Before == "" {
+
+		} else if _, err := fmt.Fprintf(w, "\t- %s\n", op.Before); err != nil {
+			return err
+		}
+
+		if op.After == "" {
+
+		} else if _, err := fmt.Fprintf(w, "\t+ %s\n", op.After); err != nil {
+			return err
+		}
+	}
+
+	for _, err := range plan.Errors {
+		if _, err := fmt.Fprintf(w, "error: %s\n", err); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "Plan: %d to add, %d to change, %d to drain, %d to delete, %d errors\n",
+		counts["new"], counts["set"], counts["drain"], counts["del"], len(plan.Errors),
+	)
+
+	return err
+}
+
+// Write the plan as an indented JSON object
+func (plan Plan) WriteJSON(w io.Writer) error {
+	var encoder = json.NewEncoder(w)
+
+	if plan.Ops == nil {
+		plan.Ops = []PlanOp{}
+	}
+
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(plan)
+}
+
+func (plan *Plan) addTimeouts(before ipvs.Timeouts, after ipvs.Timeouts) {
+	var planOp = PlanOp{
+		Op:       "set",
+		Timeouts: true,
+		After:    fmt.Sprintf("--set %d %d %d", after.TCP, after.TCPFin, after.UDP),
+	}
+
+	if before != (ipvs.Timeouts{}) {
+		planOp.Before = fmt.Sprintf("--set %d %d %d", before.TCP, before.TCPFin, before.UDP)
+	}
+
+	plan.Ops = append(plan.Ops, planOp)
+}
+
+// Add the service and dest operations, sorted by service and dest, looking up the before values from the running services
+func (plan *Plan) addOps(ops updateOps, running Services) error {
+	var planOps []PlanOp
+
+	for _, op := range ops {
+		var oldService, exists = running[op.serviceName]
+		var planOp = PlanOp{
+			Op:          op.op,
+			Service:     op.service.name,
+			IPVSService: op.service.String(),
+		}
+		var err error
+
+		if op.dest == nil {
+			switch op.op {
+			case "new":
+				planOp.After, err = op.service.SaveLine()
+			case "set":
+				if planOp.Before, err = oldService.SaveLine(); err == nil {
+					planOp.After, err = op.service.SaveLine()
+				}
+			case "del":
+				planOp.Before, err = op.service.SaveLine()
+			}
+		} else {
+			var oldDest, destExists = oldService.dests[op.dest.String()]
+
+			planOp.Backends = op.dest.backends
+			planOp.IPVSDest = op.dest.String()
+
+			switch {
+			case op.op == "del":
+				planOp.Before, err = op.dest.SaveLine(op.service.Service)
+			case op.op == "new" || !exists || !destExists:
+				planOp.After, err = op.dest.SaveLine(op.service.Service)
+			default:
+				if planOp.Before, err = oldDest.SaveLine(oldService.Service); err == nil {
+					planOp.After, err = op.dest.SaveLine(op.service.Service)
+				}
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("Plan %v: %v", planOp, err)
+		}
+
+		planOps = append(planOps, planOp)
+	}
+
+	sort.SliceStable(planOps, func(i, j int) bool {
+		if planOps[i].IPVSService != planOps[j].IPVSService {
+			return planOps[i].IPVSService < planOps[j].IPVSService
+		}
+
+		return planOps[i].IPVSDest < planOps[j].IPVSDest
+	})
+
+	plan.Ops = append(plan.Ops, planOps...)
+
+	return nil
+}
+
+// Add the --ipvs-vip-interface operations for the planned running services
+func (plan *Plan) addVIPs(running vips, planned vips) {
+	var newVIPs, delVIPs []string
+
+	for key := range planned {
+		if _, exists := running[key]; !exists {
+			newVIPs = append(newVIPs, key)
+		}
+	}
+
+	for key := range running {
+		if _, exists := planned[key]; !exists {
+			delVIPs = append(delVIPs, key)
+		}
+	}
+
+	sort.Strings(newVIPs)
+	sort.Strings(delVIPs)
+
+	for _, key := range newVIPs {
+		plan.Ops = append(plan.Ops, PlanOp{Op: "new", VIP: key})
+	}
+
+	for _, key := range delVIPs {
+		plan.Ops = append(plan.Ops, PlanOp{Op: "del", VIP: key})
+	}
+}
+
+// Compute the IPVS operations to apply the config, without applying them.
+//
+// Uses the running state from Sync, and the current health state. The running state is left as-is.
+func (driver *IPVSDriver) Plan(config config.Config) (Plan, error) {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	var plan = Plan{Netns: driver.options.Netns}
+
+	routes, err := configRoutes(config.Routes)
+	if err != nil {
+		return plan, err
+	}
+
+	services, err := configServices(config.Services, routes, driver.health, driver.options)
+	if err != nil {
+		return plan, err
+	}
+
+	if timeouts := configTimeouts(config.IPVS.Timeouts); timeouts == driver.timeouts || timeouts == (ipvs.Timeouts{}) {
+
+	} else {
+		plan.addTimeouts(driver.timeouts, timeouts)
+	}
+
+	// planning starts draining any unconfigured dests, which must not affect the running state
+	var drains = make(map[drainID]time.Time)
+
+	for id, t := range driver.drains {
+		drains[id] = t
+	}
+
+	var update = driver.plan(services)
+
+	driver.drains = drains
+
+	// any services adopted on the first update are also running
+	var running = make(Services)
+
+	for serviceName, service := range driver.services {
+		running[serviceName] = service
+	}
+	for serviceName, service := range update.adopted {
+		running[serviceName] = service
+	}
+
+	for _, ops := range []updateOps{update.serviceOps, update.destOps, update.delOps} {
+		if err := plan.addOps(ops, running); err != nil {
+			return plan, err
+		}
+	}
+
+	if driver.addrs != nil {
+		plan.addVIPs(driver.vips, driver.managedVIPs(update.running))
+	}
+
+	for _, err := range update.errors {
+		plan.Errors = append(plan.Errors, err.Error())
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,180 @@
+package clusterf
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName:    "wlc",
+		FwdMethod:    ipvs.IP_VS_CONN_F_MASQ,
+		DrainTimeout: time.Minute,
+	}, client)
+
+	testDriverConfig(t, driver, client, map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+				"test2": config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10},
+			},
+		},
+		"test-old": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.3", TCP: 80},
+		},
+	}, []string{
+		"new inet+tcp://10.0.0.1:80",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+		"new inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=10",
+		"new inet+tcp://10.0.0.3:80",
+	})
+
+	plan, err := driver.Plan(config.Config{
+		Services: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80, Scheduler: "rr"},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 20},
+				},
+			},
+			"test-new": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+				},
+			},
+		},
+		IPVS: config.IPVS{Timeouts: &config.IPVSTimeouts{TCP: 900, TCPFin: 120, UDP: 300}},
+	})
+	if err != nil {
+		t.Fatalf("IPVSDriver.Plan: %v", err)
+	}
+
+	var testPlan = Plan{
+		Ops: []PlanOp{
+			{Op: "set", Timeouts: true, After: "--set 900 120 300"},
+			{Op: "set", Service: "test", IPVSService: "inet+tcp://10.0.0.1:80",
+				Before: "-A -t 10.0.0.1:80 -s wlc",
+				After:  "-A -t 10.0.0.1:80 -s rr",
+			},
+			{Op: "new", Service: "test-new", IPVSService: "inet+tcp://10.0.0.2:80",
+				After: "-A -t 10.0.0.2:80 -s wlc",
+			},
+			{Op: "set", Service: "test", Backends: []string{"test1"}, IPVSService: "inet+tcp://10.0.0.1:80", IPVSDest: "10.1.0.1:8080",
+				Before: "-a -t 10.0.0.1:80 -r 10.1.0.1:8080 -m -w 10",
+				After:  "-a -t 10.0.0.1:80 -r 10.1.0.1:8080 -m -w 20",
+			},
+			{Op: "drain", Service: "test", Backends: []string{"test2"}, IPVSService: "inet+tcp://10.0.0.1:80", IPVSDest: "10.1.0.2:8080",
+				Before: "-a -t 10.0.0.1:80 -r 10.1.0.2:8080 -m -w 10",
+				After:  "-a -t 10.0.0.1:80 -r 10.1.0.2:8080 -m -w 0",
+			},
+			{Op: "new", Service: "test-new", Backends: []string{"test1"}, IPVSService: "inet+tcp://10.0.0.2:80", IPVSDest: "10.1.0.1:8080",
+				After: "-a -t 10.0.0.2:80 -r 10.1.0.1:8080 -m -w 10",
+			},
+			{Op: "del", Service: "test-old", IPVSService: "inet+tcp://10.0.0.3:80",
+				Before: "-A -t 10.0.0.3:80 -s wlc",
+			},
+		},
+	}
+
+	if diff := pretty.Compare(testPlan, plan); diff != "" {
+		t.Errorf("IPVSDriver.Plan:\n%s", diff)
+	}
+
+	// not applied
+	if ops := client.flushOps(); len(ops) > 0 {
+		t.Errorf("IPVSDriver.Plan ops: %v", ops)
+	}
+
+	if len(driver.drains) > 0 {
+		t.Errorf("IPVSDriver.Plan drains: %v", driver.drains)
+	}
+
+	if dest := driver.services["inet+tcp://10.0.0.1:80"].dests["10.1.0.2:8080"]; dest.Weight != 10 {
+		t.Errorf("IPVSDriver.Plan running state: %v", dest)
+	}
+
+	// output
+	var buf bytes.Buffer
+
+	if err := plan.WriteText(&buf); err != nil {
+		t.Fatalf("Plan.WriteText: %v", err)
+	}
+
+	var testText = "" +
+		"set timeouts\n" +
+		"\t+ --set 900 120 300\n" +
+		"set service test inet+tcp://10.0.0.1:80\n" +
+		"\t- -A -t 10.0.0.1:80 -s wlc\n" +
+		"\t+ -A -t 10.0.0.1:80 -s rr\n" +
+		"new service test-new inet+tcp://10.0.0.2:80\n" +
+		"\t+ -A -t 10.0.0.2:80 -s wlc\n" +
+		"set service test inet+tcp://10.0.0.1:80 backend test1 10.1.0.1:8080\n" +
+		"\t- -a -t 10.0.0.1:80 -r 10.1.0.1:8080 -m -w 10\n" +
+		"\t+ -a -t 10.0.0.1:80 -r 10.1.0.1:8080 -m -w 20\n" +
+		"drain service test inet+tcp://10.0.0.1:80 backend test2 10.1.0.2:8080\n" +
+		"\t- -a -t 10.0.0.1:80 -r 10.1.0.2:8080 -m -w 10\n" +
+		"\t+ -a -t 10.0.0.1:80 -r 10.1.0.2:8080 -m -w 0\n" +
+		"new service test-new inet+tcp://10.0.0.2:80 backend test1 10.1.0.1:8080\n" +
+		"\t+ -a -t 10.0.0.2:80 -r 10.1.0.1:8080 -m -w 10\n" +
+		"del service test-old inet+tcp://10.0.0.3:80\n" +
+		"\t- -A -t 10.0.0.3:80 -s wlc\n" +
+		"Plan: 2 to add, 3 to change, 1 to drain, 1 to delete, 0 errors\n"
+
+	if diff := pretty.Compare(testText, buf.String()); diff != "" {
+		t.Errorf("Plan.WriteText:\n%s", diff)
+	}
+
+	buf.Reset()
+
+	if err := plan.WriteJSON(&buf); err != nil {
+		t.Fatalf("Plan.WriteJSON: %v", err)
+	}
+
+	var jsonPlan Plan
+
+	if err := json.Unmarshal(buf.Bytes(), &jsonPlan); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	} else if diff := pretty.Compare(testPlan, jsonPlan); diff != "" {
+		t.Errorf("Plan.WriteJSON:\n%s", diff)
+	}
+}
+
+func TestPlanEmpty(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName: "wlc",
+		FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+	}, client)
+
+	var configServices = map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+		},
+	}
+
+	testDriverConfig(t, driver, client, configServices, []string{
+		"new inet+tcp://10.0.0.1:80",
+	})
+
+	if plan, err := driver.Plan(config.Config{Services: configServices}); err != nil {
+		t.Fatalf("IPVSDriver.Plan: %v", err)
+	} else if !plan.Empty() {
+		t.Errorf("IPVSDriver.Plan: %#v", plan)
+	}
+
+	var buf bytes.Buffer
+
+	if err := (Plan{}).WriteJSON(&buf); err != nil {
+		t.Fatalf("Plan.WriteJSON: %v", err)
+	} else if buf.String() != "{\n  \"ops\": []\n}\n" {
+		t.Errorf("Plan.WriteJSON: %#v", buf.String())
+	}
+}
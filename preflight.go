@@ -0,0 +1,305 @@
+package clusterf
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+type PreflightOptions struct {
+	Root  string `long:"preflight-root" value-name:"PATH" default:"/" description:"Inspect the /proc and /sys filesystems within the root path"`
+	Apply bool   `long:"preflight-apply" description:"Apply any failed sysctls that are required by the config, except for the droute backend sysctls"`
+}
+
+// Kernel prerequisite for the config.
+//
+// The kernel modules are loaded on demand by the kernel, and only need to be available.
+type preflightRequirement struct {
+	module string // kernel module name
+	sysctl string // sysctl name, with a minimum value
+	value  int
+	ipv6   bool // IPv6 support
+	warn   bool // only required on the backends, which may include the local host, and never applied
+
+	reason   string
+	services map[string]bool
+}
+
+func (req preflightRequirement) String() string {
+	switch {
+	case req.module != "":
+		return fmt.Sprintf("module %v", req.module)
+	case req.sysctl != "":
+		return fmt.Sprintf("sysctl %v", req.sysctl)
+	case req.ipv6:
+		return "ipv6"
+	default:
+		return ""
+	}
+}
+
+type preflightRequirements map[string]preflightRequirement
+
+func (reqs preflightRequirements) require(req preflightRequirement, serviceName string) {
+	if existing, exists := reqs[req.String()]; exists {
+		req = existing
+	} else {
+		req.services = make(map[string]bool)
+	}
+
+	req.services[serviceName] = true
+
+	reqs[req.String()] = req
+}
+
+// Add the requirements for the configured services, their schedulers, address families and dest forwarding methods
+func (reqs preflightRequirements) config(options IPVSOptions, config config.Config) error {
+	routes, err := configRoutes(config.Routes)
+	if err != nil {
+		return err
+	}
+
+	services, err := configServices(config.Services, routes, nil, options)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		// the ip_vs module is loaded on demand by the genl family alias
+		reqs.require(preflightRequirement{module: "ip_vs", reason: "IPVS"}, service.name)
+		reqs.require(preflightRequirement{module: "ip_vs_" + service.SchedName, reason: fmt.Sprintf("%v scheduler", service.SchedName)}, service.name)
+
+		if service.PEName != "" {
+			reqs.require(preflightRequirement{module: "ip_vs_pe_" + service.PEName, reason: fmt.Sprintf("%v persistence engine", service.PEName)}, service.name)
+		}
+
+		if service.Af == syscall.AF_INET6 {
+			reqs.require(preflightRequirement{ipv6: true, reason: "IPv6 frontend"}, service.name)
+		}
+
+		for _, dest := range service.dests {
+			var destAf = dest.Af
+
+			if destAf == 0 {
+				destAf = service.Af
+			}
+
+			switch {
+			case dest.FwdMethod == ipvs.IP_VS_CONN_F_MASQ && destAf == syscall.AF_INET:
+				reqs.require(preflightRequirement{sysctl: "net.ipv4.ip_forward", value: 1, reason: "masq forwarding"}, service.name)
+			case dest.FwdMethod == ipvs.IP_VS_CONN_F_MASQ && destAf == syscall.AF_INET6:
+				reqs.require(preflightRequirement{sysctl: "net.ipv6.conf.all.forwarding", value: 1, reason: "masq forwarding"}, service.name)
+			case dest.FwdMethod == ipvs.IP_VS_CONN_F_DROUTE && service.Af == syscall.AF_INET:
+				// the backends must not ARP for the VIP on any shared segment
+				reqs.require(preflightRequirement{sysctl: "net.ipv4.conf.all.arp_ignore", value: 1, warn: true, reason: "droute backends"}, service.name)
+				reqs.require(preflightRequirement{sysctl: "net.ipv4.conf.all.arp_announce", value: 2, warn: true, reason: "droute backends"}, service.name)
+			}
+
+			if destAf == syscall.AF_INET6 {
+				reqs.require(preflightRequirement{ipv6: true, reason: "IPv6 backend"}, service.name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Failed preflight check, with an actionable fix.
+//
+// Warnings are for requirements on the backends, which are not necessarily required on the local host.
+type PreflightFailure struct {
+	Check    string
+	Error    string
+	Reason   string
+	Services []string
+	Fix      string
+	Warning  bool
+}
+
+func (failure PreflightFailure) String() string {
+	return fmt.Sprintf("%s: %s, required for %s by services %s: %s", failure.Check, failure.Error, failure.Reason, strings.Join(failure.Services, ","), failure.Fix)
+}
+
+func (options PreflightOptions) path(parts ...string) string {
+	return filepath.Join(append([]string{options.Root}, parts...)...)
+}
+
+// Kernel modules for the running kernel
+type preflightModules struct {
+	builtin   map[string]bool // modules.builtin
+	available map[string]bool // modules.dep
+}
+
+// Read the module names from the modules.builtin or modules.dep file for the running kernel
+func (options PreflightOptions) readModules(name string) map[string]bool {
+	var modules = make(map[string]bool)
+
+	release, err := ioutil.ReadFile(options.path("proc/sys/kernel/osrelease"))
+	if err != nil {
+		return modules
+	}
+
+	file, err := os.Open(options.path("lib/modules", strings.TrimSpace(string(release)), name))
+	if err != nil {
+		return modules
+	}
+	defer file.Close()
+
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		// kernel/net/netfilter/ipvs/ip_vs_sh.ko.xz: kernel/net/netfilter/ipvs/ip_vs.ko.xz
+		var module = path.Base(strings.SplitN(scanner.Text(), ":", 2)[0])
+
+		if i := strings.Index(module, ".ko"); i >= 0 {
+			module = module[:i]
+		}
+
+		modules[strings.Replace(module, "-", "_", -1)] = true
+	}
+
+	return modules
+}
+
+func (options PreflightOptions) modules() preflightModules {
+	return preflightModules{
+		builtin:   options.readModules("modules.builtin"),
+		available: options.readModules("modules.dep"),
+	}
+}
+
+func (options PreflightOptions) checkModule(req preflightRequirement, modules preflightModules) error {
+	if modules.builtin[req.module] {
+		return nil
+	} else if _, err := os.Stat(options.path("sys/module", req.module)); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	} else if !modules.available[req.module] {
+		return fmt.Errorf("not available")
+	} else {
+		return nil
+	}
+}
+
+func (options PreflightOptions) sysctlPath(name string) string {
+	return options.path("proc/sys", strings.Replace(name, ".", "/", -1))
+}
+
+func (options PreflightOptions) readSysctl(name string) (int, error) {
+	if data, err := ioutil.ReadFile(options.sysctlPath(name)); err != nil {
+		return 0, err
+	} else if value, err := strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+		return 0, fmt.Errorf("invalid value: %v", err)
+	} else {
+		return value, nil
+	}
+}
+
+func (options PreflightOptions) writeSysctl(name string, value int) error {
+	return ioutil.WriteFile(options.sysctlPath(name), []byte(fmt.Sprintf("%d\n", value)), 0644)
+}
+
+// Actionable fix for a failed requirement
+func (req preflightRequirement) fix() string {
+	switch {
+	case req.module != "":
+		return fmt.Sprintf("install the %v kernel module", req.module)
+	case req.sysctl != "":
+		return fmt.Sprintf("sysctl -w %v=%d", req.sysctl, req.value)
+	case req.ipv6:
+		return "boot without ipv6.disable=1"
+	default:
+		return ""
+	}
+}
+
+// Check the requirement, applying any failed sysctls with --preflight-apply, except for any warnings
+func (options PreflightOptions) check(req preflightRequirement, modules preflightModules) error {
+	switch {
+	case req.module != "":
+		return options.checkModule(req, modules)
+
+	case req.sysctl != "":
+		if value, err := options.readSysctl(req.sysctl); err != nil {
+			return err
+		} else if value >= req.value {
+			return nil
+		} else if !options.Apply || req.warn {
+			return fmt.Errorf("is %d, expected %d", value, req.value)
+		} else if err := options.writeSysctl(req.sysctl, req.value); err != nil {
+			return fmt.Errorf("is %d, expected %d: %v", value, req.value, err)
+		} else {
+			log.Printf("Preflight: Apply sysctl %v=%d\n", req.sysctl, req.value)
+
+			return nil
+		}
+
+	case req.ipv6:
+		if _, err := os.Stat(options.path("proc/sys/net/ipv6")); os.IsNotExist(err) {
+			return fmt.Errorf("disabled")
+		} else {
+			return err
+		}
+
+	default:
+		panic("invalid requirement")
+	}
+}
+
+// Check the kernel modules and sysctls required by the config for each --ipvs-instance, returning any failures.
+//
+// The sysctls within /proc/sys/net are checked for the current network namespace.
+func (options PreflightOptions) Preflight(ipvsOptions IPVSOptions, config config.Config) ([]PreflightFailure, error) {
+	var failures []PreflightFailure
+	var modules = options.modules()
+	var reqs = make(preflightRequirements)
+	var checks []string
+
+	instanceOptions, err := ipvsOptions.InstanceOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instanceOptions := range instanceOptions {
+		if err := reqs.config(instanceOptions, config); err != nil {
+			return nil, err
+		}
+	}
+
+	for check := range reqs {
+		checks = append(checks, check)
+	}
+	sort.Strings(checks)
+
+	for _, check := range checks {
+		var req = reqs[check]
+
+		if err := options.check(req, modules); err != nil {
+			var failure = PreflightFailure{
+				Check:   check,
+				Error:   err.Error(),
+				Reason:  req.reason,
+				Fix:     req.fix(),
+				Warning: req.warn,
+			}
+
+			for serviceName := range req.services {
+				failure.Services = append(failure.Services, serviceName)
+			}
+			sort.Strings(failure.Services)
+
+			failures = append(failures, failure)
+		}
+	}
+
+	return failures, nil
+}
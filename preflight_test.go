@@ -0,0 +1,164 @@
+package clusterf
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testPreflightConfig = config.Config{
+	Routes: map[string]config.Route{
+		"test-droute": config.Route{Prefix: "10.2.0.0/16", IPVSMethod: "droute"},
+	},
+	Services: map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080},
+			},
+		},
+		"test-sh": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80, Scheduler: "sh"},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.2.0.1", TCP: 80},
+				"test2": config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080},
+			},
+		},
+		"test6": config.Service{
+			Frontend: &config.ServiceFrontend{IPv6: "2001:db8::1", TCP: 80, Scheduler: "rr"},
+		},
+		"test-mh": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.3", TCP: 80, Scheduler: "mh"},
+		},
+	},
+}
+
+// Create a root filesystem with the given files
+func makeTestPreflightRoot(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "clusterf-preflight")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+
+	for path, content := range files {
+		path = filepath.Join(root, path)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		} else if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	return root
+}
+
+func TestPreflight(t *testing.T) {
+	var ipvsOptions = IPVSOptions{
+		SchedName: "wlc",
+		FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+	}
+	var root = makeTestPreflightRoot(t, map[string]string{
+		"sys/module/ip_vs_wlc/refcnt":             "0\n",
+		"proc/sys/kernel/osrelease":               "5.10.0-test\n",
+		"lib/modules/5.10.0-test/modules.builtin": "kernel/net/netfilter/ipvs/ip_vs_rr.ko\n",
+		"lib/modules/5.10.0-test/modules.dep":     "kernel/net/netfilter/ipvs/ip_vs.ko.xz:\nkernel/net/netfilter/ipvs/ip_vs_sh.ko.xz: kernel/net/netfilter/ipvs/ip_vs.ko.xz\n",
+		"proc/sys/net/ipv4/ip_forward":            "0\n",
+		"proc/sys/net/ipv4/conf/all/arp_ignore":   "0\n",
+		"proc/sys/net/ipv4/conf/all/arp_announce": "2\n",
+	})
+	defer os.RemoveAll(root)
+
+	failures, err := PreflightOptions{Root: root}.Preflight(ipvsOptions, testPreflightConfig)
+	if err != nil {
+		t.Fatalf("Preflight: %v", err)
+	}
+
+	var testFailures = []PreflightFailure{
+		{Check: "ipv6", Error: "disabled", Reason: "IPv6 frontend", Services: []string{"test6"}, Fix: "boot without ipv6.disable=1"},
+		{Check: "module ip_vs_mh", Error: "not available", Reason: "mh scheduler", Services: []string{"test-mh"}, Fix: "install the ip_vs_mh kernel module"},
+		{Check: "sysctl net.ipv4.conf.all.arp_ignore", Error: "is 0, expected 1", Reason: "droute backends", Services: []string{"test-sh"}, Fix: "sysctl -w net.ipv4.conf.all.arp_ignore=1", Warning: true},
+		{Check: "sysctl net.ipv4.ip_forward", Error: "is 0, expected 1", Reason: "masq forwarding", Services: []string{"test", "test-sh"}, Fix: "sysctl -w net.ipv4.ip_forward=1"},
+	}
+
+	if diff := pretty.Compare(testFailures, failures); diff != "" {
+		t.Errorf("Preflight:\n%s", diff)
+	}
+
+	// the ip_vs module is loaded on demand
+	if err := (PreflightOptions{Root: "/nonexistent"}).checkModule(preflightRequirement{module: "ip_vs"}, preflightModules{}); err == nil || err.Error() != "not available" {
+		t.Errorf("checkModule ip_vs: %v", err)
+	}
+
+	// apply sysctls, except for the droute backend warnings
+	failures, err = PreflightOptions{Root: root, Apply: true}.Preflight(ipvsOptions, testPreflightConfig)
+	if err != nil {
+		t.Fatalf("Preflight: %v", err)
+	}
+
+	if diff := pretty.Compare(testFailures[0:3], failures); diff != "" {
+		t.Errorf("Preflight apply:\n%s", diff)
+	}
+
+	for sysctl, value := range map[string]string{"net/ipv4/ip_forward": "1\n", "net/ipv4/conf/all/arp_ignore": "0\n"} {
+		if data, err := ioutil.ReadFile(filepath.Join(root, "proc/sys", sysctl)); err != nil {
+			t.Errorf("ReadFile %v: %v", sysctl, err)
+		} else if string(data) != value {
+			t.Errorf("Preflight apply %v: %#v", sysctl, string(data))
+		}
+	}
+}
+
+func TestPreflightInstances(t *testing.T) {
+	var ipvsOptions = IPVSOptions{
+		SchedName: "wlc",
+		FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		Instances: []string{"test1=test-sh", "test2=test6"},
+	}
+	var root = makeTestPreflightRoot(t, map[string]string{
+		"proc/sys/kernel/osrelease":             "5.10.0-test\n",
+		"lib/modules/5.10.0-test/modules.dep":   "kernel/net/netfilter/ipvs/ip_vs.ko.xz:\n",
+		"proc/sys/net/ipv4/ip_forward":          "1\n",
+		"proc/sys/net/ipv6/conf/all/forwarding": "1\n",
+	})
+	defer os.RemoveAll(root)
+
+	failures, err := PreflightOptions{Root: root}.Preflight(ipvsOptions, testPreflightConfig)
+	if err != nil {
+		t.Fatalf("Preflight: %v", err)
+	}
+
+	var checks []string
+
+	for _, failure := range failures {
+		checks = append(checks, failure.Check+" "+strings.Join(failure.Services, ","))
+	}
+
+	if diff := pretty.Compare([]string{
+		"module ip_vs_rr test6",
+		"module ip_vs_sh test-sh",
+		"sysctl net.ipv4.conf.all.arp_announce test-sh",
+		"sysctl net.ipv4.conf.all.arp_ignore test-sh",
+	}, checks); diff != "" {
+		t.Errorf("Preflight:\n%s", diff)
+	}
+}
+
+func TestPreflightError(t *testing.T) {
+	var config = config.Config{
+		Services: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80, Scheduler: "nope"},
+			},
+		},
+	}
+
+	if _, err := (PreflightOptions{Root: "/nonexistent"}).Preflight(IPVSOptions{SchedName: "wlc"}, config); err == nil {
+		t.Errorf("Preflight: expected error for invalid config")
+	}
+}
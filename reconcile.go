@@ -0,0 +1,89 @@
+package clusterf
+
+import (
+	"log"
+)
+
+// Compare the running state against the kernel state, logging and counting any differences
+func (services Services) drift(kernelServices Services) int {
+	var drift = 0
+
+	for serviceName, service := range services {
+		kernelService, exists := kernelServices[serviceName]
+
+		if !exists {
+			log.Printf("IPVS: Drift: missing service %v\n", service)
+			drift++
+			continue
+		} else if !service.Equals(kernelService.Service) {
+			log.Printf("IPVS: Drift: changed service %v\n", service)
+			drift++
+		}
+
+		for destName, dest := range service.dests {
+			if kernelDest, exists := kernelService.dests[destName]; !exists {
+				log.Printf("IPVS: Drift: missing service %v dest %v\n", service, dest)
+				drift++
+			} else if !dest.Equals(kernelDest.Dest) {
+				log.Printf("IPVS: Drift: changed service %v dest %v\n", service, dest)
+				drift++
+			}
+		}
+
+		for destName, kernelDest := range kernelService.dests {
+			if _, exists := service.dests[destName]; !exists {
+				log.Printf("IPVS: Drift: unknown service %v dest %v\n", service, kernelDest)
+				drift++
+			}
+		}
+	}
+
+	for serviceName, kernelService := range kernelServices {
+		if _, exists := services[serviceName]; !exists {
+			log.Printf("IPVS: Drift: unknown service %v\n", kernelService)
+			drift++
+		}
+	}
+
+	return drift
+}
+
+// Re-read the kernel state, and re-apply the configured state if it has drifted from the running state.
+func (driver *IPVSDriver) Reconcile() error {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	if !driver.configured {
+		return nil
+	}
+
+	services, err := driver.list()
+	if err != nil {
+		return err
+	}
+
+	services = driver.own(services)
+
+	if drift := driver.services.drift(services); drift == 0 {
+		return nil
+	} else {
+		log.Printf("IPVS: Reconcile %d differences\n", drift)
+
+		driver.drift += uint64(drift)
+	}
+
+	driver.services = services
+
+	if err := driver.configure(); err != nil {
+		return err
+	}
+
+	// forget any draining dests that were removed from the kernel
+	for id := range driver.drains {
+		if _, exists := driver.services[id.Service].dests[id.Dest]; !exists {
+			delete(driver.drains, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package clusterf
+
+import (
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName: "wlc",
+		FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+	}, client)
+
+	var configServices = map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+				"test2": config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10},
+			},
+		},
+	}
+
+	// not yet configured
+	testDriverReconcile(t, driver, client, nil)
+
+	testDriverConfig(t, driver, client, configServices, []string{
+		"new inet+tcp://10.0.0.1:80",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+		"new inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=10",
+	})
+
+	// no drift, with the kernel setting internal flags
+	testDriverReconcile(t, driver, client, nil)
+
+	if driver.drift != 0 {
+		t.Errorf("IPVSDriver.Reconcile drift: %d", driver.drift)
+	}
+
+	// manual ipvsadm changes
+	var testService = ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80}
+
+	client.Emulator.DelDest(testService, ipvs.Dest{Addr: net.IP{10, 1, 0, 1}, Port: 8080})
+	client.Emulator.SetDest(testService, ipvs.Dest{Addr: net.IP{10, 1, 0, 2}, Port: 8080, FwdMethod: ipvs.IP_VS_CONN_F_MASQ, Weight: 1})
+	client.Emulator.NewService(ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_UDP, Addr: net.IP{10, 0, 0, 1}, Port: 53, SchedName: "rr"})
+
+	testDriverReconcile(t, driver, client, []string{
+		"del inet+udp://10.0.0.1:53",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+		"set inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=10",
+	})
+
+	if driver.drift != 3 {
+		t.Errorf("IPVSDriver.Reconcile drift: %d", driver.drift)
+	}
+
+	// module reload
+	client.Emulator.Flush()
+
+	testDriverReconcile(t, driver, client, []string{
+		"new inet+tcp://10.0.0.1:80",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+		"new inet+tcp://10.0.0.1:80 10.1.0.2:8080 weight=10",
+	})
+
+	if driver.drift != 4 {
+		t.Errorf("IPVSDriver.Reconcile drift: %d", driver.drift)
+	}
+
+	// repaired
+	testDriverReconcile(t, driver, client, nil)
+}
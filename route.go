@@ -5,6 +5,7 @@ import (
 	"github.com/qmsk/clusterf/config"
 	"github.com/qmsk/clusterf/ipvs"
 	"net"
+	"syscall"
 )
 
 type Routes map[string]Route
@@ -54,6 +55,11 @@ type Route struct {
 	// attributes
 	Gateway    net.IP
 	IPVSMethod *ipvs.FwdMethod // or nil
+
+	// tunnel encapsulation, only for tunnel IPVSMethod
+	TunType  ipvs.TunType
+	TunPort  uint16
+	TunFlags uint16
 }
 
 // Build new route state from config
@@ -86,9 +92,50 @@ func (route *Route) config(configRoute config.Route) error {
 		route.IPVSMethod = &fwdMethod
 	}
 
+	if configRoute.IPVSTunnel == "" {
+		route.TunType = ipvs.IP_VS_CONN_F_TUNNEL_TYPE_IPIP
+	} else if tunType, err := ipvs.ParseTunType(configRoute.IPVSTunnel); err != nil {
+		return err
+	} else if route.IPVSMethod == nil || *route.IPVSMethod != ipvs.IP_VS_CONN_F_TUNNEL {
+		return fmt.Errorf("Invalid IPVSTunnel %v: requires tunnel IPVSMethod", tunType)
+	} else {
+		route.TunType = tunType
+	}
+
+	if configRoute.IPVSTunnelPort == 0 {
+		if route.TunType == ipvs.IP_VS_CONN_F_TUNNEL_TYPE_GUE {
+			return fmt.Errorf("Invalid IPVSTunnel %v: requires IPVSTunnelPort", route.TunType)
+		}
+	} else if route.TunType != ipvs.IP_VS_CONN_F_TUNNEL_TYPE_GUE {
+		return fmt.Errorf("Invalid IPVSTunnelPort for IPVSTunnel %v", route.TunType)
+	} else {
+		route.TunPort = configRoute.IPVSTunnelPort
+	}
+
+	for _, flagName := range configRoute.IPVSTunnelFlags {
+		if flag, err := ipvs.ParseTunFlag(flagName); err != nil {
+			return err
+		} else if route.TunType == ipvs.IP_VS_CONN_F_TUNNEL_TYPE_IPIP {
+			return fmt.Errorf("Invalid IPVSTunnelFlags %v for IPVSTunnel %v", flagName, route.TunType)
+		} else if flag == ipvs.IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM && route.TunType != ipvs.IP_VS_CONN_F_TUNNEL_TYPE_GUE {
+			return fmt.Errorf("Invalid IPVSTunnelFlags %v for IPVSTunnel %v", flagName, route.TunType)
+		} else {
+			route.TunFlags |= flag
+		}
+	}
+
 	return nil
 }
 
+// Address family of a gateway IP, as normalized by Route.config
+func routeAf(ip net.IP) ipvs.Af {
+	if ip.To4() != nil {
+		return syscall.AF_INET
+	} else {
+		return syscall.AF_INET6
+	}
+}
+
 // Match given ip within our prefix
 // Returns true if matches, with the length of the matching prefix
 // Returns false otherwise
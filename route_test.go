@@ -57,3 +57,68 @@ func TestRouteLookup(t *testing.T) {
 		t.Errorf("routes.Lookup 192.0.2.1:\n%s", diff)
 	}
 }
+
+var testIpvsFwdMethodTunnel = ipvs.FwdMethod(ipvs.IP_VS_CONN_F_TUNNEL)
+
+func TestConfigRouteTunnel(t *testing.T) {
+	var route Route
+
+	if err := route.config(config.Route{Prefix: "10.3.0.0/24", Gateway: "10.255.0.3", IPVSMethod: "tunnel", IPVSTunnel: "gue", IPVSTunnelPort: 6080, IPVSTunnelFlags: []string{"csum", "remcsum"}}); err != nil {
+		t.Fatalf("Route.config: %v", err)
+	}
+
+	var testRoute = Route{
+		Prefix:     &net.IPNet{net.IP{10, 3, 0, 0}, net.IPMask{255, 255, 255, 0}},
+		Gateway:    net.IP{10, 255, 0, 3},
+		IPVSMethod: &testIpvsFwdMethodTunnel,
+		TunType:    ipvs.IP_VS_CONN_F_TUNNEL_TYPE_GUE,
+		TunPort:    6080,
+		TunFlags:   ipvs.IP_VS_TUNNEL_ENCAP_FLAG_CSUM | ipvs.IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM,
+	}
+
+	if diff := pretty.Compare(testRoute, route); diff != "" {
+		t.Errorf("Route.config:\n%s", diff)
+	}
+}
+
+var testConfigRouteTunnelError = map[string]struct {
+	config config.Route
+	error  string
+}{
+	"tunnel-type": {
+		config: config.Route{IPVSMethod: "tunnel", IPVSTunnel: "vxlan"},
+		error:  "Invalid TunType: vxlan",
+	},
+	"tunnel-method": {
+		config: config.Route{IPVSMethod: "droute", IPVSTunnel: "gre"},
+		error:  "Invalid IPVSTunnel gre: requires tunnel IPVSMethod",
+	},
+	"gue-port": {
+		config: config.Route{IPVSMethod: "tunnel", IPVSTunnel: "gue"},
+		error:  "Invalid IPVSTunnel gue: requires IPVSTunnelPort",
+	},
+	"gre-port": {
+		config: config.Route{IPVSMethod: "tunnel", IPVSTunnel: "gre", IPVSTunnelPort: 6080},
+		error:  "Invalid IPVSTunnelPort for IPVSTunnel gre",
+	},
+	"ipip-flags": {
+		config: config.Route{IPVSMethod: "tunnel", IPVSTunnelFlags: []string{"csum"}},
+		error:  "Invalid IPVSTunnelFlags csum for IPVSTunnel ipip",
+	},
+	"gre-remcsum": {
+		config: config.Route{IPVSMethod: "tunnel", IPVSTunnel: "gre", IPVSTunnelFlags: []string{"remcsum"}},
+		error:  "Invalid IPVSTunnelFlags remcsum for IPVSTunnel gre",
+	},
+}
+
+func TestConfigRouteTunnelError(t *testing.T) {
+	for testName, test := range testConfigRouteTunnelError {
+		var route Route
+
+		if err := route.config(test.config); err == nil {
+			t.Errorf("%v Route.config: expected error", testName)
+		} else if err.Error() != test.error {
+			t.Errorf("%v Route.config: %v", testName, err)
+		}
+	}
+}
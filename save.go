@@ -0,0 +1,249 @@
+package clusterf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"syscall"
+)
+
+// Sorted services and dests, in the ipvsadm-save format
+func (services Services) save() []ipvs.SaveService {
+	var saveServices []ipvs.SaveService
+	var serviceKeys []string
+
+	for key := range services {
+		serviceKeys = append(serviceKeys, key)
+	}
+	sort.Strings(serviceKeys)
+
+	for _, serviceKey := range serviceKeys {
+		var service = services[serviceKey]
+		var saveService = ipvs.SaveService{Service: service.Service}
+		var destKeys []string
+
+		for key := range service.dests {
+			destKeys = append(destKeys, key)
+		}
+		sort.Strings(destKeys)
+
+		for _, destKey := range destKeys {
+			saveService.Dests = append(saveService.Dests, service.dests[destKey].Dest)
+		}
+
+		saveServices = append(saveServices, saveService)
+	}
+
+	return saveServices
+}
+
+// Write the running state in the ipvsadm-save format.
+//
+// With --ipvs-noop, this is the planned state, as it would be applied.
+func (driver *IPVSDriver) Save(w io.Writer) error {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	return ipvs.WriteSave(w, driver.services.save())
+}
+
+func importServiceName(service ipvs.Service) string {
+	if service.FwMark != 0 {
+		return fmt.Sprintf("fwmark-%d", service.FwMark)
+	} else {
+		return fmt.Sprintf("%v-%v-%d", service.Protocol, service.Addr, service.Port)
+	}
+}
+
+func importBackendName(dest ipvs.Dest) string {
+	if dest.Port == 0 {
+		return dest.Addr.String()
+	} else {
+		return fmt.Sprintf("%v-%d", dest.Addr, dest.Port)
+	}
+}
+
+func importFrontend(service ipvs.Service, options IPVSOptions) (*config.ServiceFrontend, error) {
+	var frontend config.ServiceFrontend
+
+	switch {
+	case service.FwMark != 0:
+		frontend.FwMark = service.FwMark
+	case service.Af == syscall.AF_INET:
+		frontend.IPv4 = service.Addr.String()
+	case service.Af == syscall.AF_INET6:
+		frontend.IPv6 = service.Addr.String()
+	}
+
+	switch {
+	case service.FwMark != 0:
+
+	case service.Protocol == syscall.IPPROTO_TCP:
+		frontend.TCP = service.Port
+	case service.Protocol == syscall.IPPROTO_UDP:
+		frontend.UDP = service.Port
+	case service.Protocol == syscall.IPPROTO_SCTP:
+		frontend.SCTP = service.Port
+	}
+
+	if service.SchedName != options.SchedName {
+		frontend.Scheduler = service.SchedName
+	}
+
+	if service.Flags.Flags&ipvs.IP_VS_SVC_F_PERSISTENT != 0 {
+		frontend.Persistence = service.Timeout
+		frontend.PersistenceEngine = service.PEName
+	}
+
+	switch service.Af {
+	case syscall.AF_INET:
+		var mask = make(net.IPMask, 4)
+
+		binary.NativeEndian.PutUint32(mask, service.Netmask)
+
+		if ones, bits := mask.Size(); bits == 0 {
+			return nil, fmt.Errorf("Invalid IPv4 netmask: %v", net.IP(mask))
+		} else if ones != 32 {
+			frontend.Netmask = uint(ones)
+		}
+	case syscall.AF_INET6:
+		if service.Netmask != 128 {
+			frontend.Netmask = uint(service.Netmask)
+		}
+	}
+
+	for _, flagName := range []string{"one-packet", "sh-fallback", "sh-port"} {
+		if flag, _ := ipvs.ParseFlag(flagName); service.Flags.Flags&flag != 0 {
+			frontend.Flags = append(frontend.Flags, flagName)
+		}
+	}
+
+	return &frontend, nil
+}
+
+func importBackend(service ipvs.Service, dest ipvs.Dest) (config.ServiceBackend, error) {
+	var backend = config.ServiceBackend{
+		Weight:         uint(dest.Weight),
+		UpperThreshold: uint(dest.UThresh),
+		LowerThreshold: uint(dest.LThresh),
+	}
+
+	if dest.Af != 0 && dest.Af != service.Af {
+		return backend, fmt.Errorf("Unsupported %v dest for %v service", dest.Af, service.Af)
+	}
+
+	switch service.Af {
+	case syscall.AF_INET:
+		backend.IPv4 = dest.Addr.String()
+	case syscall.AF_INET6:
+		backend.IPv6 = dest.Addr.String()
+	}
+
+	switch {
+	case service.FwMark != 0:
+		if dest.Port != 0 {
+			return backend, fmt.Errorf("Unsupported dest port %d for fwmark service", dest.Port)
+		}
+	case service.Protocol == syscall.IPPROTO_TCP:
+		backend.TCP = dest.Port
+	case service.Protocol == syscall.IPPROTO_UDP:
+		backend.UDP = dest.Port
+	case service.Protocol == syscall.IPPROTO_SCTP:
+		backend.SCTP = dest.Port
+	}
+
+	return backend, nil
+}
+
+// Host route for the dest forwarding method, or nil if using the default forwarding method
+func importRoute(dest ipvs.Dest, options IPVSOptions) *config.Route {
+	if dest.FwdMethod == options.FwdMethod && dest.TunType == ipvs.IP_VS_CONN_F_TUNNEL_TYPE_IPIP && dest.TunFlags == 0 {
+		return nil
+	}
+
+	var route = config.Route{
+		IPVSMethod:     dest.FwdMethod.String(),
+		IPVSTunnelPort: dest.TunPort,
+	}
+
+	if dest.Addr.To4() != nil {
+		route.Prefix = fmt.Sprintf("%v/32", dest.Addr)
+	} else {
+		route.Prefix = fmt.Sprintf("%v/128", dest.Addr)
+	}
+
+	if dest.TunType != ipvs.IP_VS_CONN_F_TUNNEL_TYPE_IPIP {
+		route.IPVSTunnel = dest.TunType.String()
+	}
+
+	for _, flagName := range []string{"csum", "remcsum"} {
+		if flag, _ := ipvs.ParseTunFlag(flagName); dest.TunFlags&flag != 0 {
+			route.IPVSTunnelFlags = append(route.IPVSTunnelFlags, flagName)
+		}
+	}
+
+	return &route
+}
+
+// Build a config from an ipvsadm-save dump, such that applying the config with the same options results in the same IPVS state.
+//
+// Each IPVS service is configured as a separate service, with the exception of fwmark services for both address families.
+// Dests using a forwarding method other than the default --ipvs-fwd-method are configured using host routes.
+func ImportSave(saveServices []ipvs.SaveService, options IPVSOptions) (config.Config, error) {
+	var importConfig = config.Config{
+		Services: make(map[string]config.Service),
+		Routes:   make(map[string]config.Route),
+	}
+
+	// dest addrs using the default forwarding method
+	var defaultRoutes = make(map[string]bool)
+
+	for _, saveService := range saveServices {
+		var serviceName = importServiceName(saveService.Service)
+
+		frontend, err := importFrontend(saveService.Service, options)
+		if err != nil {
+			return importConfig, fmt.Errorf("Import service %v: %v", saveService.Service, err)
+		}
+
+		configService, exists := importConfig.Services[serviceName]
+		if !exists {
+			configService = config.Service{
+				Frontend: frontend,
+				Backends: make(map[string]config.ServiceBackend),
+			}
+		} else if !reflect.DeepEqual(configService.Frontend, frontend) {
+			return importConfig, fmt.Errorf("Import service %v: conflicting params for %v", saveService.Service, serviceName)
+		}
+
+		for _, dest := range saveService.Dests {
+			var routeName = "import-" + dest.Addr.String()
+
+			if backend, err := importBackend(saveService.Service, dest); err != nil {
+				return importConfig, fmt.Errorf("Import service %v dest %v: %v", saveService.Service, dest, err)
+			} else {
+				configService.Backends[importBackendName(dest)] = backend
+			}
+
+			route := importRoute(dest, options)
+			existingRoute, routeExists := importConfig.Routes[routeName]
+
+			if route == nil && !routeExists {
+				defaultRoutes[routeName] = true
+			} else if route == nil || defaultRoutes[routeName] || (routeExists && !reflect.DeepEqual(existingRoute, *route)) {
+				return importConfig, fmt.Errorf("Import service %v dest %v: conflicting forwarding method for dest %v", saveService.Service, dest, dest.Addr)
+			} else {
+				importConfig.Routes[routeName] = *route
+			}
+		}
+
+		importConfig.Services[serviceName] = configService
+	}
+
+	return importConfig, nil
+}
@@ -0,0 +1,80 @@
+package clusterf
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/ipvs"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var testSaveOptions = IPVSOptions{
+	SchedName: "wlc",
+	FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+	Elide:     true,
+}
+
+// Import testdata/ipvsadm.save into the config in testdata/ipvsadm.json, and apply the config to save the same ipvsadm.save
+func TestSaveRoundtrip(t *testing.T) {
+	goldenSave, err := ioutil.ReadFile("testdata/ipvsadm.save")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	goldenJSON, err := ioutil.ReadFile("testdata/ipvsadm.json")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	saveServices, err := ipvs.ParseSave(bytes.NewReader(goldenSave))
+	if err != nil {
+		t.Fatalf("ipvs.ParseSave: %v", err)
+	}
+
+	importConfig, err := ImportSave(saveServices, testSaveOptions)
+	if err != nil {
+		t.Fatalf("ImportSave: %v", err)
+	}
+
+	if importJSON, err := json.MarshalIndent(importConfig, "", "  "); err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	} else if diff := pretty.Compare(strings.TrimSpace(string(goldenJSON)), string(importJSON)); diff != "" {
+		t.Errorf("ImportSave:\n%s", diff)
+	}
+
+	var driver = makeTestDriver(testSaveOptions, makeTestClient())
+	var buf bytes.Buffer
+
+	if err := driver.Config(importConfig); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	if err := driver.Save(&buf); err != nil {
+		t.Fatalf("IPVSDriver.Save: %v", err)
+	}
+
+	if diff := pretty.Compare(string(goldenSave), buf.String()); diff != "" {
+		t.Errorf("IPVSDriver.Save:\n%s", diff)
+	}
+}
+
+func TestImportSaveError(t *testing.T) {
+	for _, save := range []string{
+		// mixed-family dest
+		"-A -t 10.0.0.1:80\n-a -t 10.0.0.1:80 -r [2001:db8::1]:80 -i",
+		// fwmark dest port
+		"-A -f 42\n-a -f 42 -r 10.1.0.1:80 -m",
+		// conflicting forwarding methods
+		"-A -t 10.0.0.1:80\n-a -t 10.0.0.1:80 -r 10.1.0.1:80 -m\n-a -t 10.0.0.1:80 -r 10.1.0.1:81 -g",
+		"-A -t 10.0.0.1:80\n-a -t 10.0.0.1:80 -r 10.1.0.1:80 -g\n-a -t 10.0.0.1:80 -r 10.1.0.1:81 -i",
+		// conflicting fwmark service params
+		"-A -f 42 -s wlc\n-A -f 42 -6 -s rr",
+	} {
+		if saveServices, err := ipvs.ParseSave(strings.NewReader(save)); err != nil {
+			t.Fatalf("ipvs.ParseSave %#v: %v", save, err)
+		} else if _, err := ImportSave(saveServices, testSaveOptions); err == nil {
+			t.Errorf("ImportSave %#v: expected error", save)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package clusterf
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/qmsk/clusterf/ipvs"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type fwmarkRange struct {
+	min uint32
+	max uint32
+}
+
+func parseFwMarkRange(value string) (fwmarkRange, error) {
+	var parts = strings.SplitN(value, "-", 2)
+	var fwmarks fwmarkRange
+
+	if min, err := strconv.ParseUint(parts[0], 0, 32); err != nil {
+		return fwmarks, fmt.Errorf("Invalid fwmark %v: %v", parts[0], err)
+	} else {
+		fwmarks.min = uint32(min)
+		fwmarks.max = uint32(min)
+	}
+
+	if len(parts) == 1 {
+
+	} else if max, err := strconv.ParseUint(parts[1], 0, 32); err != nil {
+		return fwmarks, fmt.Errorf("Invalid fwmark %v: %v", parts[1], err)
+	} else if uint32(max) < fwmarks.min {
+		return fwmarks, fmt.Errorf("Invalid fwmark range %v", value)
+	} else {
+		fwmarks.max = uint32(max)
+	}
+
+	return fwmarks, nil
+}
+
+// Kernel IPVS services managed by the driver, from the --ipvs-scope-* options.
+//
+// All services are within the scope if there are no scope options.
+type ipvsScope struct {
+	prefixes []*net.IPNet
+	ports    map[uint16]bool
+	fwmarks  []fwmarkRange
+}
+
+func (options IPVSOptions) scope() (ipvsScope, error) {
+	var scope = ipvsScope{
+		ports: make(map[uint16]bool),
+	}
+
+	for _, prefix := range options.ScopePrefix {
+		if _, ipnet, err := net.ParseCIDR(prefix); err != nil {
+			return scope, fmt.Errorf("Invalid --ipvs-scope-prefix=%v: %v", prefix, err)
+		} else {
+			scope.prefixes = append(scope.prefixes, ipnet)
+		}
+	}
+
+	for _, port := range options.ScopePort {
+		scope.ports[port] = true
+	}
+
+	for _, fwmark := range options.ScopeFwMark {
+		if fwmarks, err := parseFwMarkRange(fwmark); err != nil {
+			return scope, fmt.Errorf("Invalid --ipvs-scope-fwmark=%v: %v", fwmark, err)
+		} else {
+			scope.fwmarks = append(scope.fwmarks, fwmarks)
+		}
+	}
+
+	return scope, nil
+}
+
+func (scope ipvsScope) scoped() bool {
+	return len(scope.prefixes) > 0 || len(scope.ports) > 0 || len(scope.fwmarks) > 0
+}
+
+func (scope ipvsScope) match(service ipvs.Service) bool {
+	if !scope.scoped() {
+		return true
+	}
+
+	if service.FwMark != 0 {
+		for _, fwmarks := range scope.fwmarks {
+			if service.FwMark >= fwmarks.min && service.FwMark <= fwmarks.max {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(scope.prefixes) == 0 && len(scope.ports) == 0 {
+		// only fwmark services
+		return false
+	}
+
+	if len(scope.ports) > 0 && !scope.ports[service.Port] {
+		return false
+	}
+
+	if len(scope.prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range scope.prefixes {
+		if prefix.Contains(service.Addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Persisted --ipvs-state
+type ipvsState struct {
+	Services []string `json:"services"`
+	VIPs     []string `json:"vips,omitempty"`
+}
+
+// Load the sets of owned services and VIPs, or nil if the state file does not exist yet
+func loadState(path string) (map[string]bool, map[string]bool, error) {
+	var state ipvsState
+
+	if data, err := ioutil.ReadFile(path); os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	} else if err := json.Unmarshal(data, &state); err != nil {
+		return nil, nil, fmt.Errorf("Invalid state %v: %v", path, err)
+	}
+
+	var owned = make(map[string]bool)
+	var ownedVIPs = make(map[string]bool)
+
+	for _, service := range state.Services {
+		owned[service] = true
+	}
+
+	for _, vip := range state.VIPs {
+		ownedVIPs[vip] = true
+	}
+
+	return owned, ownedVIPs, nil
+}
+
+// Persist the sets of owned services and VIPs
+func saveState(path string, owned map[string]bool, ownedVIPs map[string]bool) error {
+	var state = ipvsState{Services: []string{}}
+
+	for service := range owned {
+		state.Services = append(state.Services, service)
+	}
+	sort.Strings(state.Services)
+
+	for vip := range ownedVIPs {
+		state.VIPs = append(state.VIPs, vip)
+	}
+	sort.Strings(state.VIPs)
+
+	if data, err := json.MarshalIndent(state, "", "  "); err != nil {
+		return err
+	} else {
+		return replaceFile(path, append(data, '\n'))
+	}
+}
+
+// Write the file contents using a temporary file, such that readers never see a partially written file
+func replaceFile(path string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	} else if err := tmpFile.Chmod(0644); err != nil {
+		tmpFile.Close()
+		return err
+	} else if err := tmpFile.Close(); err != nil {
+		return err
+	} else if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Only manage kernel services within the scope, or those created by us when using --ipvs-state
+func (driver *IPVSDriver) scoped() bool {
+	return driver.scope.scoped() || driver.options.State != ""
+}
+
+// Split the kernel services into the owned services, retaining any unowned services separately.
+//
+// With --ipvs-state, only the services in the persisted state are owned.
+func (driver *IPVSDriver) own(services Services) Services {
+	var owned = make(Services)
+
+	driver.unowned = make(Services)
+
+	for serviceName, service := range services {
+		if !driver.scope.match(service.Service) {
+			driver.unowned[serviceName] = service
+		} else if driver.options.State != "" && !driver.owned[serviceName] {
+			driver.unowned[serviceName] = service
+		} else {
+			owned[serviceName] = service
+		}
+	}
+
+	return owned
+}
+
+func equalSets(a map[string]bool, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key := range a {
+		if !b[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Update the persisted state for the running services and VIPs.
+//
+// Failures to save the state are logged, and retried on the next update.
+// Nothing is saved before the first update has adopted any configured services.
+func (driver *IPVSDriver) updateState(services Services) {
+	if driver.options.State == "" || driver.adopt {
+		return
+	}
+
+	var owned = make(map[string]bool)
+	var ownedVIPs = make(map[string]bool)
+
+	for serviceName := range services {
+		owned[serviceName] = true
+	}
+
+	for key := range driver.vips {
+		ownedVIPs[key] = true
+	}
+
+	if driver.stateSaved && equalSets(owned, driver.owned) && equalSets(ownedVIPs, driver.ownedVIPs) {
+		return
+	}
+
+	driver.owned = owned
+	driver.ownedVIPs = ownedVIPs
+
+	if driver.writeClient == nil {
+		// the services were not created
+		return
+	}
+
+	if err := saveState(driver.options.State, owned, ownedVIPs); err != nil {
+		log.Printf("IPVS: Save state %v: %v\n", driver.options.State, err)
+
+		driver.stateSaved = false
+	} else {
+		driver.stateSaved = true
+	}
+}
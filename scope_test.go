@@ -0,0 +1,237 @@
+package clusterf
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestScopeMatch(t *testing.T) {
+	var testService = ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80}
+	var testService6 = ipvs.Service{Af: syscall.AF_INET6, Protocol: syscall.IPPROTO_TCP, Addr: net.ParseIP("2001:db8::1"), Port: 443}
+	var testFwMark = ipvs.Service{Af: syscall.AF_INET, FwMark: 42}
+
+	for _, test := range []struct {
+		options IPVSOptions
+		service ipvs.Service
+		match   bool
+	}{
+		{IPVSOptions{}, testService, true},
+		{IPVSOptions{}, testFwMark, true},
+		{IPVSOptions{ScopePrefix: []string{"10.0.0.0/24"}}, testService, true},
+		{IPVSOptions{ScopePrefix: []string{"10.0.1.0/24"}}, testService, false},
+		{IPVSOptions{ScopePrefix: []string{"10.0.0.0/24"}}, testService6, false},
+		{IPVSOptions{ScopePrefix: []string{"10.0.0.0/24"}}, testFwMark, false},
+		{IPVSOptions{ScopePrefix: []string{"10.0.0.0/24", "2001:db8::/64"}}, testService6, true},
+		{IPVSOptions{ScopePrefix: []string{"10.0.0.0/24"}, ScopePort: []uint16{80}}, testService, true},
+		{IPVSOptions{ScopePrefix: []string{"10.0.0.0/24"}, ScopePort: []uint16{443}}, testService, false},
+		{IPVSOptions{ScopePort: []uint16{80, 443}}, testService, true},
+		{IPVSOptions{ScopePort: []uint16{80, 443}}, testService6, true},
+		{IPVSOptions{ScopeFwMark: []string{"40-49"}}, testFwMark, true},
+		{IPVSOptions{ScopeFwMark: []string{"40-49"}}, testService, false},
+		{IPVSOptions{ScopeFwMark: []string{"41"}}, testFwMark, false},
+		{IPVSOptions{ScopeFwMark: []string{"0x2a"}}, testFwMark, true},
+	} {
+		scope, err := test.options.scope()
+		if err != nil {
+			t.Errorf("IPVSOptions %#v scope: %v", test.options, err)
+		} else if match := scope.match(test.service); match != test.match {
+			t.Errorf("IPVSOptions %#v scope match %v: %v", test.options, test.service, match)
+		}
+	}
+
+	for _, options := range []IPVSOptions{
+		{ScopePrefix: []string{"10.0.0.1"}},
+		{ScopeFwMark: []string{"x"}},
+		{ScopeFwMark: []string{"42-"}},
+		{ScopeFwMark: []string{"42-40"}},
+	} {
+		if _, err := options.scope(); err == nil {
+			t.Errorf("IPVSOptions %#v scope: expected error", options)
+		}
+	}
+}
+
+func TestScope(t *testing.T) {
+	var client = makeTestClient()
+	var options = IPVSOptions{
+		SchedName:   "wlc",
+		FwdMethod:   ipvs.IP_VS_CONN_F_MASQ,
+		ScopePrefix: []string{"10.0.0.0/24"},
+	}
+	var driver = makeTestDriver(options, client)
+
+	if scope, err := options.scope(); err != nil {
+		t.Fatalf("IPVSOptions.scope: %v", err)
+	} else {
+		driver.scope = scope
+	}
+
+	var configServices = map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+			},
+		},
+		"test-unscoped": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.1.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+			},
+		},
+	}
+
+	// managed by keepalived
+	var unscopedService = ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 1, 2}, Port: 80, SchedName: "rr"}
+	var scopedService = ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 2}, Port: 80, SchedName: "rr"}
+
+	client.Emulator.NewService(unscopedService)
+	client.Emulator.NewService(scopedService)
+
+	if err := driver.Sync(); err != nil {
+		t.Fatalf("IPVSDriver.Sync: %v", err)
+	}
+
+	testDriverConfig(t, driver, client, configServices, []string{
+		"del inet+tcp://10.0.0.2:80",
+		"new inet+tcp://10.0.0.1:80",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+	})
+
+	// no drift
+	testDriverReconcile(t, driver, client, nil)
+
+	if err := driver.Flush(); err != nil {
+		t.Fatalf("IPVSDriver.Flush: %v", err)
+	}
+
+	if diff := pretty.Compare([]string{"del inet+tcp://10.0.0.1:80"}, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Flush ops:\n%s", diff)
+	}
+
+	if services, err := client.ListServices(); err != nil {
+		t.Fatalf("ListServices: %v", err)
+	} else if len(services) != 1 || services[0].String() != unscopedService.String() {
+		t.Errorf("IPVSDriver.Flush: services %v", services)
+	}
+}
+
+func TestScopeState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clusterf-state")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var client = makeTestClient()
+	var options = IPVSOptions{
+		SchedName:   "wlc",
+		FwdMethod:   ipvs.IP_VS_CONN_F_MASQ,
+		ScopePrefix: []string{"10.0.0.0/24"},
+		State:       filepath.Join(dir, "state.json"),
+	}
+	var configServices = map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+			},
+		},
+	}
+
+	// without any existing state, adopt any configured services within the scope, leaving alone any other services
+	var adoptedService = ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc"}
+	var existingService = ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 3}, Port: 80, SchedName: "wlc"}
+
+	client.Emulator.NewService(adoptedService)
+	client.Emulator.NewService(existingService)
+
+	var driver = makeTestDriver(options, client)
+
+	driver.scope, _ = options.scope()
+	driver.adopt = true
+
+	if err := driver.Sync(); err != nil {
+		t.Fatalf("IPVSDriver.Sync: %v", err)
+	}
+
+	// a restart before the first update must still adopt the configured services
+	if owned, _, err := loadState(options.State); err != nil {
+		t.Fatalf("loadState: %v", err)
+	} else if owned != nil {
+		t.Errorf("IPVSDriver.Sync: saved state before adopting: %v", owned)
+	}
+
+	testDriverConfig(t, driver, client, configServices, []string{
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+		"set inet+tcp://10.0.0.1:80",
+	})
+
+	if owned, _, err := loadState(options.State); err != nil {
+		t.Fatalf("loadState: %v", err)
+	} else if diff := pretty.Compare(map[string]bool{"inet+tcp://10.0.0.1:80": true}, owned); diff != "" {
+		t.Errorf("loadState:\n%s", diff)
+	}
+
+	if services, err := client.ListServices(); err != nil {
+		t.Fatalf("ListServices: %v", err)
+	} else if len(services) != 2 || services[1].String() != existingService.String() {
+		t.Errorf("IPVSDriver.Config: services %v", services)
+	}
+
+	// restart, with services created by hand within the scope
+	var manualService = ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 2}, Port: 80, SchedName: "rr"}
+
+	client.Emulator.NewService(manualService)
+
+	driver = makeTestDriver(options, client)
+	driver.scope, _ = options.scope()
+
+	if owned, _, err := loadState(options.State); err != nil {
+		t.Fatalf("loadState: %v", err)
+	} else {
+		driver.owned = owned
+	}
+
+	if err := driver.Sync(); err != nil {
+		t.Fatalf("IPVSDriver.Sync: %v", err)
+	}
+
+	testDriverConfig(t, driver, client, configServices, nil)
+
+	// conflicting with a service created by hand
+	configServices["test2"] = config.Service{
+		Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80},
+	}
+
+	if err := driver.Config(config.Config{Services: configServices}); err == nil {
+		t.Fatalf("IPVSDriver.Config: should fail")
+	} else if err.Error() != "new service test2 inet+tcp://10.0.0.2:80: conflict with unmanaged service" {
+		t.Errorf("IPVSDriver.Config: %v", err)
+	}
+
+	if ops := client.flushOps(); len(ops) > 0 {
+		t.Errorf("IPVSDriver.Config ops: %v", ops)
+	}
+
+	if err := driver.Flush(); err != nil {
+		t.Fatalf("IPVSDriver.Flush: %v", err)
+	}
+
+	if diff := pretty.Compare([]string{"del inet+tcp://10.0.0.1:80"}, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Flush ops:\n%s", diff)
+	}
+
+	if owned, _, err := loadState(options.State); err != nil {
+		t.Fatalf("loadState: %v", err)
+	} else if len(owned) != 0 {
+		t.Errorf("loadState: %v", owned)
+	}
+}
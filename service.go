@@ -1,6 +1,7 @@
 package clusterf
 
 import (
+	"encoding/binary"
 	"fmt"
 	"github.com/qmsk/clusterf/config"
 	"github.com/qmsk/clusterf/ipvs"
@@ -11,7 +12,12 @@ import (
 type Service struct {
 	ipvs.Service
 
+	// config service name, empty if not configured
+	name  string
 	dests ServiceDests
+
+	// unconfigured, and removed once all dests have drained
+	drain bool
 }
 
 type ServiceDests map[string]Dest
@@ -35,15 +41,28 @@ func (dests ServiceDests) sync(ipvsDest ipvs.Dest) {
 	_ = dests.get(ipvsDest)
 }
 
-func (dests ServiceDests) config(ipvsDest ipvs.Dest) {
+// Merged thresholds are summed, unless any backend is unlimited
+func mergeThreshold(a uint32, b uint32) uint32 {
+	if a == 0 || b == 0 {
+		return 0
+	} else {
+		return a + b
+	}
+}
+
+func (dests ServiceDests) config(backendName string, ipvsDest ipvs.Dest) {
 	dest, exists := dests[ipvsDest.String()]
 	if exists {
 		// merge
 		dest.Weight += ipvsDest.Weight
+		dest.UThresh = mergeThreshold(dest.UThresh, ipvsDest.UThresh)
+		dest.LThresh = mergeThreshold(dest.LThresh, ipvsDest.LThresh)
+		dest.backends = dest.backends.add(backendName)
 
 	} else {
 		dest = Dest{
-			Dest: ipvsDest,
+			Dest:     ipvsDest,
+			backends: destBackends{backendName},
 		}
 	}
 
@@ -66,6 +85,77 @@ func configServiceFrontend(ipvsType ipvsType, frontend *config.ServiceFrontend,
 		Netmask:   0xffffffff,
 	}
 
+	if frontend.Scheduler != "" {
+		ipvsService.SchedName = frontend.Scheduler
+	}
+
+	if schedName, err := ipvs.ParseSchedName(ipvsService.SchedName); err != nil {
+		return nil, err
+	} else {
+		ipvsService.SchedName = schedName
+	}
+
+	if frontend.Persistence != 0 {
+		ipvsService.Flags.Flags |= ipvs.IP_VS_SVC_F_PERSISTENT
+		ipvsService.Timeout = frontend.Persistence
+	}
+
+	if frontend.PersistenceEngine == "" {
+
+	} else if frontend.Persistence == 0 {
+		return nil, fmt.Errorf("Invalid persistence_engine without persistence: %v", frontend.PersistenceEngine)
+	} else if peName, err := ipvs.ParsePEName(frontend.PersistenceEngine); err != nil {
+		return nil, err
+	} else {
+		ipvsService.PEName = peName
+	}
+
+	for _, flagName := range frontend.Flags {
+		if flag, err := ipvs.ParseFlag(flagName); err != nil {
+			return nil, err
+		} else {
+			ipvsService.Flags.Flags |= flag
+		}
+	}
+
+	switch ipvsType.Af {
+	case syscall.AF_INET:
+		if frontend.IPv4 == "" && frontend.FwMark == 0 {
+			// IPv6-only frontend, with an IPv6 netmask
+		} else if frontend.Netmask > 32 {
+			return nil, fmt.Errorf("Invalid IPv4 netmask: %v", frontend.Netmask)
+		} else if frontend.Netmask != 0 {
+			// __be32 in network byte order, sent as a host byte order u32 attr
+			ipvsService.Netmask = binary.NativeEndian.Uint32(net.CIDRMask(int(frontend.Netmask), 32))
+		}
+	case syscall.AF_INET6:
+		var netmask = frontend.Netmask6
+
+		if netmask == 0 && frontend.IPv4 == "" && frontend.FwMark == 0 {
+			// IPv6-only frontend, with an IPv6 netmask
+			netmask = frontend.Netmask
+		}
+
+		// prefix length
+		if netmask > 128 {
+			return nil, fmt.Errorf("Invalid IPv6 netmask: %v", netmask)
+		} else if netmask != 0 {
+			ipvsService.Netmask = uint32(netmask)
+		} else {
+			ipvsService.Netmask = 128
+		}
+	}
+
+	if ipvsType.FwMark {
+		if frontend.FwMark == 0 {
+			return nil, nil
+		}
+
+		ipvsService.FwMark = frontend.FwMark
+
+		return &ipvsService, nil
+	}
+
 	switch ipvsType.Af {
 	case syscall.AF_INET:
 		if frontend.IPv4 == "" {
@@ -102,6 +192,12 @@ func configServiceFrontend(ipvsType ipvsType, frontend *config.ServiceFrontend,
 		} else {
 			ipvsService.Port = frontend.UDP
 		}
+	case syscall.IPPROTO_SCTP:
+		if frontend.SCTP == 0 {
+			return nil, nil
+		} else {
+			ipvsService.Port = frontend.SCTP
+		}
 	default:
 		panic("invalid proto")
 	}
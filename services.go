@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/qmsk/clusterf/config"
 	"github.com/qmsk/clusterf/ipvs"
+	"strings"
+	"syscall"
 )
 
 type Services map[string]Service
@@ -33,29 +35,61 @@ func (services Services) sync(ipvsService ipvs.Service, ipvsDests []ipvs.Dest) {
 	}
 }
 
-func (services Services) config(ipvsService ipvs.Service, dests ServiceDests) {
+func (services Services) config(serviceName string, ipvsService ipvs.Service, dests ServiceDests) {
 	services[ipvsService.String()] = Service{
 		Service: ipvsService,
+		name:    serviceName,
 		dests:   dests,
 	}
 }
 
-// Build a new services state from Config
-func configServices(configServices map[string]config.Service, routes Routes, options IPVSOptions) (Services, error) {
+// Any backends for the address family, or no backends at all
+func configBackendsAf(backends map[string]config.ServiceBackend, af ipvs.Af) bool {
+	if len(backends) == 0 {
+		return true
+	}
+
+	for _, backend := range backends {
+		if af == syscall.AF_INET && backend.IPv4 != "" {
+			return true
+		} else if af == syscall.AF_INET6 && backend.IPv6 != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Build a new services state from Config.
+//
+// Any backends that are down according to the given health are configured with a zero weight.
+func configServices(configServices map[string]config.Service, routes Routes, health Health, options IPVSOptions) (Services, error) {
 	services := make(Services)
 
 	for serviceName, configService := range configServices {
+		if !strings.HasPrefix(serviceName, options.FilterServices) {
+			continue
+		}
+
 		for _, ipvsType := range ipvsTypes {
 			if ipvsService, err := configServiceFrontend(ipvsType, configService.Frontend, options); err != nil {
 				return nil, fmt.Errorf("Invalid config for service %v: %v", serviceName, err)
-			} else if ipvsService != nil {
+			} else if ipvsService == nil {
+
+			} else if ipvsService.FwMark != 0 && !configBackendsAf(configService.Backends, ipvsService.Af) {
+				// fwmark services are only created for the address families of the backends
+			} else {
 				dests := make(ServiceDests)
 
 				for backendName, configBackend := range configService.Backends {
 					if ipvsDest, err := configServiceBackend(*ipvsService, configBackend, routes, options); err != nil {
 						return nil, fmt.Errorf("Invalid config for service %v backend %v: %v", serviceName, backendName, err)
 					} else if ipvsDest != nil {
-						dests.config(*ipvsDest)
+						if !health.Up(serviceName, backendName) {
+							ipvsDest.Weight = 0
+						}
+
+						dests.config(backendName, *ipvsDest)
 					}
 				}
 
@@ -64,7 +98,7 @@ func configServices(configServices map[string]config.Service, routes Routes, opt
 					continue
 				}
 
-				services.config(*ipvsService, dests)
+				services.config(serviceName, *ipvsService, dests)
 			}
 		}
 	}
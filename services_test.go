@@ -1,6 +1,7 @@
 package clusterf
 
 import (
+	"encoding/binary"
 	"github.com/kylelemons/godebug/pretty"
 	"github.com/qmsk/clusterf/config"
 	"github.com/qmsk/clusterf/ipvs"
@@ -13,6 +14,7 @@ var testConfigServices = map[string]struct {
 	options      IPVSOptions
 	configRoutes map[string]config.Route
 	config       map[string]config.Service
+	health       Health
 	services     Services
 }{
 	"simple": {
@@ -42,6 +44,7 @@ var testConfigServices = map[string]struct {
 					Flags:     ipvs.Flags{0, 0xffffffff},
 					Netmask:   0xffffffff,
 				},
+				name: "test",
 				dests: ServiceDests{
 					"10.1.0.1:8080": Dest{
 						Dest: ipvs.Dest{
@@ -50,6 +53,7 @@ var testConfigServices = map[string]struct {
 							FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
 							Weight:    10,
 						},
+						backends: destBackends{"test1"},
 					},
 					"10.1.0.2:8082": Dest{
 						Dest: ipvs.Dest{
@@ -58,6 +62,7 @@ var testConfigServices = map[string]struct {
 							FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
 							Weight:    10,
 						},
+						backends: destBackends{"test2"},
 					},
 				},
 			},
@@ -72,6 +77,7 @@ var testConfigServices = map[string]struct {
 					Flags:     ipvs.Flags{0, 0xffffffff},
 					Netmask:   0xffffffff,
 				},
+				name: "test",
 				dests: ServiceDests{
 					"10.1.0.1:8081": Dest{
 						Dest: ipvs.Dest{
@@ -80,6 +86,7 @@ var testConfigServices = map[string]struct {
 							FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
 							Weight:    10,
 						},
+						backends: destBackends{"test1"},
 					},
 				},
 			},
@@ -116,6 +123,7 @@ var testConfigServices = map[string]struct {
 					Flags:     ipvs.Flags{0, 0xffffffff},
 					Netmask:   0xffffffff,
 				},
+				name: "test",
 				dests: ServiceDests{
 					"10.255.0.1:80": Dest{
 						Dest: ipvs.Dest{
@@ -124,6 +132,7 @@ var testConfigServices = map[string]struct {
 							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
 							Weight:    10,
 						},
+						backends: destBackends{"test1"},
 					},
 					"10.255.0.2:80": Dest{
 						Dest: ipvs.Dest{
@@ -132,6 +141,99 @@ var testConfigServices = map[string]struct {
 							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
 							Weight:    10,
 						},
+						backends: destBackends{"test2"},
+					},
+				},
+			},
+		},
+	},
+
+	"route-tunnel-gue": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		},
+		configRoutes: map[string]config.Route{
+			"test1": config.Route{Prefix: "10.1.0.0/24", Gateway: "10.255.0.1", IPVSMethod: "tunnel", IPVSTunnel: "gue", IPVSTunnelPort: 6080, IPVSTunnelFlags: []string{"csum"}},
+		},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 80, Weight: 10},
+				},
+			},
+		},
+		services: Services{
+			"inet+tcp://10.0.0.1:80": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET,
+					Protocol: syscall.IPPROTO_TCP,
+					Addr:     net.IP{10, 0, 0, 1},
+					Port:     80,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{0, 0xffffffff},
+					Netmask:   0xffffffff,
+				},
+				name: "test",
+				dests: ServiceDests{
+					"10.255.0.1:80": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 255, 0, 1},
+							Port:      80,
+							FwdMethod: ipvs.IP_VS_CONN_F_TUNNEL,
+							Weight:    10,
+							TunType:   ipvs.IP_VS_CONN_F_TUNNEL_TYPE_GUE,
+							TunPort:   6080,
+							TunFlags:  ipvs.IP_VS_TUNNEL_ENCAP_FLAG_CSUM,
+						},
+						backends: destBackends{"test1"},
+					},
+				},
+			},
+		},
+	},
+
+	"route-gateway-mixed": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		},
+		configRoutes: map[string]config.Route{
+			"test1": config.Route{Prefix: "10.1.0.0/24", Gateway: "2001:db8:255::1", IPVSMethod: "tunnel"},
+		},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+				},
+			},
+		},
+		services: Services{
+			"inet+tcp://10.0.0.1:80": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET,
+					Protocol: syscall.IPPROTO_TCP,
+					Addr:     net.IP{10, 0, 0, 1},
+					Port:     80,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{0, 0xffffffff},
+					Netmask:   0xffffffff,
+				},
+				name: "test",
+				dests: ServiceDests{
+					"2001:db8:255::1:80": Dest{
+						Dest: ipvs.Dest{
+							Af:        syscall.AF_INET6,
+							Addr:      net.ParseIP("2001:db8:255::1"),
+							Port:      80,
+							FwdMethod: ipvs.IP_VS_CONN_F_TUNNEL,
+							Weight:    10,
+						},
+						backends: destBackends{"test1"},
 					},
 				},
 			},
@@ -176,6 +278,56 @@ var testConfigServices = map[string]struct {
 					Flags:     ipvs.Flags{0, 0xffffffff},
 					Netmask:   0xffffffff,
 				},
+				name: "test",
+				dests: ServiceDests{
+					"10.1.0.1:80": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 1, 0, 1},
+							Port:      80,
+							FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+							Weight:    10,
+						},
+						backends: destBackends{"test1"},
+					},
+				},
+			},
+		},
+	},
+
+	"filter-services": {
+		options: IPVSOptions{
+			SchedName:      "wlc",
+			FwdMethod:      ipvs.IP_VS_CONN_F_MASQ,
+			FilterServices: "test-",
+		},
+		configRoutes: map[string]config.Route{},
+		config: map[string]config.Service{
+			"test-1": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 80, Weight: 10},
+				},
+			},
+			"other": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 80, Weight: 10},
+				},
+			},
+		},
+		services: Services{
+			"inet+tcp://10.0.0.1:80": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET,
+					Protocol: syscall.IPPROTO_TCP,
+					Addr:     net.IP{10, 0, 0, 1},
+					Port:     80,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{0, 0xffffffff},
+					Netmask:   0xffffffff,
+				},
+				name: "test-1",
 				dests: ServiceDests{
 					"10.1.0.1:80": Dest{
 						Dest: ipvs.Dest{
@@ -184,6 +336,247 @@ var testConfigServices = map[string]struct {
 							FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
 							Weight:    10,
 						},
+						backends: destBackends{"test1"},
+					},
+				},
+			},
+		},
+	},
+
+	"frontend-params": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		},
+		configRoutes: map[string]config.Route{},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", IPv6: "2001:db8::1", TCP: 443, Scheduler: "sh", Persistence: 300, Netmask: 24, Netmask6: 64, Flags: []string{"sh-port"}},
+			},
+		},
+		services: Services{
+			"inet+tcp://10.0.0.1:443": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET,
+					Protocol: syscall.IPPROTO_TCP,
+					Addr:     net.IP{10, 0, 0, 1},
+					Port:     443,
+
+					SchedName: "sh",
+					Flags:     ipvs.Flags{ipvs.IP_VS_SVC_F_PERSISTENT | ipvs.IP_VS_SVC_F_SCHED_SH_PORT, 0xffffffff},
+					Timeout:   300,
+					Netmask:   binary.NativeEndian.Uint32(net.IP{255, 255, 255, 0}),
+				},
+				name:  "test",
+				dests: ServiceDests{},
+			},
+			"inet6+tcp://2001:db8::1:443": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET6,
+					Protocol: syscall.IPPROTO_TCP,
+					Addr:     net.ParseIP("2001:db8::1"),
+					Port:     443,
+
+					SchedName: "sh",
+					Flags:     ipvs.Flags{ipvs.IP_VS_SVC_F_PERSISTENT | ipvs.IP_VS_SVC_F_SCHED_SH_PORT, 0xffffffff},
+					Timeout:   300,
+					Netmask:   64,
+				},
+				name:  "test",
+				dests: ServiceDests{},
+			},
+		},
+	},
+
+	"frontend-persistence-engine": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		},
+		configRoutes: map[string]config.Route{},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", UDP: 5060, Persistence: 900, PersistenceEngine: "sip"},
+			},
+		},
+		services: Services{
+			"inet+udp://10.0.0.1:5060": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET,
+					Protocol: syscall.IPPROTO_UDP,
+					Addr:     net.IP{10, 0, 0, 1},
+					Port:     5060,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{ipvs.IP_VS_SVC_F_PERSISTENT, 0xffffffff},
+					Timeout:   900,
+					Netmask:   0xffffffff,
+					PEName:    "sip",
+				},
+				name:  "test",
+				dests: ServiceDests{},
+			},
+		},
+	},
+
+	"frontend-netmask6": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		},
+		configRoutes: map[string]config.Route{},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv6: "2001:db8::1", TCP: 443, Persistence: 300, Netmask: 64},
+			},
+		},
+		services: Services{
+			"inet6+tcp://2001:db8::1:443": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET6,
+					Protocol: syscall.IPPROTO_TCP,
+					Addr:     net.ParseIP("2001:db8::1"),
+					Port:     443,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{ipvs.IP_VS_SVC_F_PERSISTENT, 0xffffffff},
+					Timeout:   300,
+					Netmask:   64,
+				},
+				name:  "test",
+				dests: ServiceDests{},
+			},
+		},
+	},
+
+	"sctp": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		},
+		configRoutes: map[string]config.Route{},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv6: "2001:db8::1", SCTP: 3868},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv6: "2001:db8:1::1", SCTP: 3868, Weight: 10},
+					"test2": config.ServiceBackend{IPv6: "2001:db8:1::2", TCP: 3868, Weight: 10},
+				},
+			},
+		},
+		services: Services{
+			"inet6+sctp://2001:db8::1:3868": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET6,
+					Protocol: syscall.IPPROTO_SCTP,
+					Addr:     net.ParseIP("2001:db8::1"),
+					Port:     3868,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{0, 0xffffffff},
+					Netmask:   128,
+				},
+				name: "test",
+				dests: ServiceDests{
+					"2001:db8:1::1:3868": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.ParseIP("2001:db8:1::1"),
+							Port:      3868,
+							FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+							Weight:    10,
+						},
+						backends: destBackends{"test1"},
+					},
+				},
+			},
+		},
+	},
+
+	"fwmark": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
+			Elide:     true,
+		},
+		configRoutes: map[string]config.Route{},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{FwMark: 42},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", Weight: 10},
+					"test2": config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10},
+				},
+			},
+		},
+		services: Services{
+			"inet+fwmark://42": Service{
+				Service: ipvs.Service{
+					Af:     syscall.AF_INET,
+					FwMark: 42,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{0, 0xffffffff},
+					Netmask:   0xffffffff,
+				},
+				name: "test",
+				dests: ServiceDests{
+					"10.1.0.1:0": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 1, 0, 1},
+							Port:      0,
+							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
+							Weight:    10,
+						},
+						backends: destBackends{"test1"},
+					},
+					"10.1.0.2:0": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 1, 0, 2},
+							Port:      0,
+							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
+							Weight:    10,
+						},
+						backends: destBackends{"test2"},
+					},
+				},
+			},
+		},
+	},
+
+	"fwmark-af": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
+		},
+		configRoutes: map[string]config.Route{},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{FwMark: 42},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", Weight: 10},
+				},
+			},
+		},
+		services: Services{
+			"inet+fwmark://42": Service{
+				Service: ipvs.Service{
+					Af:     syscall.AF_INET,
+					FwMark: 42,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{0, 0xffffffff},
+					Netmask:   0xffffffff,
+				},
+				name: "test",
+				dests: ServiceDests{
+					"10.1.0.1:0": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 1, 0, 1},
+							Port:      0,
+							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
+							Weight:    10,
+						},
+						backends: destBackends{"test1"},
 					},
 				},
 			},
@@ -219,6 +612,7 @@ var testConfigServices = map[string]struct {
 					Flags:     ipvs.Flags{0, 0xffffffff},
 					Netmask:   0xffffffff,
 				},
+				name: "test",
 				dests: ServiceDests{
 					"10.255.0.1:80": Dest{
 						Dest: ipvs.Dest{
@@ -227,6 +621,129 @@ var testConfigServices = map[string]struct {
 							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
 							Weight:    20, // merged
 						},
+						backends: destBackends{"test1-1", "test1-2"},
+					},
+				},
+			},
+		},
+	},
+
+	"backend-thresholds": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		},
+		configRoutes: map[string]config.Route{
+			"test1": config.Route{Prefix: "10.1.0.0/24", Gateway: "10.255.0.1", IPVSMethod: "droute"},
+			"test2": config.Route{Prefix: "10.2.0.0/24", Gateway: "10.255.0.2", IPVSMethod: "droute"},
+		},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+				Backends: map[string]config.ServiceBackend{
+					"test1-1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10, UpperThreshold: 100, LowerThreshold: 80},
+					"test1-2": config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10, UpperThreshold: 50, LowerThreshold: 40},
+					"test2-1": config.ServiceBackend{IPv4: "10.2.0.1", TCP: 8080, Weight: 10, UpperThreshold: 100},
+					"test2-2": config.ServiceBackend{IPv4: "10.2.0.2", TCP: 8080, Weight: 10},
+				},
+			},
+		},
+		services: Services{
+			"inet+tcp://10.0.0.1:80": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET,
+					Protocol: syscall.IPPROTO_TCP,
+					Addr:     net.IP{10, 0, 0, 1},
+					Port:     80,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{0, 0xffffffff},
+					Netmask:   0xffffffff,
+				},
+				name: "test",
+				dests: ServiceDests{
+					"10.255.0.1:80": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 255, 0, 1},
+							Port:      80,
+							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
+							Weight:    20,
+							UThresh:   150, // merged
+							LThresh:   120, // merged
+						},
+						backends: destBackends{"test1-1", "test1-2"},
+					},
+					"10.255.0.2:80": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 255, 0, 2},
+							Port:      80,
+							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
+							Weight:    20,
+							UThresh:   0, // merged with unlimited
+							LThresh:   0,
+						},
+						backends: destBackends{"test2-1", "test2-2"},
+					},
+				},
+			},
+		},
+	},
+
+	"backend-health": {
+		options: IPVSOptions{
+			SchedName: "wlc",
+			FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+		},
+		configRoutes: map[string]config.Route{
+			"test1": config.Route{Prefix: "10.1.0.0/24", Gateway: "10.255.0.1", IPVSMethod: "droute"},
+		},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+				Backends: map[string]config.ServiceBackend{
+					"test1-1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+					"test1-2": config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10},
+					"test2":   config.ServiceBackend{IPv4: "10.2.0.1", TCP: 8080, Weight: 10},
+				},
+				Check: &config.ServiceCheck{Type: "tcp"},
+			},
+		},
+		health: Health{
+			CheckID{"test", "test1-1"}: true,
+			CheckID{"test", "test1-2"}: false,
+			CheckID{"test", "test2"}:   false,
+		},
+		services: Services{
+			"inet+tcp://10.0.0.1:80": Service{
+				Service: ipvs.Service{
+					Af:       syscall.AF_INET,
+					Protocol: syscall.IPPROTO_TCP,
+					Addr:     net.IP{10, 0, 0, 1},
+					Port:     80,
+
+					SchedName: "wlc",
+					Flags:     ipvs.Flags{0, 0xffffffff},
+					Netmask:   0xffffffff,
+				},
+				name: "test",
+				dests: ServiceDests{
+					"10.255.0.1:80": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 255, 0, 1},
+							Port:      80,
+							FwdMethod: ipvs.IP_VS_CONN_F_DROUTE,
+							Weight:    10, // merged, one down
+						},
+						backends: destBackends{"test1-1", "test1-2"},
+					},
+					"10.2.0.1:8080": Dest{
+						Dest: ipvs.Dest{
+							Addr:      net.IP{10, 2, 0, 1},
+							Port:      8080,
+							FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+							Weight:    0, // down
+						},
+						backends: destBackends{"test2"},
 					},
 				},
 			},
@@ -241,7 +758,7 @@ func TestConfigServices(t *testing.T) {
 			t.Fatalf("%v configRoutes: %v\n", testName, err)
 		}
 
-		services, err := configServices(test.config, routes, test.options)
+		services, err := configServices(test.config, routes, test.health, test.options)
 		if err != nil {
 			t.Fatalf("%v configServices error: %v\n", testName, err)
 		}
@@ -252,6 +769,92 @@ func TestConfigServices(t *testing.T) {
 	}
 }
 
+var testConfigServicesError = map[string]struct {
+	configRoutes map[string]config.Route
+	config       map[string]config.Service
+	error        string
+}{
+	"scheduler": {
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80, Scheduler: "foo"},
+			},
+		},
+		error: "Invalid config for service test: Invalid SchedName: foo",
+	},
+	"flag": {
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80, Flags: []string{"foo"}},
+			},
+		},
+		error: "Invalid config for service test: Invalid Flag: foo",
+	},
+	"netmask": {
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80, Netmask: 64},
+			},
+		},
+		error: "Invalid config for service test: Invalid IPv4 netmask: 64",
+	},
+	"netmask6": {
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", IPv6: "2001:db8::1", TCP: 80, Netmask6: 129},
+			},
+		},
+		error: "Invalid config for service test: Invalid IPv6 netmask: 129",
+	},
+	"persistence-engine": {
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", UDP: 5060, Persistence: 900, PersistenceEngine: "foo"},
+			},
+		},
+		error: "Invalid config for service test: Invalid PEName: foo",
+	},
+	"persistence-engine-timeout": {
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", UDP: 5060, PersistenceEngine: "sip"},
+			},
+		},
+		error: "Invalid config for service test: Invalid persistence_engine without persistence: sip",
+	},
+	"route-gateway-mixed": {
+		configRoutes: map[string]config.Route{
+			"test1": config.Route{Prefix: "10.1.0.0/24", Gateway: "2001:db8:255::1", IPVSMethod: "droute"},
+		},
+		config: map[string]config.Service{
+			"test": config.Service{
+				Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+				Backends: map[string]config.ServiceBackend{
+					"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080},
+				},
+			},
+		},
+		error: "Invalid config for service test backend test1: Invalid inet6 gateway 2001:db8:255::1 for inet service: requires tunnel method, not droute",
+	},
+}
+
+func TestConfigServicesError(t *testing.T) {
+	options := IPVSOptions{SchedName: "wlc"}
+
+	for testName, test := range testConfigServicesError {
+		routes, err := configRoutes(test.configRoutes)
+		if err != nil {
+			t.Fatalf("%v configRoutes: %v\n", testName, err)
+		}
+
+		if _, err := configServices(test.config, routes, nil, options); err == nil {
+			t.Errorf("%v configServices: expected error %v", testName, test.error)
+		} else if err.Error() != test.error {
+			t.Errorf("%v configServices: error %v, expected %v", testName, err, test.error)
+		}
+	}
+}
+
 // Test adding a new ConfigServiceFrontend after sync
 // https://github.com/qmsk/clusterf/issues/4
 /* func TestServiceAdd(t *testing.T) {
@@ -0,0 +1,410 @@
+package clusterf
+
+import (
+	"fmt"
+	"github.com/qmsk/clusterf/ipvs"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// Failed IPVS operation, identified by the config service and backend names, or a failed VIP operation
+type UpdateError struct {
+	Op      string
+	Service Service
+	Dest    *Dest
+	VIP     net.IP
+	Err     error
+}
+
+func (err UpdateError) Error() string {
+	if err.VIP != nil {
+		return fmt.Sprintf("%s vip %v: %v", err.Op, err.VIP, err.Err)
+	}
+
+	var service = err.Service.String()
+
+	if err.Service.name != "" {
+		service = fmt.Sprintf("%s %v", err.Service.name, err.Service)
+	}
+
+	if err.Dest == nil {
+		return fmt.Sprintf("%s service %s: %v", err.Op, service, err.Err)
+	} else if len(err.Dest.backends) > 0 {
+		return fmt.Sprintf("%s service %s backend %v %v: %v", err.Op, service, err.Dest.backends, err.Dest, err.Err)
+	} else {
+		return fmt.Sprintf("%s service %s dest %v: %v", err.Op, service, err.Dest, err.Err)
+	}
+}
+
+// Failed IPVS operations, which are not reflected in the running state
+type UpdateErrors []UpdateError
+
+// Collect a failed operation.
+//
+// Returns false if the operation failed.
+func (errors *UpdateErrors) check(op string, service Service, dest *Dest, err error) bool {
+	if err == nil {
+		return true
+	}
+
+	var updateError = UpdateError{Op: op, Service: service, Err: err}
+
+	if dest != nil {
+		// copy, the dest may be a loop variable
+		var errorDest = *dest
+
+		updateError.Dest = &errorDest
+	}
+
+	*errors = append(*errors, updateError)
+
+	return false
+}
+
+// Collect a failed VIP operation.
+//
+// Returns false if the operation failed.
+func (errors *UpdateErrors) checkVIP(op string, ip net.IP, err error) bool {
+	if err == nil {
+		return true
+	}
+
+	*errors = append(*errors, UpdateError{Op: op, VIP: ip, Err: err})
+
+	return false
+}
+
+func (errors UpdateErrors) Error() string {
+	var strs []string
+
+	for _, err := range errors {
+		strs = append(strs, err.Error())
+	}
+
+	return strings.Join(strs, "; ")
+}
+
+// Pending IPVS operation
+type updateOp struct {
+	op          string // new, set, del, drain
+	serviceName string
+	service     Service
+	dest        *Dest
+
+	// restore the running state if the operation fails
+	revert func()
+}
+
+func (op updateOp) String() string {
+	var action string
+
+	switch op.op {
+	case "new":
+		action = "New"
+	case "set", "drain":
+		action = "Set"
+	case "del":
+		action = "Delete"
+	}
+
+	if op.dest == nil {
+		return fmt.Sprintf("%s service %v", action, op.service)
+	} else {
+		return fmt.Sprintf("%s service %v dest %v", action, op.service, op.dest)
+	}
+}
+
+func (op updateOp) exec(driver *IPVSDriver) error {
+	switch {
+	case op.dest == nil && op.op == "new":
+		return driver.newService(op.service)
+	case op.dest == nil && op.op == "set":
+		return driver.setService(op.service)
+	case op.dest == nil && op.op == "del":
+		return driver.delService(op.service)
+	case op.op == "new":
+		return driver.newServiceDest(op.service, *op.dest)
+	case op.op == "set", op.op == "drain":
+		return driver.setServiceDest(op.service, *op.dest)
+	case op.op == "del":
+		return driver.delServiceDest(op.service, *op.dest)
+	default:
+		panic("invalid op")
+	}
+}
+
+func (op updateOp) batch(batch *ipvs.Batch) {
+	switch {
+	case op.dest == nil && op.op == "new":
+		batch.NewService(op.service.Service)
+	case op.dest == nil && op.op == "set":
+		batch.SetService(op.service.Service)
+	case op.dest == nil && op.op == "del":
+		batch.DelService(op.service.Service)
+	case op.op == "new":
+		batch.NewDest(op.service.Service, op.dest.Dest)
+	case op.op == "set", op.op == "drain":
+		batch.SetDest(op.service.Service, op.dest.Dest)
+	case op.op == "del":
+		batch.DelDest(op.service.Service, op.dest.Dest)
+	default:
+		panic("invalid op")
+	}
+}
+
+type updateOps []updateOp
+
+func (ops *updateOps) add(op string, serviceName string, service Service, dest *Dest, revert func()) {
+	var updateOp = updateOp{op: op, serviceName: serviceName, service: service, revert: revert}
+
+	if dest != nil {
+		// copy, the dest may be a loop variable
+		var opDest = *dest
+
+		updateOp.dest = &opDest
+	}
+
+	*ops = append(*ops, updateOp)
+}
+
+// Execute operations, using a single batch if supported by the client.
+//
+// Reverts the running state for any failed operations.
+func (driver *IPVSDriver) exec(ops updateOps) UpdateErrors {
+	var errors UpdateErrors
+	var opErrors = make([]error, len(ops))
+
+	if len(ops) == 0 {
+		return nil
+	} else if batcher, ok := driver.writeClient.(ipvs.Batcher); !ok || len(ops) == 1 {
+		for i, op := range ops {
+			opErrors[i] = op.exec(driver)
+		}
+	} else {
+		var batch ipvs.Batch
+
+		for _, op := range ops {
+			log.Printf("IPVS: %v\n", op)
+
+			op.batch(&batch)
+		}
+
+		if batchErrors, err := batcher.ExecBatch(&batch); err != nil {
+			for i := range opErrors {
+				opErrors[i] = err
+			}
+		} else {
+			opErrors = batchErrors
+		}
+	}
+
+	for i, op := range ops {
+		if !errors.check(op.op, op.service, op.dest, opErrors[i]) && op.revert != nil {
+			op.revert()
+		}
+	}
+
+	return errors
+}
+
+// Pending operations to apply a new state
+type updatePlan struct {
+	// new running state, assuming all operations succeed
+	running Services
+	adopted Services // unowned services adopted on the first update
+	errors  UpdateErrors
+
+	serviceOps updateOps
+	destOps    updateOps
+	delOps     updateOps
+}
+
+// Compute the operations to apply the new state, without executing them.
+//
+// Starts draining any unconfigured dests.
+func (driver *IPVSDriver) plan(services Services) updatePlan {
+	var errors UpdateErrors
+	var running = make(Services)
+	var adopted = make(Services)
+	var serviceOps, destOps, delOps updateOps
+
+	for serviceName, service := range services {
+		// closures
+		var serviceName = serviceName
+		var dests = make(ServiceDests)
+
+		oldService, exists := driver.services[serviceName]
+
+		if unownedService, unowned := driver.unowned[serviceName]; unowned && !exists && driver.adopt && driver.scope.match(service.Service) {
+			// first run without any --ipvs-state
+			oldService, exists = unownedService, true
+			adopted[serviceName] = unownedService
+		}
+
+		if !driver.scope.match(service.Service) {
+			log.Printf("IPVS: Skip service %s %v outside of the --ipvs-scope-* options\n", service.name, service)
+			continue
+		} else if _, unowned := driver.unowned[serviceName]; unowned && !exists {
+			errors.check("new", service, nil, fmt.Errorf("conflict with unmanaged service"))
+			continue
+		} else if !exists {
+			serviceOps.add("new", serviceName, service, nil, func() {
+				delete(running, serviceName)
+			})
+		} else if !service.Equals(oldService.Service) {
+			var kernelService = oldService.Service
+
+			serviceOps.add("set", serviceName, service, nil, func() {
+				service := running[serviceName]
+				service.Service = kernelService
+				running[serviceName] = service
+			})
+		}
+
+		for destName, dest := range service.dests {
+			// closures
+			var destName = destName
+
+			oldDest, exists := oldService.dests[destName]
+
+			dests[destName] = dest
+
+			if !exists {
+				destOps.add("new", serviceName, service, &dest, func() {
+					delete(dests, destName)
+				})
+			} else if !dest.Equals(oldDest.Dest) {
+				var kernelDest = oldDest.Dest
+
+				destOps.add("set", serviceName, service, &dest, func() {
+					dest := dests[destName]
+					dest.Dest = kernelDest
+					dests[destName] = dest
+				})
+			}
+
+			// re-configured
+			delete(driver.drains, drainID{serviceName, destName})
+		}
+
+		for destName, oldDest := range oldService.dests {
+			// closures
+			var destName, oldDest = destName, oldDest
+
+			if _, exists := service.dests[destName]; exists {
+
+			} else if driver.options.DrainTimeout > 0 {
+				driver.drainServiceDest(serviceName, service, dests, destName, oldDest, &destOps)
+			} else {
+				destOps.add("del", serviceName, service, &oldDest, func() {
+					dests[destName] = oldDest
+				})
+			}
+		}
+
+		service.dests = dests
+		running[serviceName] = service
+	}
+
+	for serviceName, oldService := range driver.services {
+		// closures
+		var serviceName, oldService = serviceName, oldService
+
+		if _, exists := services[serviceName]; exists {
+
+		} else if driver.options.DrainTimeout > 0 && len(oldService.dests) > 0 {
+			running[serviceName] = driver.drainService(serviceName, oldService, &destOps)
+		} else {
+			// removing a service also removes all service.dests
+			delOps.add("del", serviceName, oldService, nil, func() {
+				running[serviceName] = oldService
+			})
+		}
+	}
+
+	return updatePlan{
+		running:    running,
+		adopted:    adopted,
+		errors:     errors,
+		serviceOps: serviceOps,
+		destOps:    destOps,
+		delOps:     delOps,
+	}
+}
+
+// Apply new state.
+//
+// The services are created and updated before their dests, and removed last.
+// Failed operations are not reflected in the new running state, and any errors are returned as UpdateErrors.
+func (driver *IPVSDriver) update(routes Routes, services Services) error {
+	var plan = driver.plan(services)
+	var errors = plan.errors
+
+	errors = append(errors, driver.exec(plan.serviceOps)...)
+
+	// skip dests for any services that failed to be created
+	var runningOps updateOps
+
+	for _, op := range plan.destOps {
+		if _, exists := plan.running[op.serviceName]; exists {
+			runningOps = append(runningOps, op)
+		}
+	}
+
+	errors = append(errors, driver.exec(runningOps)...)
+	errors = append(errors, driver.exec(plan.delOps)...)
+	errors = append(errors, driver.updateVIPs(plan.running)...)
+
+	driver.routes = routes
+	driver.services = plan.running
+	driver.adopt = false
+	driver.updateState(plan.running)
+
+	if len(errors) > 0 {
+		driver.failures++
+
+		return errors
+	}
+
+	driver.failures = 0
+
+	return nil
+}
+
+// Return the backoff before retrying any failed updates, or zero if there is nothing to retry
+func (driver *IPVSDriver) RetryBackoff() time.Duration {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	if driver.failures == 0 {
+		return 0
+	}
+
+	var backoff = driver.options.RetryInterval
+
+	for i := uint(1); i < driver.failures && backoff < driver.options.RetryMax; i++ {
+		backoff *= 2
+	}
+
+	if driver.options.RetryMax > 0 && backoff > driver.options.RetryMax {
+		backoff = driver.options.RetryMax
+	}
+
+	return backoff
+}
+
+// Re-apply the configured state after failed updates
+func (driver *IPVSDriver) Retry() error {
+	driver.mutex.Lock()
+	defer driver.mutex.Unlock()
+
+	if !driver.configured || driver.failures == 0 {
+		return nil
+	}
+
+	log.Printf("IPVS: Retry after %d failed updates\n", driver.failures)
+
+	return driver.configure()
+}
@@ -0,0 +1,163 @@
+package clusterf
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestUpdateRetry(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName:     "wlc",
+		FwdMethod:     ipvs.IP_VS_CONN_F_MASQ,
+		RetryInterval: time.Second,
+		RetryMax:      3 * time.Second,
+	}, client)
+
+	var testService = ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc", Netmask: 0xffffffff}
+	var configServices = map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+			},
+		},
+	}
+
+	// not synced from the kernel
+	client.Emulator.NewService(testService)
+
+	if err := driver.Config(config.Config{Services: configServices}); err == nil {
+		t.Fatalf("IPVSDriver.Config: should fail")
+	} else if err.Error() != "new service test inet+tcp://10.0.0.1:80: file exists" {
+		t.Errorf("IPVSDriver.Config: %v", err)
+	}
+
+	if _, exists := driver.services["inet+tcp://10.0.0.1:80"]; exists {
+		t.Errorf("IPVSDriver.Config: failed service is in running state")
+	}
+
+	// backoff
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if retryBackoff := driver.RetryBackoff(); retryBackoff != backoff {
+			t.Errorf("IPVSDriver.RetryBackoff: %v != %v", retryBackoff, backoff)
+		}
+
+		if err := driver.Retry(); err == nil {
+			t.Fatalf("IPVSDriver.Retry: should fail")
+		}
+	}
+
+	// retried
+	client.Emulator.DelService(testService)
+
+	testDriverRetry(t, driver, client, []string{
+		"new inet+tcp://10.0.0.1:80",
+		"new inet+tcp://10.0.0.1:80 10.1.0.1:8080 weight=10",
+	})
+
+	if retryBackoff := driver.RetryBackoff(); retryBackoff != 0 {
+		t.Errorf("IPVSDriver.RetryBackoff: %v", retryBackoff)
+	}
+
+	testDriverConfig(t, driver, client, configServices, nil)
+
+	// failed dest update retains the kernel params
+	client.Emulator.DelDest(testService, ipvs.Dest{Addr: net.IP{10, 1, 0, 1}, Port: 8080})
+
+	configServices["test"].Backends["test1"] = config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 20}
+
+	if err := driver.Config(config.Config{Services: configServices}); err == nil {
+		t.Fatalf("IPVSDriver.Config: should fail")
+	} else if err.Error() != "set service test inet+tcp://10.0.0.1:80 backend test1 10.1.0.1:8080: no such file or directory" {
+		t.Errorf("IPVSDriver.Config: %v", err)
+	}
+
+	if dest := driver.services["inet+tcp://10.0.0.1:80"].dests["10.1.0.1:8080"]; dest.Weight != 10 {
+		t.Errorf("IPVSDriver.Config: failed dest has weight %d", dest.Weight)
+	}
+}
+
+func TestUpdateBatch(t *testing.T) {
+	var client = makeTestClient()
+	var driver = makeTestDriver(IPVSOptions{
+		SchedName: "wlc",
+		FwdMethod: ipvs.IP_VS_CONN_F_MASQ,
+	}, client)
+
+	var configServices = map[string]config.Service{
+		"test1": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+			},
+		},
+		"test2": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 10},
+				"test2": config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 10},
+			},
+		},
+	}
+
+	// not synced from the kernel
+	client.Emulator.NewService(ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 1}, Port: 80, SchedName: "wlc", Netmask: 0xffffffff})
+
+	if err := driver.Config(config.Config{Services: configServices}); err == nil {
+		t.Fatalf("IPVSDriver.Config: should fail")
+	} else if err.Error() != "new service test1 inet+tcp://10.0.0.1:80: file exists" {
+		t.Errorf("IPVSDriver.Config: %v", err)
+	}
+
+	if diff := pretty.Compare([]string{
+		"new inet+tcp://10.0.0.2:80",
+		"new inet+tcp://10.0.0.2:80 10.1.0.1:8080 weight=10",
+		"new inet+tcp://10.0.0.2:80 10.1.0.2:8080 weight=10",
+	}, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Config ops:\n%s", diff)
+	}
+
+	if client.batches != 2 {
+		t.Errorf("IPVSDriver.Config: %d batches", client.batches)
+	}
+
+	if _, exists := driver.services["inet+tcp://10.0.0.1:80"]; exists {
+		t.Errorf("IPVSDriver.Config: failed service is in running state")
+	}
+
+	// failed dests within a batch are reverted
+	client.Emulator.DelDest(ipvs.Service{Af: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Addr: net.IP{10, 0, 0, 2}, Port: 80}, ipvs.Dest{Addr: net.IP{10, 1, 0, 1}, Port: 8080})
+
+	delete(configServices, "test1")
+	configServices["test2"].Backends["test1"] = config.ServiceBackend{IPv4: "10.1.0.1", TCP: 8080, Weight: 20}
+	configServices["test2"].Backends["test2"] = config.ServiceBackend{IPv4: "10.1.0.2", TCP: 8080, Weight: 20}
+
+	if err := driver.Config(config.Config{Services: configServices}); err == nil {
+		t.Fatalf("IPVSDriver.Config: should fail")
+	} else if err.Error() != "set service test2 inet+tcp://10.0.0.2:80 backend test1 10.1.0.1:8080: no such file or directory" {
+		t.Errorf("IPVSDriver.Config: %v", err)
+	}
+
+	if diff := pretty.Compare([]string{
+		"set inet+tcp://10.0.0.2:80 10.1.0.2:8080 weight=20",
+	}, client.flushOps()); diff != "" {
+		t.Errorf("IPVSDriver.Config ops:\n%s", diff)
+	}
+
+	if client.batches != 3 {
+		t.Errorf("IPVSDriver.Config: %d batches", client.batches)
+	}
+
+	if dest := driver.services["inet+tcp://10.0.0.2:80"].dests["10.1.0.1:8080"]; dest.Weight != 10 {
+		t.Errorf("IPVSDriver.Config: failed dest has weight %d", dest.Weight)
+	}
+	if dest := driver.services["inet+tcp://10.0.0.2:80"].dests["10.1.0.2:8080"]; dest.Weight != 20 {
+		t.Errorf("IPVSDriver.Config: batched dest has weight %d", dest.Weight)
+	}
+}
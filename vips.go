@@ -0,0 +1,173 @@
+package clusterf
+
+import (
+	"github.com/qmsk/clusterf/ipvs"
+	"log"
+	"net"
+)
+
+// Local interface address for a service VIP
+type vip struct {
+	ip net.IP
+
+	// number of running services using the VIP, zero if unused
+	refs uint
+}
+
+type vips map[string]vip
+
+// Droute and tunnel dests require the VIP on a local interface
+func localFwdMethod(fwdMethod ipvs.FwdMethod) bool {
+	switch fwdMethod & ipvs.IP_VS_CONN_F_FWD_MASK {
+	case ipvs.IP_VS_CONN_F_DROUTE, ipvs.IP_VS_CONN_F_TUNNEL:
+		return true
+	default:
+		return false
+	}
+}
+
+// Any droute or tunnel dests, using the default --ipvs-fwd-method for services without any dests
+func (dests ServiceDests) localVIP(fwdMethod ipvs.FwdMethod) bool {
+	if len(dests) == 0 {
+		return localFwdMethod(fwdMethod)
+	}
+
+	for _, dest := range dests {
+		if localFwdMethod(dest.FwdMethod) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reference-counted VIPs for the running droute and tunnel services, including any draining services.
+//
+// Fwmark services do not have any VIP, and masq services do not use the --ipvs-vip-interface.
+func (services Services) vips(fwdMethod ipvs.FwdMethod) vips {
+	var vips = make(vips)
+
+	for _, service := range services {
+		if service.FwMark != 0 {
+			continue
+		} else if !service.dests.localVIP(fwdMethod) {
+			continue
+		}
+
+		var vip = vips[service.Addr.String()]
+
+		vip.ip = service.Addr
+		vip.refs++
+
+		vips[service.Addr.String()] = vip
+	}
+
+	return vips
+}
+
+// Any --ipvs-scope-prefix also limits the managed interface addresses
+func (scope ipvsScope) matchAddr(ip net.IP) bool {
+	if len(scope.prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range scope.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Read the existing interface addresses added by us, which are removed on the next update unless used by any running services.
+//
+// Only the addresses in the --ipvs-state are managed, and any other addresses are left alone.
+// Without --ipvs-state, any existing addresses are left alone, and only the addresses added since startup are removed.
+func (driver *IPVSDriver) syncVIPs() error {
+	driver.vips = make(vips)
+	driver.unownedVIPs = make(map[string]bool)
+
+	if driver.addrs == nil {
+		return nil
+	}
+
+	ips, err := driver.addrs.ListAddrs()
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		if !driver.scope.matchAddr(ip) {
+
+		} else if !driver.ownedVIPs[ip.String()] {
+			driver.unownedVIPs[ip.String()] = true
+		} else {
+			driver.vips[ip.String()] = vip{ip: ip}
+		}
+	}
+
+	return nil
+}
+
+// VIPs to add for the running services, excluding any existing unmanaged addresses
+func (driver *IPVSDriver) managedVIPs(services Services) vips {
+	var vips = services.vips(driver.options.FwdMethod)
+
+	for key := range driver.unownedVIPs {
+		delete(vips, key)
+	}
+
+	return vips
+}
+
+func (driver *IPVSDriver) addVIP(vip vip) error {
+	log.Printf("IPVS: Add VIP %v on %v\n", vip.ip, driver.options.VIPInterface)
+
+	if driver.writeClient == nil {
+		return nil
+	} else {
+		return driver.addrs.AddAddr(vip.ip)
+	}
+}
+
+func (driver *IPVSDriver) delVIP(vip vip) error {
+	log.Printf("IPVS: Delete VIP %v on %v\n", vip.ip, driver.options.VIPInterface)
+
+	if driver.writeClient == nil {
+		return nil
+	} else {
+		return driver.addrs.DelAddr(vip.ip)
+	}
+}
+
+// Add any new VIPs for the running services, and remove any unused VIPs.
+//
+// Failed operations are not reflected in the running state, and are retried on the next update.
+func (driver *IPVSDriver) updateVIPs(services Services) UpdateErrors {
+	var errors UpdateErrors
+
+	if driver.addrs == nil {
+		return nil
+	}
+
+	var vips = driver.managedVIPs(services)
+
+	for key, vip := range vips {
+		if _, exists := driver.vips[key]; exists {
+			driver.vips[key] = vip
+		} else if errors.checkVIP("add", vip.ip, driver.addVIP(vip)) {
+			driver.vips[key] = vip
+		}
+	}
+
+	for key, vip := range driver.vips {
+		if _, exists := vips[key]; exists {
+
+		} else if errors.checkVIP("del", vip.ip, driver.delVIP(vip)) {
+			delete(driver.vips, key)
+		}
+	}
+
+	return errors
+}
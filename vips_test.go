@@ -0,0 +1,223 @@
+package clusterf
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/qmsk/clusterf/config"
+	"github.com/qmsk/clusterf/ipvs"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testDriverVIPs(t *testing.T, addrs ipvs.AddrInterface, vips []string) {
+	var addrStrings []string
+
+	if ips, err := addrs.ListAddrs(); err != nil {
+		t.Fatalf("ListAddrs: %v", err)
+	} else {
+		for _, ip := range ips {
+			addrStrings = append(addrStrings, ip.String())
+		}
+	}
+
+	if diff := pretty.Compare(vips, addrStrings); diff != "" {
+		t.Errorf("VIPs:\n%s", diff)
+	}
+}
+
+func TestVIPs(t *testing.T) {
+	var client = makeTestClient()
+	var addrs = ipvs.NewAddrEmulator()
+	var options = IPVSOptions{
+		SchedName:    "wlc",
+		FwdMethod:    ipvs.IP_VS_CONN_F_DROUTE,
+		ScopePrefix:  []string{"10.0.0.0/24", "2001:db8::/64"},
+		VIPInterface: "dummy0",
+	}
+	var driver = makeTestDriver(options, client)
+
+	driver.scope, _ = options.scope()
+	driver.addrs = addrs
+
+	// existing addresses, left alone without any --ipvs-state
+	addrs.AddAddr(net.ParseIP("10.0.0.9"))
+	addrs.AddAddr(net.ParseIP("192.0.2.1"))
+
+	if err := driver.syncVIPs(); err != nil {
+		t.Fatalf("IPVSDriver.syncVIPs: %v", err)
+	}
+
+	var configServices = map[string]config.Service{
+		"test": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", IPv6: "2001:db8::1", TCP: 80, UDP: 53},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.1.0.1", IPv6: "2001:db8:1::1", Weight: 10},
+			},
+		},
+		"test2": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 443},
+		},
+		"test3": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80},
+		},
+		"test-fwmark": config.Service{
+			Frontend: &config.ServiceFrontend{FwMark: 1},
+		},
+		"test-masq": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.3", TCP: 80},
+			Backends: map[string]config.ServiceBackend{
+				"test1": config.ServiceBackend{IPv4: "10.2.0.1", TCP: 8080, Weight: 10},
+			},
+		},
+	}
+	var configRoutes = map[string]config.Route{
+		"masq": config.Route{Prefix: "10.2.0.0/16", IPVSMethod: "masq"},
+	}
+
+	if err := driver.Config(config.Config{Routes: configRoutes, Services: configServices}); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	testDriverVIPs(t, addrs, []string{"10.0.0.1", "10.0.0.2", "10.0.0.9", "192.0.2.1", "2001:db8::1"})
+
+	if vip := driver.vips["10.0.0.1"]; vip.refs != 3 {
+		t.Errorf("VIP 10.0.0.1 refs: %d", vip.refs)
+	}
+
+	// shared with the remaining test2 service
+	delete(configServices, "test")
+	delete(configServices, "test3")
+
+	if err := driver.Config(config.Config{Routes: configRoutes, Services: configServices}); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	testDriverVIPs(t, addrs, []string{"10.0.0.1", "10.0.0.9", "192.0.2.1"})
+
+	// removed by hand
+	addrs.DelAddr(net.ParseIP("10.0.0.1"))
+
+	if err := driver.Flush(); err == nil {
+		t.Fatalf("IPVSDriver.Flush: should fail")
+	} else if err.Error() != "del vip 10.0.0.1: cannot assign requested address" {
+		t.Errorf("IPVSDriver.Flush: %v", err)
+	}
+
+	testDriverVIPs(t, addrs, []string{"10.0.0.9", "192.0.2.1"})
+
+	// restart without any --ipvs-state, leaving alone the addresses added before
+	addrs.AddAddr(net.ParseIP("10.0.0.2"))
+
+	driver = makeTestDriver(options, client)
+	driver.scope, _ = options.scope()
+	driver.addrs = addrs
+
+	if err := driver.syncVIPs(); err != nil {
+		t.Fatalf("IPVSDriver.syncVIPs: %v", err)
+	}
+
+	if err := driver.Config(config.Config{}); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	testDriverVIPs(t, addrs, []string{"10.0.0.2", "10.0.0.9", "192.0.2.1"})
+}
+
+func TestVIPsState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clusterf-state")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var client = makeTestClient()
+	var addrs = ipvs.NewAddrEmulator()
+	var options = IPVSOptions{
+		SchedName:    "wlc",
+		FwdMethod:    ipvs.IP_VS_CONN_F_DROUTE,
+		VIPInterface: "dummy0",
+		State:        filepath.Join(dir, "state.json"),
+	}
+	var driver = makeTestDriver(options, client)
+
+	driver.adopt = true
+	driver.addrs = addrs
+
+	// existing addresses not added by us, such as those managed by keepalived
+	addrs.AddAddr(net.ParseIP("10.0.0.1"))
+	addrs.AddAddr(net.ParseIP("10.0.0.9"))
+
+	if err := driver.syncVIPs(); err != nil {
+		t.Fatalf("IPVSDriver.syncVIPs: %v", err)
+	}
+
+	var configServices = map[string]config.Service{
+		"test1": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.1", TCP: 80},
+		},
+		"test2": config.Service{
+			Frontend: &config.ServiceFrontend{IPv4: "10.0.0.2", TCP: 80},
+		},
+	}
+
+	if err := driver.Config(config.Config{Services: configServices}); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	testDriverVIPs(t, addrs, []string{"10.0.0.1", "10.0.0.2", "10.0.0.9"})
+
+	if _, ownedVIPs, err := loadState(options.State); err != nil {
+		t.Fatalf("loadState: %v", err)
+	} else if diff := pretty.Compare(map[string]bool{"10.0.0.2": true}, ownedVIPs); diff != "" {
+		t.Errorf("loadState:\n%s", diff)
+	}
+
+	// restart, only removing the addresses added by us
+	driver = makeTestDriver(options, client)
+	driver.addrs = addrs
+
+	if owned, ownedVIPs, err := loadState(options.State); err != nil {
+		t.Fatalf("loadState: %v", err)
+	} else {
+		driver.owned = owned
+		driver.ownedVIPs = ownedVIPs
+	}
+
+	if err := driver.syncVIPs(); err != nil {
+		t.Fatalf("IPVSDriver.syncVIPs: %v", err)
+	} else if err := driver.Sync(); err != nil {
+		t.Fatalf("IPVSDriver.Sync: %v", err)
+	}
+
+	if err := driver.Config(config.Config{}); err != nil {
+		t.Fatalf("IPVSDriver.Config: %v", err)
+	}
+
+	testDriverVIPs(t, addrs, []string{"10.0.0.1", "10.0.0.9"})
+
+	if _, ownedVIPs, err := loadState(options.State); err != nil {
+		t.Fatalf("loadState: %v", err)
+	} else if len(ownedVIPs) != 0 {
+		t.Errorf("loadState: %v", ownedVIPs)
+	}
+}
+
+func TestVIPsOptions(t *testing.T) {
+	var options = IPVSOptions{
+		SchedName:    "wlc",
+		VIPInterface: "dummy0",
+		Mock:         true,
+	}
+
+	if _, err := options.Open(); err == nil {
+		t.Errorf("IPVSOptions.Open: expected error for --ipvs-vip-interface without --ipvs-state or --ipvs-scope-prefix")
+	}
+
+	options.ScopePrefix = []string{"10.0.0.0/24"}
+
+	if _, err := options.Open(); err != nil {
+		t.Errorf("IPVSOptions.Open: %v", err)
+	}
+}